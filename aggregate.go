@@ -0,0 +1,144 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// Aggregator is a monoid that combines items into an aggregate, such as a
+// sum, minimum or maximum, which is itself represented as an item.
+type Aggregator[T any] struct {
+	// Sum combines two aggregates. It must be associative, but does not need
+	// to be commutative. Items are always combined in tree order.
+	Sum func(a, b T) T
+	// Identity is the aggregate of no items, such that Sum(Identity, a) and
+	// Sum(a, Identity) are both a.
+	Identity T
+}
+
+// nodeCache holds the aggregate and the augmented metadata of a subtree,
+// along with the aggregator and augmenter that produced them. It's replaced
+// as a whole, and dropped when the node is modified.
+type nodeCache[T any] struct {
+	agg   *Aggregator[T]
+	value T
+	aug   *Augmenter[T]
+	meta  any
+}
+
+// SetAggregator sets the aggregator used by Aggregate and AggregateRange.
+// The aggregate of each node is computed when first needed and cached until
+// the node is modified. Pass nil to stop caching aggregates.
+func (tr *BTreeG[T]) SetAggregator(agg *Aggregator[T]) {
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if agg == nil {
+		tr.agg = nil
+		return
+	}
+	// A fresh copy ensures that aggregates cached by a previous aggregator
+	// are never mistaken for ones produced by this one.
+	agg2 := *agg
+	tr.agg = &agg2
+}
+
+// Aggregate returns the aggregate of all items in the tree, or the
+// aggregator identity if the tree is empty.
+// Panics if no aggregator has been set.
+func (tr *BTreeG[T]) Aggregate() T {
+	if tr == nil {
+		var empty T
+		return empty
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.agg == nil {
+		panic("no aggregator")
+	}
+	if tr.root == nil {
+		return tr.agg.Identity
+	}
+	return tr.nodeAggregate(tr.root)
+}
+
+// AggregateRange returns the aggregate of the items within the range
+// [greaterOrEqual, lessThan), in O(log n) once the aggregates of the nodes
+// are cached.
+// Panics if no aggregator has been set.
+func (tr *BTreeG[T]) AggregateRange(greaterOrEqual, lessThan T) T {
+	if tr == nil {
+		var empty T
+		return empty
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.agg == nil {
+		panic("no aggregator")
+	}
+	if tr.root == nil || !tr.less(greaterOrEqual, lessThan) {
+		return tr.agg.Identity
+	}
+	return tr.nodeAggregateRange(tr.root, &greaterOrEqual, &lessThan)
+}
+
+// nodeAggregate returns the aggregate of the subtree, using the cached
+// aggregate when possible. Concurrent readers may compute the same aggregate
+// at once, which is harmless because they produce the same value.
+func (tr *BTreeG[T]) nodeAggregate(n *node[T]) T {
+	c := n.cache.Load()
+	if c != nil && c.agg == tr.agg {
+		return c.value
+	}
+	sum := tr.agg.Identity
+	for i := 0; i <= len(n.items); i++ {
+		if !n.leaf() {
+			sum = tr.agg.Sum(sum, tr.nodeAggregate((*n.children)[i]))
+		}
+		if i < len(n.items) {
+			sum = tr.agg.Sum(sum, n.items[i])
+		}
+	}
+	c2 := &nodeCache[T]{agg: tr.agg, value: sum}
+	if c != nil {
+		c2.aug, c2.meta = c.aug, c.meta
+	}
+	// losing a race with another reader only means the aggregate is
+	// recomputed next time
+	n.cache.CompareAndSwap(c, c2)
+	return sum
+}
+
+// nodeAggregateRange returns the aggregate of the items in the subtree that
+// are within the range [lo, hi). A nil bound is unbounded.
+func (tr *BTreeG[T]) nodeAggregateRange(n *node[T], lo, hi *T) T {
+	if lo == nil && hi == nil {
+		return tr.nodeAggregate(n)
+	}
+	i, j := 0, len(n.items)
+	if lo != nil {
+		i, _ = tr.bsearch(n, *lo)
+	}
+	if hi != nil {
+		j, _ = tr.bsearch(n, *hi)
+	}
+	if n.leaf() {
+		sum := tr.agg.Identity
+		for ; i < j; i++ {
+			sum = tr.agg.Sum(sum, n.items[i])
+		}
+		return sum
+	}
+	if i == j {
+		// the range falls entirely within one child
+		return tr.nodeAggregateRange((*n.children)[i], lo, hi)
+	}
+	sum := tr.nodeAggregateRange((*n.children)[i], lo, nil)
+	for ; i < j; i++ {
+		sum = tr.agg.Sum(sum, n.items[i])
+		if i+1 < j {
+			sum = tr.agg.Sum(sum, tr.nodeAggregate((*n.children)[i+1]))
+		}
+	}
+	return tr.agg.Sum(sum, tr.nodeAggregateRange((*n.children)[j], nil, hi))
+}
@@ -0,0 +1,91 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := NewBTreeGOptions(func(a, b int) bool { return a < b },
+		Options{Degree: 4})
+	assert(func() (ok bool) {
+		defer func() { ok = recover() != nil }()
+		tr.Aggregate()
+		return false
+	}())
+	tr.SetAggregator(&Aggregator[int]{Sum: func(a, b int) int { return a + b }})
+	assert(tr.Aggregate() == 0)
+	check := func(tr *BTreeG[int]) {
+		var total int
+		tr.Scan(func(item int) bool {
+			total += item
+			return true
+		})
+		assert(tr.Aggregate() == total)
+		for i := 0; i < 20; i++ {
+			lo, hi := rng.Intn(2000)-50, rng.Intn(2000)-50
+			var sum int
+			tr.AscendRange(lo, hi, func(item int) bool {
+				sum += item
+				return true
+			})
+			assert(tr.AggregateRange(lo, hi) == sum)
+		}
+	}
+	var copies []*BTreeG[int]
+	for i := 0; i < 1000; i++ {
+		switch rng.Intn(12) {
+		case 0, 1, 2, 3:
+			tr.Set(rng.Intn(2000))
+		case 4, 5:
+			tr.Delete(rng.Intn(2000))
+		case 6:
+			lo := rng.Intn(2000)
+			tr.DeleteRange(lo, lo+rng.Intn(200), nil)
+		case 7:
+			tr.PopMin()
+			tr.PopMax()
+			tr.DeleteAt(rng.Intn(tr.Len() + 1))
+		case 8:
+			max, _ := tr.Max()
+			tr.Load(max + 1)
+			tr.AppendSorted([]int{max + 2, max + 3, max + 5})
+		case 9:
+			tr.DeleteAscend(rng.Intn(2000), func(item int) Action {
+				if item%3 == 0 {
+					return Delete
+				}
+				return Keep
+			})
+		case 10:
+			copies = append(copies, tr.Copy())
+		case 11:
+			if rng.Intn(10) == 0 {
+				tr.Compact()
+			}
+		}
+		check(tr)
+	}
+	for _, tr := range copies {
+		check(tr)
+	}
+
+	// changing the aggregator discards the cached aggregates
+	maxAgg := &Aggregator[int]{
+		Sum: func(a, b int) int {
+			if a > b {
+				return a
+			}
+			return b
+		},
+		Identity: -1 << 31,
+	}
+	tr.SetAggregator(maxAgg)
+	max, _ := tr.Max()
+	assert(tr.Aggregate() == max)
+	tr.SetAggregator(nil)
+	tr.Set(max + 1)
+	tr.SetAggregator(maxAgg)
+	assert(tr.Aggregate() == max+1)
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// Augmenter maintains user-defined metadata for every subtree, such as
+// counts, sums or bounding intervals, which can be used to prune searches
+// with VisitAugmented.
+type Augmenter[T any] struct {
+	// Compute returns the metadata for a node from its items and from the
+	// metadata of its children, which is nil for leaf nodes. It's called
+	// the first time the metadata is needed after the node, or any node
+	// below it, has changed. It must not retain or modify the slices.
+	Compute func(items []T, children []any) any
+}
+
+// AugNode is a read-only view of a node of a tree that has an augmenter.
+// It's only valid during the call to VisitAugmented.
+type AugNode[T any] struct {
+	tr *BTreeG[T]
+	n  *node[T]
+}
+
+// SetAugmenter sets the augmenter used to compute node metadata. Metadata
+// is computed when first needed and cached until the node is modified. Pass
+// nil to stop caching metadata.
+func (tr *BTreeG[T]) SetAugmenter(aug *Augmenter[T]) {
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if aug == nil {
+		tr.aug = nil
+		return
+	}
+	// A fresh copy ensures that metadata cached by a previous augmenter is
+	// never mistaken for metadata computed by this one.
+	aug2 := *aug
+	tr.aug = &aug2
+}
+
+// VisitAugmented calls visit with the root node while the tree is locked
+// for reading. Visit is not called if the tree is empty.
+// Panics if no augmenter has been set.
+func (tr *BTreeG[T]) VisitAugmented(visit func(root AugNode[T])) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.aug == nil {
+		panic("no augmenter")
+	}
+	if tr.root != nil {
+		visit(AugNode[T]{tr, tr.root})
+	}
+}
+
+// AscendFilterAugmented is like AscendFilter, but it also skips every
+// subtree for which skip returns true when called with the metadata of the
+// subtree, without visiting its items. Use it to prune subtrees that hold no
+// items that keep would accept, such as subtrees whose greatest value is
+// below a threshold.
+// Panics if no augmenter has been set.
+func (tr *BTreeG[T]) AscendFilterAugmented(pivot T, skip func(meta any) bool,
+	keep func(item T) bool, iter func(item T) bool,
+) {
+	tr.ascendFilter(&pivot, skip, keep, iter)
+}
+
+// Leaf returns true if the node has no children.
+func (n AugNode[T]) Leaf() bool {
+	return n.n.leaf()
+}
+
+// Items returns the items of the node, in order. The child at index i holds
+// the items that are less than Items()[i]. The slice must not be modified.
+func (n AugNode[T]) Items() []T {
+	return n.n.items
+}
+
+// NumChildren returns the number of children, which is zero for a leaf and
+// otherwise one more than the number of items.
+func (n AugNode[T]) NumChildren() int {
+	if n.n.leaf() {
+		return 0
+	}
+	return len(*n.n.children)
+}
+
+// Child returns the child at index.
+func (n AugNode[T]) Child(index int) AugNode[T] {
+	return AugNode[T]{n.tr, (*n.n.children)[index]}
+}
+
+// Meta returns the metadata of the subtree.
+func (n AugNode[T]) Meta() any {
+	return n.tr.nodeMeta(n.n)
+}
+
+// nodeMeta returns the metadata of the subtree, using the cached metadata
+// when possible.
+func (tr *BTreeG[T]) nodeMeta(n *node[T]) any {
+	c := n.cache.Load()
+	if c != nil && c.aug == tr.aug {
+		return c.meta
+	}
+	var children []any
+	if !n.leaf() {
+		children = make([]any, len(*n.children))
+		for i, child := range *n.children {
+			children[i] = tr.nodeMeta(child)
+		}
+	}
+	meta := tr.aug.Compute(n.items, children)
+	c2 := &nodeCache[T]{aug: tr.aug, meta: meta}
+	if c != nil {
+		c2.agg, c2.value = c.agg, c.value
+	}
+	n.cache.CompareAndSwap(c, c2)
+	return meta
+}
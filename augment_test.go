@@ -0,0 +1,160 @@
+package btree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type testInterval struct{ lo, hi int }
+
+// stab returns the intervals containing the point, pruning subtrees whose
+// greatest hi is below the point.
+func stab(n AugNode[testInterval], point int, found []testInterval,
+) []testInterval {
+	if n.Meta().(int) <= point {
+		return found
+	}
+	for i, iv := range n.Items() {
+		if !n.Leaf() {
+			found = stab(n.Child(i), point, found)
+		}
+		if iv.lo > point {
+			return found
+		}
+		if point < iv.hi {
+			found = append(found, iv)
+		}
+	}
+	if !n.Leaf() {
+		found = stab(n.Child(n.NumChildren()-1), point, found)
+	}
+	return found
+}
+
+func TestAugment(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := NewBTreeGOptions(func(a, b testInterval) bool {
+		if a.lo != b.lo {
+			return a.lo < b.lo
+		}
+		return a.hi < b.hi
+	}, Options{Degree: 4})
+	var computes int
+	tr.SetAugmenter(&Augmenter[testInterval]{
+		Compute: func(items []testInterval, children []any) any {
+			computes++
+			max := 0
+			for _, iv := range items {
+				if iv.hi > max {
+					max = iv.hi
+				}
+			}
+			for _, child := range children {
+				if child.(int) > max {
+					max = child.(int)
+				}
+			}
+			return max
+		},
+	})
+	for i := 0; i < 2000; i++ {
+		lo := rng.Intn(10000)
+		iv := testInterval{lo, lo + 1 + rng.Intn(100)}
+		if rng.Intn(4) == 0 {
+			tr.Delete(iv)
+			tr.PopMin()
+		} else {
+			tr.Set(iv)
+		}
+		if i%10 != 0 {
+			continue
+		}
+		point := rng.Intn(10100)
+		var expect []testInterval
+		tr.Scan(func(iv testInterval) bool {
+			if iv.lo <= point && point < iv.hi {
+				expect = append(expect, iv)
+			}
+			return true
+		})
+		var found []testInterval
+		tr.VisitAugmented(func(root AugNode[testInterval]) {
+			found = stab(root, point, nil)
+		})
+		sort.Slice(found, func(i, j int) bool { return tr.Less(found[i], found[j]) })
+		assert(len(found) == len(expect))
+		for i := range found {
+			assert(found[i] == expect[i])
+		}
+	}
+	// unchanged nodes are not recomputed
+	tr.VisitAugmented(func(root AugNode[testInterval]) { root.Meta() })
+	computes = 0
+	tr.VisitAugmented(func(root AugNode[testInterval]) { root.Meta() })
+	assert(computes == 0)
+	tr.Set(testInterval{-1, 100000})
+	tr.VisitAugmented(func(root AugNode[testInterval]) {
+		assert(root.Meta().(int) == 100000)
+	})
+	assert(computes > 0 && computes <= tr.Height())
+}
+
+func TestAugmentAscendFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tr := NewBTreeGOptions(func(a, b testInterval) bool {
+		if a.lo != b.lo {
+			return a.lo < b.lo
+		}
+		return a.hi < b.hi
+	}, Options{Degree: 4})
+	tr.SetAugmenter(&Augmenter[testInterval]{
+		Compute: func(items []testInterval, children []any) any {
+			max := 0
+			for _, iv := range items {
+				if iv.hi > max {
+					max = iv.hi
+				}
+			}
+			for _, child := range children {
+				if child.(int) > max {
+					max = child.(int)
+				}
+			}
+			return max
+		},
+	})
+	for i := 0; i < 2000; i++ {
+		lo := rng.Intn(10000)
+		tr.Set(testInterval{lo, lo + 1 + rng.Intn(100)})
+	}
+	for i := 0; i < 100; i++ {
+		point := rng.Intn(10100)
+		var expect []testInterval
+		tr.Scan(func(iv testInterval) bool {
+			if iv.lo <= point && point < iv.hi {
+				expect = append(expect, iv)
+			}
+			return true
+		})
+		var found []testInterval
+		var visited int
+		tr.AscendFilterAugmented(testInterval{lo: point - 100},
+			func(meta any) bool { return meta.(int) <= point },
+			func(iv testInterval) bool {
+				visited++
+				return point < iv.hi
+			},
+			func(iv testInterval) bool {
+				if iv.lo > point {
+					return false
+				}
+				found = append(found, iv)
+				return true
+			})
+		assert(len(found) == len(expect) && visited < tr.Len()/2)
+		for i := range found {
+			assert(found[i] == expect[i])
+		}
+	}
+}
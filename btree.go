@@ -3,6 +3,8 @@
 // license that can be found in the LICENSE file.
 package btree
 
+import "math/rand"
+
 type BTree struct {
 	base *BTreeG[any]
 }
@@ -62,6 +64,33 @@ func (tr *BTree) SetHint(item any, hint *PathHint) (prev any) {
 	return v
 }
 
+// TrySet sets or replaces the item, like Set, but returns ErrFull instead of
+// panicking when the tree has reached Options.MaxItems.
+// Returns the value for the replaced item or nil if the key was not found.
+func (tr *BTree) TrySet(item any) (prev any, err error) {
+	if item == nil {
+		panic("nil item")
+	}
+	v, ok, err := tr.base.TrySet(item)
+	if !ok {
+		return nil, err
+	}
+	return v, nil
+}
+
+// TryReplace replaces the item with the same key, and returns the replaced
+// item. Returns ErrKeyNotFound if there is no such item.
+func (tr *BTree) TryReplace(item any) (prev any, err error) {
+	if item == nil {
+		panic("nil item")
+	}
+	v, err := tr.base.TryReplace(item)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
 // Get a value for key.
 // Returns nil if the key was not found.
 func (tr *BTree) Get(key any) any {
@@ -99,6 +128,58 @@ func (tr *BTree) getHintMut(key any, hint *PathHint, mut bool) (value any) {
 	return v
 }
 
+// GetLE returns the greatest item that is less than or equal to key.
+// Returns nil if there is no such item.
+func (tr *BTree) GetLE(key any) any {
+	if key == nil {
+		return nil
+	}
+	v, ok := tr.base.GetLE(key)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// GetGE returns the smallest item that is greater than or equal to key.
+// Returns nil if there is no such item.
+func (tr *BTree) GetGE(key any) any {
+	if key == nil {
+		return nil
+	}
+	v, ok := tr.base.GetGE(key)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Prev returns the greatest item that is less than key.
+// Returns nil if there is no such item.
+func (tr *BTree) Prev(key any) any {
+	if key == nil {
+		return nil
+	}
+	v, ok := tr.base.Prev(key)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Next returns the smallest item that is greater than key.
+// Returns nil if there is no such item.
+func (tr *BTree) Next(key any) any {
+	if key == nil {
+		return nil
+	}
+	v, ok := tr.base.Next(key)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
 // Len returns the number of items in the tree
 func (tr *BTree) Len() int {
 	return tr.base.Len()
@@ -289,6 +370,25 @@ func (tr *BTree) GetAtMut(index int) any {
 	return v
 }
 
+// Rand returns a uniformly random item, chosen using rng.
+// Returns nil if the tree has no items.
+func (tr *BTree) Rand(rng *rand.Rand) any {
+	v, ok := tr.base.Rand(rng)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// IndexOf returns the index of the item for key.
+// Returns false if the key was not found.
+func (tr *BTree) IndexOf(key any) (int, bool) {
+	if key == nil {
+		return 0, false
+	}
+	return tr.base.IndexOf(key)
+}
+
 // DeleteAt deletes the item at index.
 // Return nil if the tree is empty or the index is out of bounds.
 func (tr *BTree) DeleteAt(index int) any {
@@ -305,6 +405,16 @@ func (tr *BTree) Height() int {
 	return tr.base.Height()
 }
 
+// Stats returns structural statistics for the tree.
+func (tr *BTree) Stats() Stats {
+	return tr.base.Stats()
+}
+
+// Compact rebuilds the tree with every node packed as full as possible.
+func (tr *BTree) Compact() {
+	tr.base.Compact()
+}
+
 // Walk iterates over all items in tree, in order.
 // The items param will contain one or more items.
 func (tr *BTree) Walk(iter func(items []any)) {
@@ -351,6 +461,13 @@ func (tr *BTree) IterMut() Iter {
 	return Iter{tr.base.IterMut()}
 }
 
+// IterSnapshot returns a read-only iterator over a copy-on-write snapshot of
+// the tree, which is unaffected by concurrent writes.
+// The Release method must be called finished with iterator.
+func (tr *BTree) IterSnapshot() Iter {
+	return Iter{tr.base.IterSnapshot()}
+}
+
 // Seek to item greater-or-equal-to key.
 // Returns false if there was no item found.
 func (iter *Iter) Seek(key any) bool {
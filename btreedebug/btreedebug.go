@@ -0,0 +1,293 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package btreedebug provides a read-only http.Handler for inspecting live
+// trees.
+//
+// Trees registered with a btree.Registry are listed automatically and may be
+// dumped in full. Trees added with Add also support key lookups and bounded
+// range dumps.
+//
+// The handler serves the following JSON endpoints:
+//
+//	/                                  list trees and their stats
+//	/{name}                            stats for a single tree
+//	/{name}/get?key=K                  look up a single item
+//	/{name}/range?start=S&end=E&limit=N  dump items in [start, end)
+//
+// NewRangeHandler serves paginated range queries over a single tree, for
+// exposing an index to tooling.
+package btreedebug
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/btree"
+)
+
+// DefaultLimit is the number of items returned by a range dump when no
+// limit is provided.
+const DefaultLimit = 100
+
+// Handler is an http.Handler for inspecting trees.
+type Handler struct {
+	// Registry is consulted for trees that were not added to the handler
+	// using Add. Default is btree.DefaultRegistry.
+	Registry *btree.Registry
+
+	mu    sync.RWMutex
+	trees map[string]*entry
+}
+
+type entry struct {
+	stats func() btree.Stats
+	get   func(key string) (item string, found bool, err error)
+	dump  func(start, end string, limit int) (items []string, more bool,
+		err error)
+}
+
+// NewHandler returns a new Handler that serves the trees in the
+// btree.DefaultRegistry.
+func NewHandler() *Handler {
+	return &Handler{
+		Registry: btree.DefaultRegistry,
+		trees:    make(map[string]*entry),
+	}
+}
+
+// Add a tree to the handler using the provided name.
+// The parse function converts a key from a request into an item that is used
+// for lookups and range bounds. Pass nil for parse to only allow stats and
+// unbounded range dumps.
+func Add[T any](h *Handler, name string, tr *btree.BTreeG[T],
+	parse func(key string) (T, error),
+) {
+	e := &entry{stats: tr.Stats}
+	e.get = func(key string) (string, bool, error) {
+		if parse == nil {
+			return "", false, fmt.Errorf("lookups not supported")
+		}
+		pivot, err := parse(key)
+		if err != nil {
+			return "", false, err
+		}
+		item, ok := tr.Get(pivot)
+		if !ok {
+			return "", false, nil
+		}
+		return fmt.Sprint(item), true, nil
+	}
+	e.dump = func(start, end string, limit int) ([]string, bool, error) {
+		if parse == nil && (start != "" || end != "") {
+			return nil, false, fmt.Errorf("range bounds not supported")
+		}
+		var lo, hi T
+		var err error
+		if start != "" {
+			if lo, err = parse(start); err != nil {
+				return nil, false, err
+			}
+		}
+		if end != "" {
+			if hi, err = parse(end); err != nil {
+				return nil, false, err
+			}
+		}
+		items := []string{}
+		var more bool
+		iter := func(item T) bool {
+			if end != "" && !tr.Less(item, hi) {
+				return false
+			}
+			if len(items) == limit {
+				more = true
+				return false
+			}
+			items = append(items, fmt.Sprint(item))
+			return true
+		}
+		if start != "" {
+			tr.Ascend(lo, iter)
+		} else {
+			tr.Scan(iter)
+		}
+		return items, more, nil
+	}
+	h.mu.Lock()
+	h.trees[name] = e
+	h.mu.Unlock()
+}
+
+// Remove a tree from the handler.
+func (h *Handler) Remove(name string) {
+	h.mu.Lock()
+	delete(h.trees, name)
+	h.mu.Unlock()
+}
+
+func (h *Handler) lookupLocal(name string) *entry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.trees[name]
+}
+
+func (h *Handler) lookup(name string) *entry {
+	e := h.lookupLocal(name)
+	if e == nil && h.Registry != nil {
+		if tr, ok := h.Registry.Lookup(name); ok {
+			e = registryEntry(tr)
+		}
+	}
+	return e
+}
+
+// registryEntry returns an entry for a tree of an unknown type. Stats are
+// taken from the Stats or Len methods and range dumps use the Scan method.
+func registryEntry(tr any) *entry {
+	e := new(entry)
+	e.stats = func() btree.Stats {
+		switch tr := tr.(type) {
+		case interface{ Stats() btree.Stats }:
+			return tr.Stats()
+		case interface{ Len() int }:
+			return btree.Stats{Items: tr.Len()}
+		}
+		return btree.Stats{}
+	}
+	e.get = func(key string) (string, bool, error) {
+		return "", false, fmt.Errorf("lookups not supported")
+	}
+	e.dump = func(start, end string, limit int) ([]string, bool, error) {
+		if start != "" || end != "" {
+			return nil, false, fmt.Errorf("range bounds not supported")
+		}
+		scan := reflect.ValueOf(tr).MethodByName("Scan")
+		if !scan.IsValid() || scan.Type().NumIn() != 1 {
+			return nil, false, fmt.Errorf("range dumps not supported")
+		}
+		iterType := scan.Type().In(0)
+		if iterType.Kind() != reflect.Func || iterType.NumOut() != 1 ||
+			iterType.Out(0).Kind() != reflect.Bool {
+			return nil, false, fmt.Errorf("range dumps not supported")
+		}
+		items := []string{}
+		var more bool
+		iter := reflect.MakeFunc(iterType, func(args []reflect.Value,
+		) []reflect.Value {
+			if len(items) == limit {
+				more = true
+				return []reflect.Value{reflect.ValueOf(false)}
+			}
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = fmt.Sprint(arg.Interface())
+			}
+			items = append(items, strings.Join(parts, " "))
+			return []reflect.Value{reflect.ValueOf(true)}
+		})
+		scan.Call([]reflect.Value{iter})
+		return items, more, nil
+	}
+	return e
+}
+
+type treeInfo struct {
+	Name  string      `json:"name"`
+	Stats btree.Stats `json:"stats"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		h.serveList(w)
+		return
+	}
+	name, action, _ := strings.Cut(path, "/")
+	e := h.lookup(name)
+	if e == nil {
+		http.Error(w, "tree not found", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	switch action {
+	case "":
+		writeJSON(w, treeInfo{Name: name, Stats: e.stats()})
+	case "get":
+		key := query.Get("key")
+		item, found, err := e.get(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, struct {
+			Key   string `json:"key"`
+			Found bool   `json:"found"`
+			Item  string `json:"item,omitempty"`
+		}{key, found, item})
+	case "range":
+		limit := DefaultLimit
+		if s := query.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		items, more, err := e.dump(query.Get("start"), query.Get("end"), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, struct {
+			Items []string `json:"items"`
+			More  bool     `json:"more"`
+		}{items, more})
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (h *Handler) serveList(w http.ResponseWriter) {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.trees))
+	for name := range h.trees {
+		names = append(names, name)
+	}
+	h.mu.RUnlock()
+	if h.Registry != nil {
+		for _, name := range h.Registry.Names() {
+			if h.lookupLocal(name) == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	infos := []treeInfo{}
+	for _, name := range names {
+		if e := h.lookup(name); e != nil {
+			infos = append(infos, treeInfo{Name: name, Stats: e.stats()})
+		}
+	}
+	writeJSON(w, struct {
+		Trees []treeInfo `json:"trees"`
+	}{infos})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,124 @@
+package btreedebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/tidwall/btree"
+)
+
+func getJSON(t *testing.T, h http.Handler, url string, v any) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code
+}
+
+func TestHandler(t *testing.T) {
+	tr := btree.NewBTreeG(func(a, b int) bool { return a < b })
+	for i := 0; i < 1000; i++ {
+		tr.Set(i)
+	}
+	h := NewHandler()
+	h.Registry = nil
+	Add(h, "ints", tr, strconv.Atoi)
+
+	var list struct {
+		Trees []struct {
+			Name  string
+			Stats btree.Stats
+		}
+	}
+	if code := getJSON(t, h, "/", &list); code != 200 {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(list.Trees) != 1 || list.Trees[0].Name != "ints" ||
+		list.Trees[0].Stats.Items != 1000 {
+		t.Fatalf("bad list: %+v", list)
+	}
+
+	var get struct {
+		Found bool
+		Item  string
+	}
+	getJSON(t, h, "/ints/get?key=500", &get)
+	if !get.Found || get.Item != "500" {
+		t.Fatalf("bad get: %+v", get)
+	}
+	getJSON(t, h, "/ints/get?key=5000", &get)
+	if get.Found {
+		t.Fatalf("expected not found")
+	}
+	if code := getJSON(t, h, "/ints/get?key=abc", &get); code != 400 {
+		t.Fatalf("expected 400, got %d", code)
+	}
+
+	var rng struct {
+		Items []string
+		More  bool
+	}
+	getJSON(t, h, "/ints/range?start=10&end=20", &rng)
+	if len(rng.Items) != 10 || rng.Items[0] != "10" || rng.More {
+		t.Fatalf("bad range: %+v", rng)
+	}
+	getJSON(t, h, "/ints/range?limit=5", &rng)
+	if len(rng.Items) != 5 || rng.Items[0] != "0" || !rng.More {
+		t.Fatalf("bad range: %+v", rng)
+	}
+	for _, url := range []string{"/ints/range?limit=0", "/ints/range?limit=-1"} {
+		if code := getJSON(t, h, url, &rng); code != 400 {
+			t.Fatalf("%s: expected 400, got %d", url, code)
+		}
+	}
+
+	if code := getJSON(t, h, "/missing", &list); code != 404 {
+		t.Fatalf("expected 404, got %d", code)
+	}
+	h.Remove("ints")
+	if code := getJSON(t, h, "/ints", &list); code != 404 {
+		t.Fatalf("expected 404, got %d", code)
+	}
+}
+
+func TestHandlerRegistry(t *testing.T) {
+	var m btree.Map[string, int]
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+	reg := btree.NewRegistry()
+	reg.Register("map", &m)
+	h := NewHandler()
+	h.Registry = reg
+
+	var list struct {
+		Trees []struct {
+			Name  string
+			Stats btree.Stats
+		}
+	}
+	getJSON(t, h, "/", &list)
+	if len(list.Trees) != 1 || list.Trees[0].Name != "map" ||
+		list.Trees[0].Stats.Items != 3 {
+		t.Fatalf("bad list: %+v", list)
+	}
+	var rng struct {
+		Items []string
+		More  bool
+	}
+	getJSON(t, h, "/map/range?limit=2", &rng)
+	if len(rng.Items) != 2 || rng.Items[0] != "a 1" || !rng.More {
+		t.Fatalf("bad range: %+v", rng)
+	}
+	var get struct{}
+	if code := getJSON(t, h, "/map/get?key=a", &get); code != 400 {
+		t.Fatalf("expected 400, got %d", code)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btreedebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/btree"
+)
+
+// DefaultMaxLimit is the largest page served by a range handler when no
+// MaxLimit is provided.
+const DefaultMaxLimit = 1000
+
+// Options for passing to the NewRangeHandler function.
+type RangeOptions[T any] struct {
+	// Parse converts the start and end query parameters into items that are
+	// used as range bounds. Required.
+	Parse func(key string) (T, error)
+	// Key returns the key of an item. It must round-trip through Parse, and
+	// is used for the pagination cursor. Required.
+	Key func(item T) string
+	// Value, if provided, returns the value that is encoded as JSON for an
+	// item. Default is the item itself.
+	Value func(item T) any
+	// MaxLimit is the largest page that may be requested. Default is
+	// DefaultMaxLimit.
+	MaxLimit int
+}
+
+type rangeItem struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// NewRangeHandler returns a read-only http.Handler that serves range queries
+// over the tree.
+//
+//	GET ?start=S&end=E&limit=N
+//
+// Items in [start, end) are returned as a JSON object, or as newline
+// delimited JSON when the request has format=ndjson or accepts
+// application/x-ndjson. Both bounds are optional and limit defaults to
+// DefaultLimit. The limit must be at least one.
+//
+// Pages use keyset pagination. When more items follow, the response has an
+// X-Next-Start header holding the start key of the next page, and a Link
+// header with the URL of the next page. JSON responses also include the key
+// as "next".
+func NewRangeHandler[T any](tr *btree.BTreeG[T], opts RangeOptions[T],
+) http.Handler {
+	if opts.Parse == nil || opts.Key == nil {
+		panic("btreedebug: Parse and Key are required")
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = DefaultMaxLimit
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		limit := DefaultLimit
+		if s := query.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > opts.MaxLimit {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		var lo, hi T
+		start, end := query.Get("start"), query.Get("end")
+		var err error
+		if start != "" {
+			if lo, err = opts.Parse(start); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if end != "" {
+			if hi, err = opts.Parse(end); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		items := []rangeItem{}
+		var next string
+		var more bool
+		iter := func(item T) bool {
+			if end != "" && !tr.Less(item, hi) {
+				return false
+			}
+			if len(items) == limit {
+				next, more = opts.Key(item), true
+				return false
+			}
+			var value any = item
+			if opts.Value != nil {
+				value = opts.Value(item)
+			}
+			items = append(items, rangeItem{opts.Key(item), value})
+			return true
+		}
+		if start != "" {
+			tr.Ascend(lo, iter)
+		} else {
+			tr.Scan(iter)
+		}
+		if more {
+			w.Header().Set("X-Next-Start", next)
+			query.Set("start", next)
+			u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+			w.Header().Set("Link", "<"+u.String()+`>; rel="next"`)
+		}
+		if query.Get("format") == "ndjson" ||
+			strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			for _, item := range items {
+				enc.Encode(item)
+			}
+			return
+		}
+		writeJSON(w, struct {
+			Items []rangeItem `json:"items"`
+			Next  string      `json:"next,omitempty"`
+		}{items, next})
+	})
+}
@@ -0,0 +1,85 @@
+package btreedebug
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/tidwall/btree"
+)
+
+func TestRangeHandler(t *testing.T) {
+	tr := btree.NewBTreeG(func(a, b int) bool { return a < b })
+	for i := 0; i < 100; i++ {
+		tr.Set(i * 2)
+	}
+	h := NewRangeHandler(tr, RangeOptions[int]{
+		Parse: strconv.Atoi,
+		Key:   strconv.Itoa,
+		Value: func(item int) any { return item / 2 },
+	})
+
+	// follow the pagination links through a range
+	var keys []string
+	url := "/?start=11&end=51&limit=7"
+	for pages := 0; url != ""; pages++ {
+		if pages > 10 {
+			t.Fatal("too many pages")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 200 {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var page struct {
+			Items []struct {
+				Key   string
+				Value int
+			}
+			Next string
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page.Items {
+			keys = append(keys, item.Key)
+		}
+		if page.Next != w.Header().Get("X-Next-Start") {
+			t.Fatalf("bad next %q", page.Next)
+		}
+		url = ""
+		if link := w.Header().Get("Link"); link != "" {
+			url = link[1 : len(link)-len(`>; rel="next"`)]
+		}
+	}
+	if len(keys) != 20 || keys[0] != "12" || keys[19] != "50" {
+		t.Fatalf("bad keys: %v", keys)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/?limit=3", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	h.ServeHTTP(w, req)
+	var lines int
+	for s := bufio.NewScanner(w.Body); s.Scan(); lines++ {
+		var item struct{ Key string }
+		if err := json.Unmarshal(s.Bytes(), &item); err != nil ||
+			item.Key != strconv.Itoa(lines*2) {
+			t.Fatalf("bad line %q", s.Text())
+		}
+	}
+	if lines != 3 || w.Header().Get("X-Next-Start") != "6" {
+		t.Fatalf("bad ndjson response: %d lines", lines)
+	}
+
+	for _, url := range []string{"/?limit=5000", "/?start=x", "/?limit=-1",
+		"/?limit=0"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 400 {
+			t.Fatalf("%s: expected 400, got %d", url, w.Code)
+		}
+	}
+}
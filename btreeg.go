@@ -3,7 +3,15 @@
 // license that can be found in the LICENSE file.
 package btree
 
-import "sync"
+import (
+	"context"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
 
 type BTreeG[T any] struct {
 	isoid        uint64
@@ -14,6 +22,16 @@ type BTreeG[T any] struct {
 	copyItems    bool
 	isoCopyItems bool
 	readOnly     bool
+	maxItems     int
+	gen          uint64
+	tombs        *BTreeG[T]
+	allocs       AllocStats
+	shuffle      *shuffler
+	agg          *Aggregator[T]
+	aug          *Augmenter[T]
+	clone        func(item T) T
+	sum          func(item T) uint64
+	sums         *BTreeG[any]
 	less         func(a, b T) bool
 	empty        T
 	max          int
@@ -25,6 +43,7 @@ type node[T any] struct {
 	count    int
 	items    []T
 	children *[]*node[T]
+	cache    atomic.Pointer[nodeCache[T]]
 }
 
 // PathHint is a utility type used with the *Hint() functions. Hints provide
@@ -47,6 +66,24 @@ type Options struct {
 	NoLocks bool
 	// ReadOnly marks the tree as read-only, any modifications will trigger panic.
 	ReadOnly bool
+	// MaxItems limits the number of items in the tree. When non-zero, any
+	// operation that would insert an item into a full tree panics with
+	// ErrFull, while replacing existing items is still allowed. Use TrySet
+	// to get the error instead.
+	MaxItems int
+	// Tombstones enables tombstone mode. Every deleted item is recorded as a
+	// tombstone, which can be observed using the Tombstones method, until
+	// the tombstones are discarded by Compact. Setting an item removes its
+	// tombstone. Deleted items are still removed from the tree right away,
+	// and the tombstones are kept aside, so lookups and iterators never see
+	// them.
+	Tombstones bool
+	// ShuffleSeed is for testing only. When non-zero, behaviors that are not
+	// part of the API contract are randomized using the seed: Walk delivers
+	// items in randomly sized batches, and write operations randomly force
+	// copy-on-write of the nodes they touch, which moves items in memory.
+	// Use it to flush out code that depends on such incidental behaviors.
+	ShuffleSeed int64
 }
 
 // New returns a new BTree
@@ -54,6 +91,39 @@ func NewBTreeG[T any](less func(a, b T) bool) *BTreeG[T] {
 	return NewBTreeGOptions(less, Options{})
 }
 
+// NewBTreeGOrdered returns a new BTreeG for an ordered type, such as an
+// integer or a string, which is ordered using the < operator.
+func NewBTreeGOrdered[T ordered]() *BTreeG[T] {
+	return NewBTreeGOptions(orderedLess[T], Options{})
+}
+
+// NewBTreeGOrderedOptions is like NewBTreeGOrdered, with options.
+func NewBTreeGOrderedOptions[T ordered](opts Options) *BTreeG[T] {
+	return NewBTreeGOptions(orderedLess[T], opts)
+}
+
+func orderedLess[T ordered](a, b T) bool {
+	return a < b
+}
+
+var emptyTrees sync.Map // (*T)(nil) -> *BTreeG[T]
+
+// Empty returns a shared read-only tree with no items, for APIs that return
+// an optional tree. A nil *BTreeG is also treated as an empty tree by the
+// read methods, such as Len, Get, Scan, Ascend, Min and Items.
+//
+// The tree has no less function, so copies of it may not be modified.
+func Empty[T any]() *BTreeG[T] {
+	if tr, ok := emptyTrees.Load((*T)(nil)); ok {
+		return tr.(*BTreeG[T])
+	}
+	tr := NewBTreeGOptions(func(a, b T) bool {
+		panic("empty tree has no less function")
+	}, Options{NoLocks: true, ReadOnly: true})
+	actual, _ := emptyTrees.LoadOrStore((*T)(nil), tr)
+	return actual.(*BTreeG[T])
+}
+
 func NewBTreeGOptions[T any](less func(a, b T) bool, opts Options) *BTreeG[T] {
 	tr := new(BTreeG[T])
 	tr.isoid = newIsoID()
@@ -62,18 +132,50 @@ func NewBTreeGOptions[T any](less func(a, b T) bool, opts Options) *BTreeG[T] {
 		tr.mu = new(sync.RWMutex)
 	}
 	tr.less = less
+	tr.maxItems = opts.MaxItems
 	tr.init(opts.Degree)
+	if opts.Tombstones {
+		tr.tombs = &BTreeG[T]{isoid: newIsoID(), less: less}
+		tr.tombs.init(opts.Degree)
+	}
+	if opts.ShuffleSeed != 0 {
+		tr.shuffle = &shuffler{rand: rand.New(rand.NewSource(opts.ShuffleSeed))}
+	}
 	if opts.ReadOnly {
 		tr.Freeze()
 	}
 	return tr
 }
 
+// shuffler is the source of randomness for Options.ShuffleSeed.
+type shuffler struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (s *shuffler) intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Intn(n)
+}
+
 // Freeze marks the tree as read-only.
 func (tr *BTreeG[T]) Freeze() {
 	tr.readOnly = true
 }
 
+// SetCloneValue sets a function that is called for every item that a
+// copy-on-write moves out of a node shared with other trees, such as after
+// Copy or IsoCopy. Use it when items hold pointers, so that the trees never
+// share the memory that the pointers refer to. It takes precedence over the
+// Copy and IsoCopy methods of the items. Pass nil to share items as is.
+func (tr *BTreeG[T]) SetCloneValue(clone func(item T) T) {
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	tr.clone = clone
+}
+
 func (tr *BTreeG[T]) init(degree int) {
 	if tr.min != 0 {
 		return
@@ -92,6 +194,8 @@ func (tr *BTreeG[T]) Less(a, b T) bool {
 }
 
 func (tr *BTreeG[T]) newNode(leaf bool) *node[T] {
+	tr.allocs.Allocs++
+	tr.allocs.Live++
 	n := &node[T]{isoid: tr.isoid}
 	if !leaf {
 		n.children = new([]*node[T])
@@ -120,6 +224,21 @@ func (tr *BTreeG[T]) bsearch(n *node[T], key T) (index int, found bool) {
 	return low, false
 }
 
+// lowerBound returns the index of the first item in the node that is not
+// less than key.
+func (tr *BTreeG[T]) lowerBound(n *node[T], key T) int {
+	low, high := 0, len(n.items)
+	for low < high {
+		h := int(uint(low+high) >> 1)
+		if tr.less(n.items[h], key) {
+			low = h + 1
+		} else {
+			high = h
+		}
+	}
+	return low
+}
+
 func (tr *BTreeG[T]) find(n *node[T], key T, hint *PathHint, depth int,
 ) (index int, found bool) {
 	if hint == nil {
@@ -208,17 +327,82 @@ func (tr *BTreeG[T]) SetHint(item T, hint *PathHint) (prev T, replaced bool) {
 	if tr.readOnly {
 		panic("read-only tree")
 	}
-	if tr.locks {
-		tr.mu.Lock()
-		prev, replaced = tr.setHint(item, hint)
-		tr.mu.Unlock()
-	} else {
-		prev, replaced = tr.setHint(item, hint)
+	locked := tr.lock(true)
+	if tr.full(item) {
+		if locked {
+			tr.unlock(true)
+		}
+		panic(ErrFull)
+	}
+	prev, replaced = tr.setHint(item, hint, false)
+	tr.untomb(item)
+	if locked {
+		tr.unlock(true)
 	}
 	return prev, replaced
 }
 
-func (tr *BTreeG[T]) setHint(item T, hint *PathHint) (prev T, replaced bool) {
+// TrySet sets or replaces the item, like Set, but returns ErrFull instead of
+// panicking when the item would be inserted into a tree that has reached
+// Options.MaxItems, and ErrReadOnly if the tree is read-only.
+func (tr *BTreeG[T]) TrySet(item T) (prev T, replaced bool, err error) {
+	if tr.readOnly {
+		return tr.empty, false, ErrReadOnly
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.full(item) {
+		return tr.empty, false, ErrFull
+	}
+	prev, replaced = tr.setHint(item, nil, false)
+	tr.untomb(item)
+	return prev, replaced, nil
+}
+
+// TryReplace replaces the item with the same key, and returns the previous
+// item. Returns ErrKeyNotFound if there is no such item, in which case the
+// tree is not changed, and ErrReadOnly if the tree is read-only.
+func (tr *BTreeG[T]) TryReplace(item T) (prev T, err error) {
+	if tr.readOnly {
+		return tr.empty, ErrReadOnly
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if _, ok := tr.get(item, nil, false); !ok {
+		return tr.empty, ErrKeyNotFound
+	}
+	prev, _ = tr.setHint(item, nil, false)
+	tr.untomb(item)
+	return prev, nil
+}
+
+// full reports whether inserting the item would exceed Options.MaxItems.
+// Items with a key that is already in the tree replace an existing item, and
+// are always allowed.
+func (tr *BTreeG[T]) full(item T) bool {
+	if tr.maxItems <= 0 || tr.count < tr.maxItems {
+		return false
+	}
+	n := tr.root
+	for n != nil {
+		i, found := tr.bsearch(n, item)
+		if found {
+			return false
+		}
+		if n.leaf() {
+			break
+		}
+		n = (*n.children)[i]
+	}
+	return true
+}
+
+// setHint inserts the item, or replaces the existing item for its key. When
+// keep is true an existing item is returned but not replaced.
+func (tr *BTreeG[T]) setHint(item T, hint *PathHint, keep bool,
+) (prev T, replaced bool) {
 	if tr.root == nil {
 		tr.init(0)
 		tr.root = tr.newNode(true)
@@ -227,16 +411,10 @@ func (tr *BTreeG[T]) setHint(item T, hint *PathHint) (prev T, replaced bool) {
 		tr.count = 1
 		return tr.empty, false
 	}
-	prev, replaced, split := tr.nodeSet(&tr.root, item, hint, 0)
+	prev, replaced, split := tr.nodeSet(&tr.root, item, hint, 0, keep)
 	if split {
-		left := tr.isoLoad(&tr.root, true)
-		right, median := tr.nodeSplit(left)
-		tr.root = tr.newNode(false)
-		*tr.root.children = make([]*node[T], 0, tr.max+1)
-		*tr.root.children = append([]*node[T]{}, left, right)
-		tr.root.items = append([]T{}, median)
-		tr.root.updateCount()
-		return tr.setHint(item, hint)
+		tr.splitRoot()
+		return tr.setHint(item, hint, keep)
 	}
 	if replaced {
 		return prev, true
@@ -245,108 +423,83 @@ func (tr *BTreeG[T]) setHint(item T, hint *PathHint) (prev T, replaced bool) {
 	return tr.empty, false
 }
 
-// Set or replace a value for a key
-func (tr *BTreeG[T]) Set(item T) (T, bool) {
-	return tr.SetHint(item, nil)
+// splitRoot splits a full root, growing the tree by one level.
+func (tr *BTreeG[T]) splitRoot() {
+	left := tr.isoLoad(&tr.root, true)
+	right, median := tr.nodeSplit(left)
+	tr.root = tr.newNode(false)
+	*tr.root.children = make([]*node[T], 0, tr.max+1)
+	*tr.root.children = append([]*node[T]{}, left, right)
+	tr.root.items = append([]T{}, median)
+	tr.root.updateCount()
 }
 
-func (tr *BTreeG[T]) nodeSplit(n *node[T]) (right *node[T], median T) {
-	i := tr.max / 2
-	median = n.items[i]
-
-	// right node
-	right = tr.newNode(n.leaf())
-	right.items = n.items[i+1:]
-	if !n.leaf() {
-		*right.children = (*n.children)[i+1:]
-	}
-	right.updateCount()
-
-	// left node
-	n.items[i] = tr.empty
-	n.items = n.items[:i:i]
-	if !n.leaf() {
-		*n.children = (*n.children)[: i+1 : i+1]
+// SetDup inserts the item, keeping any existing items that are equal to it.
+// Equal items are kept in insertion order, with the new item placed after
+// the others.
+//
+// Use DeleteOne and ScanDup to remove and iterate over equal items. Other
+// operations by key, such as Get, Set and Delete, act on one of the equal
+// items, which is not necessarily the first.
+//
+// Checksums are recorded by key, so SetDup panics when SetChecksum is
+// enabled.
+func (tr *BTreeG[T]) SetDup(item T) {
+	if tr.readOnly {
+		panic("read-only tree")
 	}
-	n.updateCount()
-
-	return right, median
-}
-
-func (n *node[T]) updateCount() {
-	n.count = len(n.items)
-	if !n.leaf() {
-		for i := 0; i < len(*n.children); i++ {
-			n.count += (*n.children)[i].count
-		}
+	if tr.lock(true) {
+		defer tr.unlock(true)
 	}
-}
-
-// Copy the node for safe isolation.
-func (tr *BTreeG[T]) copy(n *node[T]) *node[T] {
-	n2 := new(node[T])
-	n2.isoid = tr.isoid
-	n2.count = n.count
-	n2.items = make([]T, len(n.items), cap(n.items))
-	copy(n2.items, n.items)
-	if tr.copyItems {
-		for i := 0; i < len(n2.items); i++ {
-			n2.items[i] = ((interface{})(n2.items[i])).(copier[T]).Copy()
-		}
-	} else if tr.isoCopyItems {
-		for i := 0; i < len(n2.items); i++ {
-			n2.items[i] = ((interface{})(n2.items[i])).(isoCopier[T]).IsoCopy()
-		}
+	if tr.sum != nil {
+		panic("SetDup with checksums")
 	}
-	if !n.leaf() {
-		n2.children = new([]*node[T])
-		*n2.children = make([]*node[T], len(*n.children), tr.max+1)
-		copy(*n2.children, *n.children)
+	if tr.maxItems > 0 && tr.count >= tr.maxItems {
+		panic(ErrFull)
 	}
-	return n2
+	tr.setDup(item)
+	tr.untomb(item)
 }
 
-// isoLoad loads the provided node and, if needed, performs a copy-on-write.
-func (tr *BTreeG[T]) isoLoad(cn **node[T], mut bool) *node[T] {
-	if mut && (*cn).isoid != tr.isoid {
-		*cn = tr.copy(*cn)
+func (tr *BTreeG[T]) setDup(item T) {
+	if tr.root == nil {
+		tr.setHint(item, nil, false)
+		return
 	}
-	return *cn
+	if tr.nodeSetDup(&tr.root, item) {
+		tr.splitRoot()
+		tr.setDup(item)
+		return
+	}
+	tr.count++
 }
 
-func (tr *BTreeG[T]) nodeSet(cn **node[T], item T,
-	hint *PathHint, depth int,
-) (prev T, replaced bool, split bool) {
+// nodeSetDup inserts the item after all items that are equal to it.
+// Returns true if the node must be split first.
+func (tr *BTreeG[T]) nodeSetDup(cn **node[T], item T) (split bool) {
 	if (*cn).isoid != tr.isoid {
 		*cn = tr.copy(*cn)
+	} else if tr.agg != nil || tr.aug != nil {
+		(*cn).cache.Store(nil)
 	}
 	n := *cn
-	var i int
-	var found bool
-	if hint == nil {
-		i, found = tr.bsearch(n, item)
-	} else {
-		i, found = tr.hintsearch(n, item, hint, depth)
-	}
+	i, found := tr.bsearch(n, item)
 	if found {
-		prev = n.items[i]
-		n.items[i] = item
-		return prev, true, false
+		i++
 	}
 	if n.leaf() {
 		if len(n.items) == tr.max {
-			return tr.empty, false, true
+			return true
 		}
 		n.items = append(n.items, tr.empty)
 		copy(n.items[i+1:], n.items[i:])
 		n.items[i] = item
 		n.count++
-		return tr.empty, false, false
+		return false
 	}
-	prev, replaced, split = tr.nodeSet(&(*n.children)[i], item, hint, depth+1)
-	if split {
+	if tr.nodeSetDup(&(*n.children)[i], item) {
 		if len(n.items) == tr.max {
-			return tr.empty, false, true
+			return true
 		}
 		right, median := tr.nodeSplit((*n.children)[i])
 		*n.children = append(*n.children, nil)
@@ -355,83 +508,635 @@ func (tr *BTreeG[T]) nodeSet(cn **node[T], item T,
 		n.items = append(n.items, tr.empty)
 		copy(n.items[i+1:], n.items[i:])
 		n.items[i] = median
-		return tr.nodeSet(&n, item, hint, depth)
-	}
-	if !replaced {
-		n.count++
+		return tr.nodeSetDup(&n, item)
 	}
-	return prev, replaced, false
-}
-
-func (tr *BTreeG[T]) Scan(iter func(item T) bool) {
-	tr.scan(iter, false)
-}
-func (tr *BTreeG[T]) ScanMut(iter func(item T) bool) {
-	tr.scan(iter, true)
+	n.count++
+	return false
 }
 
-func (tr *BTreeG[T]) scan(iter func(item T) bool, mut bool) {
-	if tr.lock(mut) {
-		defer tr.unlock(mut)
+// DeleteOne deletes the first of the items that are equal to key, which is
+// the one that was inserted earliest using SetDup.
+func (tr *BTreeG[T]) DeleteOne(key T) (T, bool) {
+	if tr.readOnly {
+		panic("read-only tree")
 	}
-	if tr.root == nil {
-		return
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	index := tr.lowerRank(key)
+	item, ok := tr.at(index, false)
+	if !ok || tr.less(key, item) {
+		return tr.empty, false
+	}
+	prev := tr.nodeDeleteAt(&tr.root, index)
+	tr.tomb(prev)
+	if len(tr.root.items) == 0 && !tr.root.leaf() {
+		tr.root = (*tr.root.children)[0]
+		tr.freeNodes(1)
+	}
+	tr.count--
+	if tr.count == 0 {
+		tr.root = nil
+		tr.freeNodes(1)
 	}
-	tr.nodeScan(&tr.root, iter, mut)
+	return prev, true
 }
 
-func (tr *BTreeG[T]) nodeScan(cn **node[T], iter func(item T) bool, mut bool,
-) bool {
-	n := tr.isoLoad(cn, mut)
+// nodeDeleteAt deletes the item at index of the subtree. Unlike delete, it
+// finds the item by position, which picks the right one of equal items.
+func (tr *BTreeG[T]) nodeDeleteAt(cn **node[T], index int) T {
+	n := tr.isoLoad(cn, true)
 	if n.leaf() {
-		for i := 0; i < len(n.items); i++ {
-			if !iter(n.items[i]) {
-				return false
-			}
-		}
-		return true
+		prev := n.items[index]
+		copy(n.items[index:], n.items[index+1:])
+		n.items[len(n.items)-1] = tr.empty
+		n.items = n.items[:len(n.items)-1]
+		n.count--
+		return prev
 	}
-	for i := 0; i < len(n.items); i++ {
-		if !tr.nodeScan(&(*n.children)[i], iter, mut) {
-			return false
-		}
-		if !iter(n.items[i]) {
-			return false
+	var prev T
+	i := 0
+	for ; i < len(n.items); i++ {
+		if index <= (*n.children)[i].count {
+			break
 		}
+		index -= (*n.children)[i].count + 1
 	}
-	return tr.nodeScan(&(*n.children)[len(*n.children)-1], iter, mut)
+	if i < len(n.items) && index == (*n.children)[i].count {
+		prev = n.items[i]
+		maxItem, _ := tr.delete(&(*n.children)[i], true, tr.empty, nil, 0)
+		n.items[i] = maxItem
+	} else {
+		prev = tr.nodeDeleteAt(&(*n.children)[i], index)
+	}
+	n.count--
+	if len((*n.children)[i].items) < tr.min {
+		tr.nodeRebalance(n, i)
+	}
+	return prev
 }
 
-// Get a value for key
-func (tr *BTreeG[T]) Get(key T) (T, bool) {
-	return tr.getHint(key, nil, false)
+// ScanDup iterates over all items that are equal to key, in insertion order.
+func (tr *BTreeG[T]) ScanDup(key T, iter func(item T) bool) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	index := tr.lowerRank(key)
+	if index >= tr.count {
+		return
+	}
+	tr.nodeAscendAt(tr.root, index, func(item T) bool {
+		return !tr.less(key, item) && iter(item)
+	})
 }
 
-func (tr *BTreeG[T]) GetMut(key T) (T, bool) {
-	return tr.getHint(key, nil, true)
+// lowerRank returns the number of items that are less than key. Unlike rank,
+// it counts none of the items that are equal to key.
+func (tr *BTreeG[T]) lowerRank(key T) int {
+	var rank int
+	n := tr.root
+	for n != nil {
+		i := tr.lowerBound(n, key)
+		rank += i
+		if n.leaf() {
+			break
+		}
+		for j := 0; j < i; j++ {
+			rank += (*n.children)[j].count
+		}
+		n = (*n.children)[i]
+	}
+	return rank
 }
 
-// GetHint gets a value for key using a path hint
-func (tr *BTreeG[T]) GetHint(key T, hint *PathHint) (value T, ok bool) {
-	return tr.getHint(key, hint, false)
+// Set or replace a value for a key
+func (tr *BTreeG[T]) Set(item T) (T, bool) {
+	return tr.SetHint(item, nil)
 }
-func (tr *BTreeG[T]) GetHintMut(key T, hint *PathHint) (value T, ok bool) {
-	return tr.getHint(key, hint, true)
+
+// GetOrInsert returns the existing item for the key, or inserts the item if
+// the key was not found. Loaded is true if the item already existed.
+// The lookup and insert happen under a single lock and tree descent.
+func (tr *BTreeG[T]) GetOrInsert(item T) (actual T, loaded bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.full(item) {
+		panic(ErrFull)
+	}
+	prev, loaded := tr.setHint(item, nil, true)
+	if loaded {
+		return prev, true
+	}
+	tr.untomb(item)
+	return item, false
 }
 
-// GetHint gets a value for key using a path hint
-func (tr *BTreeG[T]) getHint(key T, hint *PathHint, mut bool) (T, bool) {
-	if tr.lock(mut) {
-		defer tr.unlock(mut)
+// SetMany sets or replaces all items while holding the lock once. The items
+// are applied in sorted order using a shared path hint, which gives better
+// locality than setting them one at a time. When items share a key, the
+// last one in the slice wins. The slice is not modified.
+// Returns the number of items that were inserted rather than replaced.
+func (tr *BTreeG[T]) SetMany(items []T) int {
+	if tr.readOnly {
+		panic("read-only tree")
 	}
-	if tr.root == nil {
-		return tr.empty, false
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	var inserted int
+	var hint PathHint
+	for _, item := range tr.sorted(items) {
+		if tr.full(item) {
+			panic(ErrFull)
+		}
+		if _, replaced := tr.setHint(item, &hint, false); !replaced {
+			inserted++
+		}
+		tr.untomb(item)
+	}
+	return inserted
+}
+
+// DeleteMany deletes the items for all keys while holding the lock once.
+// The keys are deleted in sorted order. The slice is not modified.
+// Returns the number of items that were deleted.
+func (tr *BTreeG[T]) DeleteMany(keys []T) int {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	var deleted int
+	var hint PathHint
+	for _, key := range tr.sorted(keys) {
+		if _, ok := tr.deleteHint(key, &hint); ok {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// DeleteFunc deletes all items for which match returns true, in a single
+// traversal while holding the lock once. When any items are deleted the tree
+// is rebuilt from the remaining items, which is O(n).
+// Returns the number of items that were deleted.
+func (tr *BTreeG[T]) DeleteFunc(match func(item T) bool) int {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root == nil {
+		return 0
+	}
+	var deleted int
+	items := tr.appendNodeItems(make([]T, 0, tr.count), tr.root,
+		func(item T) bool {
+			if match(item) {
+				tr.tomb(item)
+				deleted++
+				return false
+			}
+			return true
+		})
+	if deleted == 0 {
+		return 0
+	}
+	tr.freeNodes(tr.allocs.Live)
+	tr.count = len(items)
+	if len(items) == 0 {
+		tr.root = nil
+	} else {
+		tr.root = tr.buildNode(items, tr.childCap(len(items)))
+	}
+	return deleted
+}
+
+// Retain deletes all items for which match returns false, keeping only the
+// matching items. It's the inverse of DeleteFunc.
+// Returns the number of items that were deleted.
+func (tr *BTreeG[T]) Retain(match func(item T) bool) int {
+	return tr.DeleteFunc(func(item T) bool { return !match(item) })
+}
+
+// sorted returns a sorted copy of the items, keeping items that share a key
+// in their original order.
+func (tr *BTreeG[T]) sorted(items []T) []T {
+	items = append([]T(nil), items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return tr.less(items[i], items[j])
+	})
+	return items
+}
+
+// SetNX inserts the item only if its key was not found.
+// Returns true if the item was inserted.
+func (tr *BTreeG[T]) SetNX(item T) bool {
+	_, loaded := tr.GetOrInsert(item)
+	return !loaded
+}
+
+// Replace the existing item for the key, but never insert.
+// Returns the replaced item or false if the key was not found.
+func (tr *BTreeG[T]) Replace(item T) (T, bool) {
+	return tr.replaceIf(item, nil)
+}
+
+// SetIf replaces the existing item for the key only when cond returns true
+// for it, such as when its version matches an expected version. The check
+// and the replace happen atomically under the tree lock. Never inserts.
+// Returns the replaced item or false if the key was not found or cond
+// returned false.
+func (tr *BTreeG[T]) SetIf(item T, cond func(prev T) bool) (T, bool) {
+	return tr.replaceIf(item, cond)
+}
+
+// replaceIf replaces the existing item for the key when cond, if provided,
+// returns true for it.
+func (tr *BTreeG[T]) replaceIf(item T, cond func(prev T) bool) (T, bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root == nil {
+		return tr.empty, false
+	}
+	n := tr.isoLoad(&tr.root, true)
+	for {
+		i, found := tr.bsearch(n, item)
+		if found {
+			prev := n.items[i]
+			if cond != nil && !cond(prev) {
+				return tr.empty, false
+			}
+			n.items[i] = item
+			tr.checkSet(item)
+			return prev, true
+		}
+		if n.leaf() {
+			return tr.empty, false
+		}
+		n = tr.isoLoad(&(*n.children)[i], true)
+	}
+}
+
+func (tr *BTreeG[T]) nodeSplit(n *node[T]) (right *node[T], median T) {
+	i := tr.max / 2
+	median = n.items[i]
+
+	// right node
+	right = tr.newNode(n.leaf())
+	right.items = n.items[i+1:]
+	if !n.leaf() {
+		*right.children = (*n.children)[i+1:]
+	}
+	right.updateCount()
+
+	// left node
+	n.items[i] = tr.empty
+	n.items = n.items[:i:i]
+	if !n.leaf() {
+		*n.children = (*n.children)[: i+1 : i+1]
+	}
+	n.updateCount()
+
+	return right, median
+}
+
+func (n *node[T]) updateCount() {
+	n.count = len(n.items)
+	if !n.leaf() {
+		for i := 0; i < len(*n.children); i++ {
+			n.count += (*n.children)[i].count
+		}
+	}
+}
+
+// Copy the node for safe isolation.
+func (tr *BTreeG[T]) copy(n *node[T]) *node[T] {
+	// the copy replaces the original node in this tree
+	tr.allocs.Allocs++
+	tr.allocs.Frees++
+	n2 := new(node[T])
+	n2.isoid = tr.isoid
+	n2.count = n.count
+	n2.items = make([]T, len(n.items), cap(n.items))
+	copy(n2.items, n.items)
+	if tr.clone != nil || tr.copyItems || tr.isoCopyItems {
+		for i := 0; i < len(n2.items); i++ {
+			n2.items[i] = tr.copyItem(n2.items[i])
+		}
+	}
+	if !n.leaf() {
+		n2.children = new([]*node[T])
+		*n2.children = make([]*node[T], len(*n.children), tr.max+1)
+		copy(*n2.children, *n.children)
+	}
+	return n2
+}
+
+// copyItem returns a copy of an item that is moving out of a node that is
+// shared with other trees.
+func (tr *BTreeG[T]) copyItem(item T) T {
+	if tr.clone != nil {
+		return tr.clone(item)
+	} else if tr.copyItems {
+		return ((interface{})(item)).(copier[T]).Copy()
+	} else if tr.isoCopyItems {
+		return ((interface{})(item)).(isoCopier[T]).IsoCopy()
+	}
+	return item
+}
+
+// isoLoad loads the provided node and, if needed, performs a copy-on-write.
+func (tr *BTreeG[T]) isoLoad(cn **node[T], mut bool) *node[T] {
+	if mut && (*cn).isoid != tr.isoid {
+		*cn = tr.copy(*cn)
+	} else if mut && (tr.agg != nil || tr.aug != nil) {
+		(*cn).cache.Store(nil)
+	}
+	return *cn
+}
+
+func (tr *BTreeG[T]) nodeSet(cn **node[T], item T,
+	hint *PathHint, depth int, keep bool,
+) (prev T, replaced bool, split bool) {
+	if (*cn).isoid != tr.isoid {
+		*cn = tr.copy(*cn)
+	} else if tr.agg != nil || tr.aug != nil {
+		(*cn).cache.Store(nil)
+	}
+	n := *cn
+	var i int
+	var found bool
+	if hint == nil {
+		i, found = tr.bsearch(n, item)
+	} else {
+		i, found = tr.hintsearch(n, item, hint, depth)
+	}
+	if found {
+		prev = n.items[i]
+		if !keep {
+			n.items[i] = item
+		}
+		return prev, true, false
+	}
+	if n.leaf() {
+		if len(n.items) == tr.max {
+			return tr.empty, false, true
+		}
+		n.items = append(n.items, tr.empty)
+		copy(n.items[i+1:], n.items[i:])
+		n.items[i] = item
+		n.count++
+		return tr.empty, false, false
+	}
+	prev, replaced, split = tr.nodeSet(&(*n.children)[i], item, hint,
+		depth+1, keep)
+	if split {
+		if len(n.items) == tr.max {
+			return tr.empty, false, true
+		}
+		right, median := tr.nodeSplit((*n.children)[i])
+		*n.children = append(*n.children, nil)
+		copy((*n.children)[i+1:], (*n.children)[i:])
+		(*n.children)[i+1] = right
+		n.items = append(n.items, tr.empty)
+		copy(n.items[i+1:], n.items[i:])
+		n.items[i] = median
+		return tr.nodeSet(&n, item, hint, depth, keep)
+	}
+	if !replaced {
+		n.count++
+	}
+	return prev, replaced, false
+}
+
+func (tr *BTreeG[T]) Scan(iter func(item T) bool) {
+	tr.scan(iter, false)
+}
+func (tr *BTreeG[T]) ScanMut(iter func(item T) bool) {
+	tr.scan(iter, true)
+}
+
+func (tr *BTreeG[T]) scan(iter func(item T) bool, mut bool) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(mut) {
+		defer tr.unlock(mut)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeScan(&tr.root, tr.checkIter(iter, mut), mut)
+}
+
+// ScanPairs iterates over every pair of adjacent items in ascending order,
+// passing each item along with the item before it. Nothing is called for
+// trees with fewer than two items.
+func (tr *BTreeG[T]) ScanPairs(iter func(prev, cur T) bool) {
+	var prev T
+	var started bool
+	tr.Scan(func(item T) bool {
+		if !started {
+			prev, started = item, true
+			return true
+		}
+		if !iter(prev, item) {
+			return false
+		}
+		prev = item
+		return true
+	})
+}
+
+// ScanWindow iterates over the tree in ascending order, passing each item
+// along with the n-1 items before it, oldest first. Iteration starts at the
+// n-th item. The window is reused and is only valid until iter returns.
+func (tr *BTreeG[T]) ScanWindow(n int, iter func(window []T) bool) {
+	if n < 1 {
+		return
+	}
+	buf := make([]T, 0, 2*n)
+	tr.Scan(func(item T) bool {
+		if len(buf) == cap(buf) {
+			buf = buf[:copy(buf, buf[len(buf)-n+1:])]
+		}
+		buf = append(buf, item)
+		if len(buf) < n {
+			return true
+		}
+		return iter(buf[len(buf)-n:])
+	})
+}
+
+func (tr *BTreeG[T]) nodeScan(cn **node[T], iter func(item T) bool, mut bool,
+) bool {
+	n := tr.isoLoad(cn, mut)
+	if n.leaf() {
+		for i := 0; i < len(n.items); i++ {
+			if !iter(n.items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 0; i < len(n.items); i++ {
+		if !tr.nodeScan(&(*n.children)[i], iter, mut) {
+			return false
+		}
+		if !iter(n.items[i]) {
+			return false
+		}
+	}
+	return tr.nodeScan(&(*n.children)[len(*n.children)-1], iter, mut)
+}
+
+// Get a value for key
+func (tr *BTreeG[T]) Get(key T) (T, bool) {
+	return tr.getHint(key, nil, false)
+}
+
+func (tr *BTreeG[T]) GetMut(key T) (T, bool) {
+	return tr.getHint(key, nil, true)
+}
+
+// GetLE returns the greatest item that is less than or equal to key.
+// Returns false if there is no such item.
+func (tr *BTreeG[T]) GetLE(key T) (T, bool) {
+	return tr.nearest(key, true, true)
+}
+
+// GetGE returns the smallest item that is greater than or equal to key.
+// Returns false if there is no such item.
+func (tr *BTreeG[T]) GetGE(key T) (T, bool) {
+	return tr.nearest(key, false, true)
+}
+
+// Prev returns the greatest item that is less than key, whether or not key
+// itself is in the tree.
+// Returns false if there is no such item.
+func (tr *BTreeG[T]) Prev(key T) (T, bool) {
+	return tr.nearest(key, true, false)
+}
+
+// Next returns the smallest item that is greater than key, whether or not
+// key itself is in the tree.
+// Returns false if there is no such item.
+func (tr *BTreeG[T]) Next(key T) (T, bool) {
+	return tr.nearest(key, false, false)
+}
+
+// nearest returns the closest item before or after key, which may be the
+// item for key itself when inclusive.
+func (tr *BTreeG[T]) nearest(key T, before, inclusive bool) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root == nil {
+		return tr.empty, false
+	}
+	item, ok := tr.empty, false
+	n := tr.isoLoad(&tr.root, false)
+	for {
+		i, found := tr.bsearch(n, key)
+		if found && inclusive {
+			return n.items[i], true
+		}
+		if before {
+			if i > 0 {
+				item, ok = n.items[i-1], true
+			}
+		} else {
+			if found {
+				i++
+			}
+			if i < len(n.items) {
+				item, ok = n.items[i], true
+			}
+		}
+		if n.leaf() {
+			return item, ok
+		}
+		n = tr.isoLoad(&(*n.children)[i], false)
+	}
+}
+
+// GetHint gets a value for key using a path hint
+func (tr *BTreeG[T]) GetHint(key T, hint *PathHint) (value T, ok bool) {
+	return tr.getHint(key, hint, false)
+}
+func (tr *BTreeG[T]) GetHintMut(key T, hint *PathHint) (value T, ok bool) {
+	return tr.getHint(key, hint, true)
+}
+
+// GetHint gets a value for key using a path hint
+func (tr *BTreeG[T]) getHint(key T, hint *PathHint, mut bool) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
+	if tr.lock(mut) {
+		defer tr.unlock(mut)
+	}
+	return tr.get(key, hint, mut)
+}
+
+// GetVersioned gets a value for key, along with the generation of the tree
+// that it was read from. See Generation.
+func (tr *BTreeG[T]) GetVersioned(key T) (item T, gen uint64, ok bool) {
+	if tr == nil {
+		return item, 0, false
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	item, ok = tr.get(key, nil, false)
+	return item, tr.gen, ok
+}
+
+// Generation returns the generation of the tree, which changes after every
+// operation that may have modified the tree. Data derived from items that
+// were read at a generation is still valid when the generation is unchanged.
+// The generation may also change when the tree has not been modified, such
+// as after a Copy or a Mut read.
+func (tr *BTreeG[T]) Generation() uint64 {
+	if tr == nil {
+		return 0
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	return tr.gen
+}
+
+// get gets a value for key. The tree must be locked.
+func (tr *BTreeG[T]) get(key T, hint *PathHint, mut bool) (T, bool) {
+	if tr.root == nil {
+		return tr.empty, false
 	}
 	n := tr.isoLoad(&tr.root, mut)
 	depth := 0
 	for {
 		i, found := tr.find(n, key, hint, depth)
 		if found {
+			tr.checkRead(n.items[i], mut)
 			return n.items[i], true
 		}
 		if n.children == nil {
@@ -513,6 +1218,9 @@ restart:
 					break
 				}
 			}
+			for k := 0; k < j; k++ {
+				tr.tomb(n.items[i+k])
+			}
 			copy(n.items[i:], n.items[i+j:])
 			for k := len(n.items) - j; k < len(n.items); k++ {
 				n.items[k] = tr.empty
@@ -534,6 +1242,7 @@ restart:
 			switch act {
 			case Delete:
 				if len(n.items) > tr.min {
+					tr.tomb(n.items[i])
 					copy(n.items[i:], n.items[i+1:])
 					n.items[len(n.items)-1] = tr.empty
 					n.items = n.items[:len(n.items)-1]
@@ -714,6 +1423,223 @@ func (tr *BTreeG[T]) DeleteRange(min, max T, opts *DeleteRangeOptions) (deleted
 	return tr.DeleteRangeReuse(min, max, opts, &deleted)
 }
 
+// ExtractRange removes all items within the range [lo, hi) and returns them
+// as a new tree with the same options. Like DeleteRange, subtrees that are
+// entirely within the range are detached without being traversed, and the
+// new tree is built bottom-up, making the cost O(log n) plus the number of
+// extracted items.
+func (tr *BTreeG[T]) ExtractRange(lo, hi T) *BTreeG[T] {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	deleted := tr.DeleteRange(lo, hi, nil)
+	items := make([]T, 0, deleted.Len())
+	deleted.Scan(func(item T) bool {
+		items = append(items, item)
+		return true
+	})
+	tr2 := tr.emptyCopy()
+	if len(items) > 0 {
+		tr2.root = tr2.buildNode(items, tr2.childCap(len(items)))
+		tr2.count = len(items)
+	}
+	return tr2
+}
+
+// Split returns two trees, one with the items that are less than key, and
+// the other with the items that are greater than or equal to key. The tree
+// itself is left unchanged.
+//
+// Both trees start as copy-on-write copies of the tree, from which the items
+// of the other side are deleted using DeleteRange. Subtrees that are entirely
+// on the other side are detached without being traversed, unless checksums
+// are enabled, and no items are copied.
+func (tr *BTreeG[T]) Split(key T) (left, right *BTreeG[T]) {
+	// both sides come from one copy, so that concurrent writes to the tree
+	// can't make them disagree
+	left = tr.Copy()
+	right = left.Copy()
+	min, ok := left.Min()
+	if !ok {
+		return left, right
+	}
+	max, _ := left.Max()
+	opts := DeleteRangeOptions{NoReturn: true, MaxInclusive: true}
+	left.splitDelete(key, max, &opts)
+	opts.MaxInclusive = false
+	right.splitDelete(min, key, &opts)
+	return left, right
+}
+
+// Join appends all items of other to the tree. The items of other must all
+// be greater than the items of the tree. Panics if they are not, or with
+// ErrFull if the tree would exceed Options.MaxItems.
+//
+// The nodes of other are attached to the tree as a whole using copy-on-write,
+// which only touches the nodes along one edge of each tree, making the cost
+// O(log n) rather than the number of items. The other tree is left unchanged.
+func (tr *BTreeG[T]) Join(other *BTreeG[T]) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	snap := other.Copy()
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if snap == nil || snap.root == nil {
+		return
+	}
+	if tr.maxItems > 0 && tr.count+snap.count > tr.maxItems {
+		panic(ErrFull)
+	}
+	if tr.root != nil {
+		last := tr.root
+		for !last.leaf() {
+			last = (*last.children)[len(*last.children)-1]
+		}
+		first := snap.root
+		for !first.leaf() {
+			first = (*first.children)[0]
+		}
+		if !tr.less(last.items[len(last.items)-1], first.items[0]) {
+			panic("items out of order")
+		}
+	}
+	if tr.tombs != nil || tr.sum != nil {
+		snap.Scan(func(item T) bool {
+			tr.untomb(item)
+			return true
+		})
+	}
+	if tr.root == nil {
+		tr.root = snap.root
+		tr.count = snap.count
+		tr.allocs.Live += snap.allocs.Live
+		return
+	}
+	// The smallest item of other separates the two trees.
+	sep, _ := snap.PopMin()
+	tr.allocs.Live += snap.allocs.Live
+	if snap.root == nil {
+		tr.setHint(sep, nil, false)
+		return
+	}
+	tr.root = tr.join(tr.root, sep, snap.root)
+	tr.count += snap.count + 1
+}
+
+// join returns the root of a tree holding the items of the left subtree, the
+// separator, and the items of the right subtree. The shorter subtree is
+// attached to the edge of the taller one at its own height, and the nodes
+// along that edge are rebalanced and split as needed.
+func (tr *BTreeG[T]) join(left *node[T], sep T, right *node[T]) *node[T] {
+	hl, hr := nodeHeight(left), nodeHeight(right)
+	if hl == hr {
+		root := tr.newNode(false)
+		root.items = append(root.items, sep)
+		*root.children = append(*root.children, left, right)
+		for len(root.items) > 0 && len((*root.children)[0].items) < tr.min {
+			tr.nodeRebalance(root, 0)
+		}
+		for len(root.items) > 0 &&
+			len((*root.children)[len(root.items)].items) < tr.min {
+			tr.nodeRebalance(root, len(root.items))
+		}
+		root.updateCount()
+		if len(root.items) == 0 {
+			root = (*root.children)[0]
+			tr.freeNodes(1)
+		}
+		return root
+	}
+	// Walk down the facing edge of the taller subtree to the node whose
+	// children have the height of the shorter subtree.
+	tall, short, h, hs := &left, right, hl, hr
+	if hl < hr {
+		tall, short, h, hs = &right, left, hr, hl
+	}
+	var path []*node[T]
+	cn := tall
+	for {
+		n := tr.isoLoad(cn, true)
+		n.count += short.count + 1
+		path = append(path, n)
+		if h--; h == hs {
+			break
+		}
+		if hl > hr {
+			cn = &(*n.children)[len(*n.children)-1]
+		} else {
+			cn = &(*n.children)[0]
+		}
+	}
+	n := path[len(path)-1]
+	if hl > hr {
+		n.items = append(n.items, sep)
+		*n.children = append(*n.children, short)
+		for len((*n.children)[len(n.items)].items) < tr.min {
+			tr.nodeRebalance(n, len(n.items))
+		}
+	} else {
+		n.items = append(n.items, tr.empty)
+		copy(n.items[1:], n.items)
+		n.items[0] = sep
+		*n.children = append(*n.children, nil)
+		copy((*n.children)[1:], *n.children)
+		(*n.children)[0] = short
+		for len((*n.children)[0].items) < tr.min {
+			tr.nodeRebalance(n, 0)
+		}
+	}
+	// Split the nodes that overflowed, from the bottom up.
+	for k := len(path) - 1; k >= 0; k-- {
+		n := path[k]
+		if len(n.items) <= tr.max {
+			break
+		}
+		right, median := tr.nodeSplit(n)
+		if k == 0 {
+			root := tr.newNode(false)
+			root.items = append(root.items, median)
+			*root.children = append(*root.children, n, right)
+			root.updateCount()
+			return root
+		}
+		parent := path[k-1]
+		if hl > hr {
+			parent.items = append(parent.items, median)
+			*parent.children = append(*parent.children, right)
+		} else {
+			parent.items = append(parent.items, tr.empty)
+			copy(parent.items[1:], parent.items)
+			parent.items[0] = median
+			*parent.children = append(*parent.children, nil)
+			copy((*parent.children)[2:], (*parent.children)[1:])
+			(*parent.children)[1] = right
+		}
+	}
+	return path[0]
+}
+
+// nodeHeight returns the number of levels in the subtree.
+func nodeHeight[T any](n *node[T]) int {
+	height := 1
+	for !n.leaf() {
+		n = (*n.children)[0]
+		height++
+	}
+	return height
+}
+
+// splitDelete deletes a range of items without recording them as tombstones,
+// because they were moved to another tree rather than deleted.
+func (tr *BTreeG[T]) splitDelete(min, max T, opts *DeleteRangeOptions) {
+	tombs := tr.tombs
+	tr.tombs = nil
+	tr.DeleteRange(min, max, opts)
+	tr.tombs = tombs
+}
+
 // DeleteRangeReuse is the same as DeleteRange, but it takes a List as an argument to
 // avoid allocating/growing a new List on each call to DeleteRange. It is unsafe to use
 // the same List across concurrent calls to DeleteRange.
@@ -770,9 +1696,18 @@ restart:
 				n.items[len(n.items)-1] = tr.empty
 				n.items = n.items[:len(n.items)-1]
 				dnode := (*n.children)[i+1]
+				if tr.tombs != nil || tr.sum != nil {
+					// record the tombstones and forget the checksums
+					tr.tomb(ditem)
+					extractNodeScan(dnode, func(item T) bool {
+						tr.tomb(item)
+						return true
+					})
+				}
 				copy((*n.children)[i+1:], (*n.children)[i+2:])
 				(*n.children)[len(*n.children)-1] = nil
 				*n.children = (*n.children)[:len(*n.children)-1]
+				tr.freeNodes(tr.estimateNodes(dnode))
 				for k := 0; k < len(stack); k++ {
 					stack[k].node.count -= dnode.count + 1
 				}
@@ -817,6 +1752,9 @@ restart:
 					deleted.append(n.items[i+j], nil)
 				}
 			}
+			for k := 0; k < j; k++ {
+				tr.tomb(n.items[i+k])
+			}
 			copy(n.items[i:], n.items[i+j:])
 			for k := len(n.items) - j; k < len(n.items); k++ {
 				n.items[k] = tr.empty
@@ -839,6 +1777,7 @@ restart:
 				if extract {
 					deleted.append(n.items[i], nil)
 				}
+				tr.tomb(n.items[i])
 				copy(n.items[i:], n.items[i+1:])
 				n.items[len(n.items)-1] = tr.empty
 				n.items = n.items[:len(n.items)-1]
@@ -876,6 +1815,9 @@ restart:
 
 // Len returns the number of items in the tree
 func (tr *BTreeG[T]) Len() int {
+	if tr == nil {
+		return 0
+	}
 	return tr.count
 }
 
@@ -895,7 +1837,39 @@ func (tr *BTreeG[T]) DeleteHint(key T, hint *PathHint) (T, bool) {
 	if tr.lock(true) {
 		defer tr.unlock(true)
 	}
-	return tr.deleteHint(key, hint)
+	return tr.deleteHint(key, hint)
+}
+
+// DeleteIf deletes the item for the key only when cond returns true for it,
+// such as when it belongs to an expected generation. The check and the
+// delete happen atomically under the tree lock.
+// Returns the deleted item or false if the key was not found or cond
+// returned false.
+func (tr *BTreeG[T]) DeleteIf(key T, cond func(prev T) bool) (T, bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root == nil {
+		return tr.empty, false
+	}
+	n := tr.root
+	for {
+		i, found := tr.bsearch(n, key)
+		if found {
+			if !cond(n.items[i]) {
+				return tr.empty, false
+			}
+			break
+		}
+		if n.leaf() {
+			return tr.empty, false
+		}
+		n = (*n.children)[i]
+	}
+	return tr.deleteHint(key, nil)
 }
 
 func (tr *BTreeG[T]) deleteHint(key T, hint *PathHint) (T, bool) {
@@ -906,12 +1880,15 @@ func (tr *BTreeG[T]) deleteHint(key T, hint *PathHint) (T, bool) {
 	if !deleted {
 		return tr.empty, false
 	}
+	tr.tomb(prev)
 	if len(tr.root.items) == 0 && !tr.root.leaf() {
 		tr.root = (*tr.root.children)[0]
+		tr.freeNodes(1)
 	}
 	tr.count--
 	if tr.count == 0 {
 		tr.root = nil
+		tr.freeNodes(1)
 	}
 	return prev, true
 }
@@ -1000,6 +1977,7 @@ func (tr *BTreeG[T]) nodeRebalance(n *node[T], i int) {
 		copy((*n.children)[i+1:], (*n.children)[i+2:])
 		(*n.children)[len(*n.children)-1] = nil
 		(*n.children) = (*n.children)[:len(*n.children)-1]
+		tr.freeNodes(1)
 	} else if len(left.items) > len(right.items) {
 		// move left -> right over one slot
 
@@ -1048,139 +2026,781 @@ func (tr *BTreeG[T]) nodeRebalance(n *node[T], i int) {
 	}
 }
 
-// Ascend the tree within the range [pivot, last]
-// Pass nil for pivot to scan all item in ascending order
+// Ascend the tree within the range [pivot, last]
+// Pass nil for pivot to scan all item in ascending order
+// Return false to stop iterating
+func (tr *BTreeG[T]) Ascend(pivot T, iter func(item T) bool) {
+	tr.ascend(pivot, iter, false, nil)
+}
+func (tr *BTreeG[T]) AscendMut(pivot T, iter func(item T) bool) {
+	tr.ascend(pivot, iter, true, nil)
+}
+func (tr *BTreeG[T]) ascend(pivot T, iter func(item T) bool, mut bool,
+	hint *PathHint,
+) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(mut) {
+		defer tr.unlock(mut)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeAscend(&tr.root, pivot, hint, 0, tr.checkIter(iter, mut), mut)
+}
+func (tr *BTreeG[T]) AscendHint(pivot T, iter func(item T) bool, hint *PathHint,
+) {
+	tr.ascend(pivot, iter, false, hint)
+}
+func (tr *BTreeG[T]) AscendHintMut(pivot T, iter func(item T) bool,
+	hint *PathHint,
+) {
+	tr.ascend(pivot, iter, true, hint)
+}
+
+// The return value of this function determines whether we should keep iterating
+// upon this functions return.
+func (tr *BTreeG[T]) nodeAscend(cn **node[T], pivot T, hint *PathHint,
+	depth int, iter func(item T) bool, mut bool,
+) bool {
+	n := tr.isoLoad(cn, mut)
+	i, found := tr.find(n, pivot, hint, depth)
+	if !found {
+		if !n.leaf() {
+			if !tr.nodeAscend(&(*n.children)[i], pivot, hint, depth+1, iter,
+				mut) {
+				return false
+			}
+		}
+	}
+	// We are either in the case that
+	// - node is found, we should iterate through it starting at `i`,
+	//   the index it was located at.
+	// - node is not found, and TODO: fill in.
+	for ; i < len(n.items); i++ {
+		if !iter(n.items[i]) {
+			return false
+		}
+		if !n.leaf() {
+			if !tr.nodeScan(&(*n.children)[i+1], iter, mut) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (tr *BTreeG[T]) Reverse(iter func(item T) bool) {
+	tr.reverse(iter, false)
+}
+func (tr *BTreeG[T]) ReverseMut(iter func(item T) bool) {
+	tr.reverse(iter, true)
+}
+func (tr *BTreeG[T]) reverse(iter func(item T) bool, mut bool) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(mut) {
+		defer tr.unlock(mut)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeReverse(&tr.root, tr.checkIter(iter, mut), mut)
+}
+
+func (tr *BTreeG[T]) nodeReverse(cn **node[T], iter func(item T) bool, mut bool,
+) bool {
+	n := tr.isoLoad(cn, mut)
+	if n.leaf() {
+		for i := len(n.items) - 1; i >= 0; i-- {
+			if !iter(n.items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if !tr.nodeReverse(&(*n.children)[len(*n.children)-1], iter, mut) {
+		return false
+	}
+	for i := len(n.items) - 1; i >= 0; i-- {
+		if !iter(n.items[i]) {
+			return false
+		}
+		if !tr.nodeReverse(&(*n.children)[i], iter, mut) {
+			return false
+		}
+	}
+	return true
+}
+
+// Descend the tree within the range [pivot, first]
+// Pass nil for pivot to scan all item in descending order
+// Return false to stop iterating
+func (tr *BTreeG[T]) Descend(pivot T, iter func(item T) bool) {
+	tr.descend(pivot, iter, false, nil)
+}
+func (tr *BTreeG[T]) DescendMut(pivot T, iter func(item T) bool) {
+	tr.descend(pivot, iter, true, nil)
+}
+func (tr *BTreeG[T]) descend(pivot T, iter func(item T) bool, mut bool,
+	hint *PathHint,
+) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(mut) {
+		defer tr.unlock(mut)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeDescend(&tr.root, pivot, hint, 0, tr.checkIter(iter, mut), mut)
+}
+
+func (tr *BTreeG[T]) DescendHint(pivot T, iter func(item T) bool,
+	hint *PathHint,
+) {
+	tr.descend(pivot, iter, false, hint)
+}
+func (tr *BTreeG[T]) DescendHintMut(pivot T, iter func(item T) bool,
+	hint *PathHint,
+) {
+	tr.descend(pivot, iter, true, hint)
+}
+
+// AscendFilter ascends the tree within the range [pivot, last], calling iter
+// only for the items for which keep returns true. The filter is applied
+// inside the traversal, and iteration stops when iter returns false.
+func (tr *BTreeG[T]) AscendFilter(pivot T, keep func(item T) bool,
+	iter func(item T) bool,
+) {
+	tr.ascendFilter(&pivot, nil, keep, iter)
+}
+
+func (tr *BTreeG[T]) ascendFilter(pivot *T, skip func(meta any) bool,
+	keep func(item T) bool, iter func(item T) bool,
+) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if skip != nil && tr.aug == nil {
+		panic("no augmenter")
+	}
+	if tr.root != nil {
+		tr.nodeAscendFilter(tr.root, pivot, skip, keep, tr.checkIter(iter, false))
+	}
+}
+
+// nodeAscendFilter ascends the subtree from pivot, or from the first item
+// when pivot is nil, skipping the subtrees for which skip returns true.
+func (tr *BTreeG[T]) nodeAscendFilter(n *node[T], pivot *T,
+	skip func(meta any) bool, keep func(item T) bool, iter func(item T) bool,
+) bool {
+	if skip != nil && skip(tr.nodeMeta(n)) {
+		return true
+	}
+	var i int
+	var found bool
+	if pivot != nil {
+		i, found = tr.bsearch(n, *pivot)
+	}
+	if n.leaf() {
+		for ; i < len(n.items); i++ {
+			if keep(n.items[i]) && !iter(n.items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if !found {
+		if !tr.nodeAscendFilter((*n.children)[i], pivot, skip, keep, iter) {
+			return false
+		}
+	}
+	for ; i < len(n.items); i++ {
+		if keep(n.items[i]) && !iter(n.items[i]) {
+			return false
+		}
+		if !tr.nodeAscendFilter((*n.children)[i+1], nil, skip, keep, iter) {
+			return false
+		}
+	}
+	return true
+}
+
+// AscendRange ascends the tree within the range [greaterOrEqual, lessThan).
+// Each node is searched for lessThan, and the traversal ends at the last
+// item within the range, so no items or nodes beyond the range are visited.
+// Return false to stop iterating
+func (tr *BTreeG[T]) AscendRange(greaterOrEqual, lessThan T,
+	iter func(item T) bool,
+) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeAscendRange(tr.root, &greaterOrEqual, lessThan,
+		tr.checkIter(iter, false))
+}
+
+// nodeAscendRange ascends the items in the subtree within the range
+// [lo, hi). A nil lo is unbounded.
+func (tr *BTreeG[T]) nodeAscendRange(n *node[T], lo *T, hi T,
+	iter func(item T) bool,
+) bool {
+	var i int
+	var found bool
+	if lo != nil {
+		i, found = tr.bsearch(n, *lo)
+	}
+	// items from j onward are beyond the range, and so are the children
+	// after j
+	j := tr.lowerBound(n, hi)
+	if n.leaf() {
+		for ; i < j; i++ {
+			if !iter(n.items[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if !found {
+		if !tr.nodeAscendRange((*n.children)[i], lo, hi, iter) {
+			return false
+		}
+	}
+	for ; i < j; i++ {
+		if !iter(n.items[i]) {
+			return false
+		}
+		if i+1 < j {
+			if !tr.nodeScan(&(*n.children)[i+1], iter, false) {
+				return false
+			}
+		} else if !tr.nodeAscendRange((*n.children)[j], nil, hi, iter) {
+			return false
+		}
+	}
+	return true
+}
+
+// DescendRange descends the tree within the range (greaterThan,
+// lessOrEqual]. Each node is searched for greaterThan, and the traversal ends
+// at the last item within the range, so no items or nodes beyond the range
+// are visited.
+// Return false to stop iterating
+func (tr *BTreeG[T]) DescendRange(lessOrEqual, greaterThan T,
+	iter func(item T) bool,
+) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeDescendRange(tr.root, &lessOrEqual, greaterThan,
+		tr.checkIter(iter, false))
+}
+
+// nodeDescendRange descends the items in the subtree within the range
+// (lo, hi]. A nil hi is unbounded.
+func (tr *BTreeG[T]) nodeDescendRange(n *node[T], hi *T, lo T,
+	iter func(item T) bool,
+) bool {
+	i, found := len(n.items), false
+	if hi != nil {
+		i, found = tr.bsearch(n, *hi)
+	}
+	// items up to j are beyond the range, and so are the children before j
+	j, jfound := tr.bsearch(n, lo)
+	if jfound {
+		j++
+	}
+	if !found {
+		if !n.leaf() {
+			if !tr.nodeDescendRange((*n.children)[i], hi, lo, iter) {
+				return false
+			}
+		}
+		i--
+	}
+	for ; i >= j; i-- {
+		if !iter(n.items[i]) {
+			return false
+		}
+		if n.leaf() {
+			continue
+		}
+		if i > j {
+			if !tr.nodeReverse(&(*n.children)[i], iter, false) {
+				return false
+			}
+		} else if !tr.nodeDescendRange((*n.children)[j], nil, lo, iter) {
+			return false
+		}
+	}
+	return true
+}
+
+// AscendRef ascends the tree within the range [pivot, last], passing a
+// reference to each item so it can be updated in place.
+// Every visited node is copied first if it's shared with a copy of the tree,
+// so the updates are never visible to other trees. The tree is write locked
+// for the duration of the iteration.
+// The reference must not be retained after iter returns, and the update
+// must not change the order of the item.
 // Return false to stop iterating
-func (tr *BTreeG[T]) Ascend(pivot T, iter func(item T) bool) {
-	tr.ascend(pivot, iter, false, nil)
+func (tr *BTreeG[T]) AscendRef(pivot T, iter func(item *T) bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeAscendRef(&tr.root, pivot, tr.checkRefIter(iter))
 }
-func (tr *BTreeG[T]) AscendMut(pivot T, iter func(item T) bool) {
-	tr.ascend(pivot, iter, true, nil)
+
+// DescendRef descends the tree within the range [pivot, first], passing a
+// reference to each item so it can be updated in place.
+// See AscendRef for the rules on updating items.
+// Return false to stop iterating
+func (tr *BTreeG[T]) DescendRef(pivot T, iter func(item *T) bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeDescendRef(&tr.root, pivot, tr.checkRefIter(iter))
 }
-func (tr *BTreeG[T]) ascend(pivot T, iter func(item T) bool, mut bool,
-	hint *PathHint,
-) {
-	if tr.lock(mut) {
-		defer tr.unlock(mut)
+
+// ScanRef scans all items in ascending order, passing a reference to each
+// item so it can be updated in place.
+// See AscendRef for the rules on updating items.
+// Return false to stop iterating
+func (tr *BTreeG[T]) ScanRef(iter func(item *T) bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
 	}
 	if tr.root == nil {
 		return
 	}
-	tr.nodeAscend(&tr.root, pivot, hint, 0, iter, mut)
+	tr.nodeScanRef(&tr.root, tr.checkRefIter(iter))
 }
-func (tr *BTreeG[T]) AscendHint(pivot T, iter func(item T) bool, hint *PathHint,
-) {
-	tr.ascend(pivot, iter, false, hint)
+
+// ReverseRef scans all items in descending order, passing a reference to
+// each item so it can be updated in place.
+// See AscendRef for the rules on updating items.
+// Return false to stop iterating
+func (tr *BTreeG[T]) ReverseRef(iter func(item *T) bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root == nil {
+		return
+	}
+	tr.nodeReverseRef(&tr.root, tr.checkRefIter(iter))
 }
-func (tr *BTreeG[T]) AscendHintMut(pivot T, iter func(item T) bool,
-	hint *PathHint,
-) {
-	tr.ascend(pivot, iter, true, hint)
+
+func (tr *BTreeG[T]) nodeScanRef(cn **node[T], iter func(item *T) bool) bool {
+	n := tr.isoLoad(cn, true)
+	for i := 0; i < len(n.items); i++ {
+		if !n.leaf() && !tr.nodeScanRef(&(*n.children)[i], iter) {
+			return false
+		}
+		if !iter(&n.items[i]) {
+			return false
+		}
+	}
+	return n.leaf() || tr.nodeScanRef(&(*n.children)[len(n.items)], iter)
 }
 
-// The return value of this function determines whether we should keep iterating
-// upon this functions return.
-func (tr *BTreeG[T]) nodeAscend(cn **node[T], pivot T, hint *PathHint,
-	depth int, iter func(item T) bool, mut bool,
+func (tr *BTreeG[T]) nodeReverseRef(cn **node[T], iter func(item *T) bool,
 ) bool {
-	n := tr.isoLoad(cn, mut)
-	i, found := tr.find(n, pivot, hint, depth)
-	if !found {
-		if !n.leaf() {
-			if !tr.nodeAscend(&(*n.children)[i], pivot, hint, depth+1, iter,
-				mut) {
-				return false
-			}
+	n := tr.isoLoad(cn, true)
+	if !n.leaf() && !tr.nodeReverseRef(&(*n.children)[len(n.items)], iter) {
+		return false
+	}
+	for i := len(n.items) - 1; i >= 0; i-- {
+		if !iter(&n.items[i]) {
+			return false
+		}
+		if !n.leaf() && !tr.nodeReverseRef(&(*n.children)[i], iter) {
+			return false
+		}
+	}
+	return true
+}
+
+func (tr *BTreeG[T]) nodeAscendRef(cn **node[T], pivot T,
+	iter func(item *T) bool,
+) bool {
+	n := tr.isoLoad(cn, true)
+	i, found := tr.bsearch(n, pivot)
+	if !found && !n.leaf() {
+		if !tr.nodeAscendRef(&(*n.children)[i], pivot, iter) {
+			return false
 		}
 	}
-	// We are either in the case that
-	// - node is found, we should iterate through it starting at `i`,
-	//   the index it was located at.
-	// - node is not found, and TODO: fill in.
 	for ; i < len(n.items); i++ {
-		if !iter(n.items[i]) {
+		if !iter(&n.items[i]) {
+			return false
+		}
+		if !n.leaf() && !tr.nodeScanRef(&(*n.children)[i+1], iter) {
 			return false
 		}
+	}
+	return true
+}
+
+func (tr *BTreeG[T]) nodeDescendRef(cn **node[T], pivot T,
+	iter func(item *T) bool,
+) bool {
+	n := tr.isoLoad(cn, true)
+	i, found := tr.bsearch(n, pivot)
+	if !found {
 		if !n.leaf() {
-			if !tr.nodeScan(&(*n.children)[i+1], iter, mut) {
+			if !tr.nodeDescendRef(&(*n.children)[i], pivot, iter) {
 				return false
 			}
 		}
+		i--
+	}
+	for ; i >= 0; i-- {
+		if !iter(&n.items[i]) {
+			return false
+		}
+		if !n.leaf() && !tr.nodeReverseRef(&(*n.children)[i], iter) {
+			return false
+		}
 	}
 	return true
 }
 
-func (tr *BTreeG[T]) Reverse(iter func(item T) bool) {
-	tr.reverse(iter, false)
+// AscendLimit ascends the tree within the range [pivot, last], skipping the
+// first offset items and then passing at most limit items to iter.
+// The skipped items are never visited. The subtree counts are used to seek
+// directly to the first item, making the cost of the offset O(log n).
+// Return false to stop iterating
+func (tr *BTreeG[T]) AscendLimit(pivot T, offset, limit int,
+	iter func(item T) bool,
+) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root == nil || offset < 0 || limit <= 0 {
+		return
+	}
+	index, _ := tr.rank(pivot)
+	index += offset
+	if index >= tr.count {
+		return
+	}
+	tr.nodeAscendAt(tr.root, index, func(item T) bool {
+		limit--
+		return iter(item) && limit > 0
+	})
 }
-func (tr *BTreeG[T]) ReverseMut(iter func(item T) bool) {
-	tr.reverse(iter, true)
+
+// IndexOf returns the index of the item for key, which is the number of items
+// that are less than key.
+// Returns false if the key was not found, in which case the index is where
+// the key would be inserted.
+func (tr *BTreeG[T]) IndexOf(key T) (int, bool) {
+	if tr == nil {
+		return 0, false
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	return tr.rank(key)
 }
-func (tr *BTreeG[T]) reverse(iter func(item T) bool, mut bool) {
-	if tr.lock(mut) {
-		defer tr.unlock(mut)
+
+// CountRange returns the number of items within the range [greaterOrEqual,
+// lessThan) in O(log n), using the subtree counts.
+func (tr *BTreeG[T]) CountRange(greaterOrEqual, lessThan T) int {
+	if tr == nil {
+		return 0
 	}
-	if tr.root == nil {
-		return
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	lo, _ := tr.rank(greaterOrEqual)
+	hi, _ := tr.rank(lessThan)
+	if hi < lo {
+		return 0
 	}
-	tr.nodeReverse(&tr.root, iter, mut)
+	return hi - lo
 }
 
-func (tr *BTreeG[T]) nodeReverse(cn **node[T], iter func(item T) bool, mut bool,
+// rank returns the number of items that are less than pivot, and whether
+// the pivot was found.
+func (tr *BTreeG[T]) rank(pivot T) (int, bool) {
+	var rank int
+	n := tr.root
+	for n != nil {
+		i, found := tr.bsearch(n, pivot)
+		rank += i
+		if !n.leaf() {
+			for j := 0; j < i; j++ {
+				rank += (*n.children)[j].count
+			}
+			if found {
+				rank += (*n.children)[i].count
+			}
+		}
+		if found || n.leaf() {
+			return rank, found
+		}
+		n = (*n.children)[i]
+	}
+	return rank, false
+}
+
+// nodeAscendAt ascends the subtree starting at the item at index.
+func (tr *BTreeG[T]) nodeAscendAt(n *node[T], index int,
+	iter func(item T) bool,
 ) bool {
-	n := tr.isoLoad(cn, mut)
 	if n.leaf() {
-		for i := len(n.items) - 1; i >= 0; i-- {
+		for i := index; i < len(n.items); i++ {
 			if !iter(n.items[i]) {
 				return false
 			}
 		}
 		return true
 	}
-	if !tr.nodeReverse(&(*n.children)[len(*n.children)-1], iter, mut) {
-		return false
-	}
-	for i := len(n.items) - 1; i >= 0; i-- {
-		if !iter(n.items[i]) {
-			return false
+	for i := 0; i <= len(n.items); i++ {
+		child := (*n.children)[i]
+		if index < child.count {
+			if !tr.nodeAscendAt(child, index, iter) {
+				return false
+			}
+			index = 0
+		} else {
+			index -= child.count
 		}
-		if !tr.nodeReverse(&(*n.children)[i], iter, mut) {
+		if i == len(n.items) {
+			break
+		}
+		if index > 0 {
+			index--
+		} else if !iter(n.items[i]) {
 			return false
 		}
 	}
 	return true
 }
 
-// Descend the tree within the range [pivot, first]
-// Pass nil for pivot to scan all item in descending order
-// Return false to stop iterating
-func (tr *BTreeG[T]) Descend(pivot T, iter func(item T) bool) {
-	tr.descend(pivot, iter, false, nil)
+// ScanPage returns up to limit items that are greater than after, in
+// ascending order. Pass nil for after to start at the first item.
+// The returned next item is the last item in the page and is used as the
+// after param for requesting the following page. The returned more param
+// is true when there are items beyond the page.
+//
+//	var after *T
+//	for {
+//		page, next, more := tr.ScanPage(after, 100)
+//		...
+//		if !more {
+//			break
+//		}
+//		after = &next
+//	}
+func (tr *BTreeG[T]) ScanPage(after *T, limit int) (page []T, next T,
+	more bool,
+) {
+	if limit <= 0 {
+		return nil, tr.empty, false
+	}
+	iter := func(item T) bool {
+		if after != nil && !tr.less(*after, item) {
+			// skip the after item
+			return true
+		}
+		if len(page) == limit {
+			more = true
+			return false
+		}
+		page = append(page, item)
+		return true
+	}
+	if after == nil {
+		tr.Scan(iter)
+	} else {
+		tr.Ascend(*after, iter)
+	}
+	if len(page) > 0 {
+		next = page[len(page)-1]
+	}
+	return page, next, more
 }
-func (tr *BTreeG[T]) DescendMut(pivot T, iter func(item T) bool) {
-	tr.descend(pivot, iter, true, nil)
+
+// errIter adapts an error returning iterator. The first error stops the
+// iteration and is stored in err.
+func errIter[T any](iter func(item T) (bool, error), err *error,
+) func(item T) bool {
+	return func(item T) bool {
+		var ok bool
+		ok, *err = iter(item)
+		return ok && *err == nil
+	}
 }
-func (tr *BTreeG[T]) descend(pivot T, iter func(item T) bool, mut bool,
-	hint *PathHint,
-) {
-	if tr.lock(mut) {
-		defer tr.unlock(mut)
+
+// ScanErr is like Scan but the iterator may return an error, which stops
+// the iteration and is returned to the caller.
+func (tr *BTreeG[T]) ScanErr(iter func(item T) (bool, error)) error {
+	var err error
+	tr.Scan(errIter(iter, &err))
+	return err
+}
+
+// AscendErr is like Ascend but the iterator may return an error, which
+// stops the iteration and is returned to the caller.
+func (tr *BTreeG[T]) AscendErr(pivot T, iter func(item T) (bool, error),
+) error {
+	var err error
+	tr.Ascend(pivot, errIter(iter, &err))
+	return err
+}
+
+// DescendErr is like Descend but the iterator may return an error, which
+// stops the iteration and is returned to the caller.
+func (tr *BTreeG[T]) DescendErr(pivot T, iter func(item T) (bool, error),
+) error {
+	var err error
+	tr.Descend(pivot, errIter(iter, &err))
+	return err
+}
+
+// ctxCheckInterval is the number of items visited between context checks.
+const ctxCheckInterval = 256
+
+// ctxIter adapts an iterator to stop when the context is done. The context
+// error is stored in err.
+func ctxIter[T any](ctx context.Context, iter func(item T) bool, err *error,
+) func(item T) bool {
+	var count int
+	return func(item T) bool {
+		count++
+		if count == ctxCheckInterval {
+			count = 0
+			if *err = ctx.Err(); *err != nil {
+				return false
+			}
+		}
+		return iter(item)
 	}
-	if tr.root == nil {
-		return
+}
+
+// ScanCtx is like Scan but stops when the context is done, returning the
+// context error. The context is checked periodically, not for every item.
+func (tr *BTreeG[T]) ScanCtx(ctx context.Context, iter func(item T) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Scan(ctxIter(ctx, iter, &err))
+	return err
+}
+
+// AscendCtx is like Ascend but stops when the context is done, returning
+// the context error. The context is checked periodically, not for every
+// item.
+func (tr *BTreeG[T]) AscendCtx(ctx context.Context, pivot T,
+	iter func(item T) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Ascend(pivot, ctxIter(ctx, iter, &err))
+	return err
+}
+
+// DescendCtx is like Descend but stops when the context is done, returning
+// the context error. The context is checked periodically, not for every
+// item.
+func (tr *BTreeG[T]) DescendCtx(ctx context.Context, pivot T,
+	iter func(item T) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Descend(pivot, ctxIter(ctx, iter, &err))
+	return err
+}
+
+// budgetIter adapts an iterator to stop after visiting budget items. When
+// there are more items, ErrBudgetExceeded is stored in err.
+func budgetIter[T any](budget int, iter func(item T) bool, err *error,
+) func(item T) bool {
+	return func(item T) bool {
+		if budget <= 0 {
+			*err = ErrBudgetExceeded
+			return false
+		}
+		budget--
+		return iter(item)
 	}
-	tr.nodeDescend(&tr.root, pivot, hint, 0, iter, mut)
 }
 
-func (tr *BTreeG[T]) DescendHint(pivot T, iter func(item T) bool,
-	hint *PathHint,
-) {
-	tr.descend(pivot, iter, false, hint)
+// ScanBudget is like Scan but visits at most budget items, returning
+// ErrBudgetExceeded if the scan was stopped with items remaining. Every node
+// holds at least one item, so the budget also bounds the nodes visited,
+// keeping a runaway scan from monopolizing the calling goroutine.
+func (tr *BTreeG[T]) ScanBudget(budget int, iter func(item T) bool) error {
+	var err error
+	tr.Scan(budgetIter(budget, iter, &err))
+	return err
 }
-func (tr *BTreeG[T]) DescendHintMut(pivot T, iter func(item T) bool,
-	hint *PathHint,
-) {
-	tr.descend(pivot, iter, true, hint)
+
+// AscendBudget is like Ascend but visits at most budget items, returning
+// ErrBudgetExceeded if the scan was stopped with items remaining.
+func (tr *BTreeG[T]) AscendBudget(pivot T, budget int, iter func(item T) bool,
+) error {
+	var err error
+	tr.Ascend(pivot, budgetIter(budget, iter, &err))
+	return err
+}
+
+// DescendBudget is like Descend but visits at most budget items, returning
+// ErrBudgetExceeded if the scan was stopped with items remaining.
+func (tr *BTreeG[T]) DescendBudget(pivot T, budget int,
+	iter func(item T) bool,
+) error {
+	var err error
+	tr.Descend(pivot, budgetIter(budget, iter, &err))
+	return err
 }
 
 func (tr *BTreeG[T]) nodeDescend(cn **node[T], pivot T, hint *PathHint,
@@ -1218,8 +2838,12 @@ func (tr *BTreeG[T]) Load(item T) (T, bool) {
 	if tr.lock(true) {
 		defer tr.unlock(true)
 	}
+	if tr.full(item) {
+		panic(ErrFull)
+	}
+	tr.untomb(item)
 	if tr.root == nil {
-		return tr.setHint(item, nil)
+		return tr.setHint(item, nil, false)
 	}
 	n := tr.isoLoad(&tr.root, true)
 	for {
@@ -1243,9 +2867,102 @@ func (tr *BTreeG[T]) Load(item T) (T, bool) {
 		if n.leaf() {
 			break
 		}
-		n = (*n.children)[len(*n.children)-1]
+		n = (*n.children)[len(*n.children)-1]
+	}
+	return tr.setHint(item, nil, false)
+}
+
+// AppendSorted is for bulk appending pre-sorted items that are greater than
+// all items in the tree, such as monotonically increasing log offsets.
+// Rather than descending the tree for every item, the rightmost leaf is
+// filled with as many items as fit at a time.
+// Items that are out of order fall back to a regular Set.
+func (tr *BTreeG[T]) AppendSorted(items []T) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	tr.appendSorted(items)
+}
+
+func (tr *BTreeG[T]) appendSorted(items []T) {
+	for len(items) > 0 {
+		if tr.root != nil {
+			items = tr.appendLeaf(items)
+			if len(items) == 0 {
+				break
+			}
+		}
+		if tr.full(items[0]) {
+			panic(ErrFull)
+		}
+		tr.untomb(items[0])
+		tr.setHint(items[0], nil, false)
+		items = items[1:]
+	}
+}
+
+// LoadSorted bulk loads items that are in strictly ascending order. When the
+// tree is empty it's built bottom-up in O(n), with the nodes packed as full
+// as possible, rather than inserting the items one at a time. Otherwise the
+// items are added as by AppendSorted.
+// Panics if the items are out of order.
+func (tr *BTreeG[T]) LoadSorted(items []T) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	for i := 1; i < len(items); i++ {
+		if !tr.less(items[i-1], items[i]) {
+			panic("items out of order")
+		}
+	}
+	if tr.root != nil {
+		tr.appendSorted(items)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+	if tr.maxItems > 0 && len(items) > tr.maxItems {
+		panic(ErrFull)
+	}
+	for _, item := range items {
+		tr.untomb(item)
+	}
+	tr.root = tr.buildNode(items, tr.childCap(len(items)))
+	tr.count = len(items)
+}
+
+// appendLeaf appends the leading items that are in order and fit into the
+// rightmost leaf. Returns the remaining items.
+func (tr *BTreeG[T]) appendLeaf(items []T) []T {
+	var path [16]*node[T]
+	stack := path[:0]
+	n := tr.isoLoad(&tr.root, true)
+	for !n.leaf() {
+		stack = append(stack, n)
+		n = tr.isoLoad(&(*n.children)[len(*n.children)-1], true)
 	}
-	return tr.setHint(item, nil)
+	last := n.items[len(n.items)-1]
+	k := 0
+	for k < len(items) && len(n.items) < tr.max && tr.less(last, items[k]) &&
+		(tr.maxItems <= 0 || tr.count+k < tr.maxItems) {
+		last = items[k]
+		n.items = append(n.items, last)
+		tr.untomb(last)
+		k++
+	}
+	n.count += k
+	for _, n := range stack {
+		n.count += k
+	}
+	tr.count += k
+	return items[k:]
 }
 
 // Min returns the minimum item in tree.
@@ -1259,6 +2976,10 @@ func (tr *BTreeG[T]) MinMut() (T, bool) {
 }
 
 func (tr *BTreeG[T]) minMut(mut bool) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
 	if tr.lock(mut) {
 		defer tr.unlock(mut)
 	}
@@ -1268,6 +2989,7 @@ func (tr *BTreeG[T]) minMut(mut bool) (T, bool) {
 	n := tr.isoLoad(&tr.root, mut)
 	for {
 		if n.leaf() {
+			tr.checkRead(n.items[0], mut)
 			return n.items[0], true
 		}
 		n = tr.isoLoad(&(*n.children)[0], mut)
@@ -1285,6 +3007,10 @@ func (tr *BTreeG[T]) MaxMut() (T, bool) {
 }
 
 func (tr *BTreeG[T]) maxMut(mut bool) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
 	if tr.lock(mut) {
 		defer tr.unlock(mut)
 	}
@@ -1294,6 +3020,7 @@ func (tr *BTreeG[T]) maxMut(mut bool) (T, bool) {
 	n := tr.isoLoad(&tr.root, mut)
 	for {
 		if n.leaf() {
+			tr.checkRead(n.items[len(n.items)-1], mut)
 			return n.items[len(n.items)-1], true
 		}
 		n = tr.isoLoad(&(*n.children)[len(*n.children)-1], mut)
@@ -1309,6 +3036,29 @@ func (tr *BTreeG[T]) PopMin() (T, bool) {
 	if tr.lock(true) {
 		defer tr.unlock(true)
 	}
+	return tr.popMin()
+}
+
+// Drain removes items in ascending order, passing each removed item to iter.
+// Return false to stop draining. The item passed to that call has already
+// been removed, so every item is consumed exactly once.
+// The tree is locked while draining and must not be modified by iter.
+func (tr *BTreeG[T]) Drain(iter func(item T) bool) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	for {
+		item, ok := tr.popMin()
+		if !ok || !iter(item) {
+			return
+		}
+	}
+}
+
+func (tr *BTreeG[T]) popMin() (T, bool) {
 	if tr.root == nil {
 		return tr.empty, false
 	}
@@ -1324,9 +3074,11 @@ func (tr *BTreeG[T]) PopMin() (T, bool) {
 			copy(n.items[:], n.items[1:])
 			n.items[len(n.items)-1] = tr.empty
 			n.items = n.items[:len(n.items)-1]
+			tr.tomb(item)
 			tr.count--
 			if tr.count == 0 {
 				tr.root = nil
+				tr.freeNodes(1)
 			}
 			return item, true
 		}
@@ -1367,9 +3119,11 @@ func (tr *BTreeG[T]) PopMax() (T, bool) {
 			}
 			n.items[len(n.items)-1] = tr.empty
 			n.items = n.items[:len(n.items)-1]
+			tr.tomb(item)
 			tr.count--
 			if tr.count == 0 {
 				tr.root = nil
+				tr.freeNodes(1)
 			}
 			return item, true
 		}
@@ -1396,9 +3150,59 @@ func (tr *BTreeG[T]) GetAtMut(index int) (T, bool) {
 	return tr.getAt(index, true)
 }
 func (tr *BTreeG[T]) getAt(index int, mut bool) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
 	if tr.lock(mut) {
 		defer tr.unlock(mut)
 	}
+	item, ok := tr.at(index, mut)
+	if ok {
+		tr.checkRead(item, mut)
+	}
+	return item, ok
+}
+
+// Quantile returns the item at the q-th quantile, where q is between 0 and
+// 1, using the nearest-rank method. For example, 0.99 returns the p99 item.
+// Returns false if the tree is empty or q is out of range.
+func (tr *BTreeG[T]) Quantile(q float64) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if !(q >= 0 && q <= 1) {
+		return tr.empty, false
+	}
+	index := int(math.Ceil(q*float64(tr.count))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return tr.at(index, false)
+}
+
+// Rand returns a uniformly random item, chosen using rng.
+// Returns false if the tree is empty.
+func (tr *BTreeG[T]) Rand(rng *rand.Rand) (T, bool) {
+	if tr == nil {
+		var empty T
+		return empty, false
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.count == 0 {
+		return tr.empty, false
+	}
+	return tr.at(rng.Intn(tr.count), false)
+}
+
+// at returns the item at index. The tree must be locked.
+func (tr *BTreeG[T]) at(index int, mut bool) (T, bool) {
 	if tr.root == nil || index < 0 || index >= tr.count {
 		return tr.empty, false
 	}
@@ -1449,9 +3253,11 @@ outer:
 			copy(n.items[index:], n.items[index+1:])
 			n.items[len(n.items)-1] = tr.empty
 			n.items = n.items[:len(n.items)-1]
+			tr.tomb(item)
 			tr.count--
 			if tr.count == 0 {
 				tr.root = nil
+				tr.freeNodes(1)
 			}
 			return item, true
 		}
@@ -1488,6 +3294,9 @@ outer:
 // Height returns the height of the tree.
 // Returns zero if tree has no items.
 func (tr *BTreeG[T]) Height() int {
+	if tr == nil {
+		return 0
+	}
 	if tr.lock(false) {
 		defer tr.unlock(false)
 	}
@@ -1505,6 +3314,113 @@ func (tr *BTreeG[T]) Height() int {
 	return height
 }
 
+// Stats contains structural statistics for a tree.
+type Stats struct {
+	// Height of the tree.
+	Height int
+	// Items is the number of items in the tree.
+	Items int
+	// Nodes is the number of nodes in the tree.
+	Nodes int
+	// Depths is a histogram of item depths, where Depths[i] is the number of
+	// items stored at depth i. Looking up an item at depth i visits i+1
+	// nodes.
+	Depths []int
+	// DepthNodes is the number of nodes at each depth.
+	DepthNodes []int
+	// Fill is the fill factor at each depth, where Fill[i] is the number of
+	// items stored at depth i divided by the capacity of the nodes at that
+	// depth. Use Compact to pack underfull nodes.
+	Fill []float64
+}
+
+// Stats returns structural statistics for the tree.
+// Since the tree is always balanced the depth histogram is exact and no
+// sampling of individual operations is needed.
+func (tr *BTreeG[T]) Stats() Stats {
+	if tr == nil {
+		return Stats{}
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	var stats Stats
+	stats.Items = tr.count
+	if tr.root != nil {
+		tr.nodeStats(tr.root, 0, &stats)
+	}
+	stats.Height = len(stats.Depths)
+	if stats.Height > 0 {
+		stats.Fill = make([]float64, stats.Height)
+		for i := range stats.Fill {
+			stats.Fill[i] = float64(stats.Depths[i]) /
+				float64(stats.DepthNodes[i]*tr.max)
+		}
+	}
+	return stats
+}
+
+func (tr *BTreeG[T]) nodeStats(n *node[T], depth int, stats *Stats) {
+	if depth == len(stats.Depths) {
+		stats.Depths = append(stats.Depths, 0)
+		stats.DepthNodes = append(stats.DepthNodes, 0)
+	}
+	stats.Nodes++
+	stats.Depths[depth] += len(n.items)
+	stats.DepthNodes[depth]++
+	if !n.leaf() {
+		for i := 0; i < len(*n.children); i++ {
+			tr.nodeStats((*n.children)[i], depth+1, stats)
+		}
+	}
+}
+
+// AllocStats contains node allocation counters for a tree.
+type AllocStats struct {
+	// Allocs is the number of nodes allocated by the tree, including nodes
+	// that were copied by copy-on-write.
+	Allocs uint64
+	// Frees is the number of nodes released by the tree. A node that is
+	// shared with a copy of the tree is released once by each tree.
+	// Subtrees that are released as a whole, such as by DeleteRange, are
+	// counted by an estimate, because they are not walked.
+	Frees uint64
+	// Live is an estimate of the number of nodes referenced by the tree,
+	// including nodes that are shared with copies of the tree. It's exact
+	// until a subtree is released as a whole, and again after the tree is
+	// rebuilt, such as by Compact or Clear.
+	Live uint64
+}
+
+// ReadAllocStats returns the node allocation counters for the tree.
+// Unlike Stats this does not walk the tree, so it's cheap enough to poll
+// for feeding GC tuning with the index churn.
+func (tr *BTreeG[T]) ReadAllocStats() AllocStats {
+	if tr == nil {
+		return AllocStats{}
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	return tr.allocs
+}
+
+func (tr *BTreeG[T]) freeNodes(n uint64) {
+	tr.allocs.Frees += n
+	if n > tr.allocs.Live {
+		// Live is an estimate, which must not wrap around
+		n = tr.allocs.Live
+	}
+	tr.allocs.Live -= n
+}
+
+// estimateNodes estimates the number of nodes in a subtree from its number
+// of items, assuming half full nodes, so that a detached subtree is released
+// without being walked.
+func (tr *BTreeG[T]) estimateNodes(n *node[T]) uint64 {
+	return 1 + uint64(n.count)/uint64(tr.max/2+1)
+}
+
 // Walk iterates over all items in tree, in order.
 // The items param will contain one or more items.
 func (tr *BTreeG[T]) Walk(iter func(item []T) bool) {
@@ -1514,6 +3430,9 @@ func (tr *BTreeG[T]) WalkMut(iter func(item []T) bool) {
 	tr.walk(iter, true)
 }
 func (tr *BTreeG[T]) walk(iter func(item []T) bool, mut bool) {
+	if tr == nil {
+		return
+	}
 	if tr.lock(mut) {
 		defer tr.unlock(mut)
 	}
@@ -1527,7 +3446,7 @@ func (tr *BTreeG[T]) nodeWalk(cn **node[T], iter func(item []T) bool, mut bool,
 ) bool {
 	n := tr.isoLoad(cn, mut)
 	if n.leaf() {
-		if !iter(n.items) {
+		if !tr.walkItems(n.items, iter) {
 			return false
 		}
 	} else {
@@ -1546,6 +3465,22 @@ func (tr *BTreeG[T]) nodeWalk(cn **node[T], iter func(item []T) bool, mut bool,
 	return true
 }
 
+// walkItems passes the items of a leaf to iter, in random batches when
+// shuffling.
+func (tr *BTreeG[T]) walkItems(items []T, iter func(item []T) bool) bool {
+	if tr.shuffle == nil {
+		return iter(items)
+	}
+	for len(items) > 0 {
+		n := 1 + tr.shuffle.intn(len(items))
+		if !iter(items[:n:n]) {
+			return false
+		}
+		items = items[n:]
+	}
+	return true
+}
+
 // Copy the tree. This is a copy-on-write operation and is very fast because
 // it only performs a shadowed copy.
 func (tr *BTreeG[T]) Copy() *BTreeG[T] {
@@ -1553,6 +3488,9 @@ func (tr *BTreeG[T]) Copy() *BTreeG[T] {
 }
 
 func (tr *BTreeG[T]) IsoCopy() *BTreeG[T] {
+	if tr == nil {
+		return nil
+	}
 	var mu *sync.RWMutex
 	if tr.lock(!tr.readOnly) {
 		mu = new(sync.RWMutex)
@@ -1566,6 +3504,193 @@ func (tr *BTreeG[T]) IsoCopy() *BTreeG[T] {
 	tr2.mu = mu
 	tr2.isoid = newIsoID()
 	tr2.readOnly = false
+	tr2.allocs = AllocStats{Live: tr.allocs.Live}
+	if tr.tombs != nil {
+		tr2.tombs = tr.tombs.IsoCopy()
+	}
+	if tr.sums != nil {
+		tr2.sums = tr.sums.Copy()
+	}
+	return tr2
+}
+
+// CopyExactShape returns a deep copy of the tree with exactly the same node
+// structure. Unlike Copy, no nodes are shared, so both trees start with the
+// same shape and the same memory layout costs, which is useful for comparing
+// algorithms against identical trees. Items are copied in the same way as
+// by a copy-on-write.
+func (tr *BTreeG[T]) CopyExactShape() *BTreeG[T] {
+	if tr == nil {
+		return nil
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	tr2 := tr.emptyCopy()
+	if tr.root != nil {
+		tr2.root = tr2.copyShape(tr.root)
+		tr2.count = tr.count
+	}
+	if tr.tombs != nil {
+		tr2.tombs = tr.tombs.CopyExactShape()
+	}
+	return tr2
+}
+
+// copyShape returns a deep copy of the subtree.
+func (tr *BTreeG[T]) copyShape(n *node[T]) *node[T] {
+	n2 := tr.newNode(n.leaf())
+	n2.count = n.count
+	n2.items = make([]T, len(n.items), cap(n.items))
+	for i, item := range n.items {
+		n2.items[i] = tr.copyItem(item)
+	}
+	if !n.leaf() {
+		*n2.children = make([]*node[T], len(*n.children), cap(*n.children))
+		for i, child := range *n.children {
+			(*n2.children)[i] = tr.copyShape(child)
+		}
+	}
+	return n2
+}
+
+// CopyTo sets every item of the tree into dst, in order, in a single pass.
+// The dst may be any container with a Set method, such as another BTreeG or
+// a wrapper around a different implementation. When dst is a BTreeG, the
+// items are added with AppendSorted, which avoids a descent per item when
+// dst has the same order.
+//
+// The items are read from a copy-on-write snapshot, so the tree is not locked
+// while dst is being updated.
+func (tr *BTreeG[T]) CopyTo(dst interface{ Set(item T) (T, bool) }) {
+	snap := tr.Copy()
+	if dst, ok := dst.(*BTreeG[T]); ok {
+		dst.AppendSorted(snap.AppendItems(make([]T, 0, snap.Len())))
+		return
+	}
+	snap.Scan(func(item T) bool {
+		dst.Set(item)
+		return true
+	})
+}
+
+// Merge sets every item of other into the tree, which must have the same
+// order. When both trees have an item for a key, onConflict is called with
+// the item of the tree and the item of other, and returns the item to keep.
+// Pass nil for onConflict to keep the items of other, like Set.
+//
+// Small trees are merged in with an insert per item. Otherwise both trees are
+// merged in a single pass and the tree is rebuilt, in O(n+m).
+// Panics with ErrFull, before the tree is modified, if the merged tree would
+// exceed Options.MaxItems.
+func (tr *BTreeG[T]) Merge(other *BTreeG[T], onConflict func(a, b T) T) {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	items := other.AppendItems(nil)
+	if len(items) == 0 {
+		return
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if onConflict == nil {
+		onConflict = func(a, b T) T { return b }
+	}
+	if len(items)*bits.Len(uint(tr.count)) < tr.count {
+		tr.mergeSmall(items, onConflict)
+	} else {
+		tr.mergeAll(items, onConflict)
+	}
+}
+
+// mergeSmall merges the items into the tree with an insert per item.
+func (tr *BTreeG[T]) mergeSmall(items []T, onConflict func(a, b T) T) {
+	if tr.maxItems > 0 {
+		count := tr.count
+		for _, item := range items {
+			if _, found := tr.rank(item); !found {
+				count++
+			}
+		}
+		if count > tr.maxItems {
+			panic(ErrFull)
+		}
+	}
+	for _, item := range items {
+		if prev, found := tr.setHint(item, nil, true); found {
+			item = onConflict(prev, item)
+			tr.setHint(item, nil, false)
+		}
+		tr.untomb(item)
+	}
+}
+
+// mergeAll merges the items with all items of the tree, and rebuilds the
+// tree from the result.
+func (tr *BTreeG[T]) mergeAll(items []T, onConflict func(a, b T) T) {
+	var a []T
+	if tr.root != nil {
+		a = tr.appendNodeItems(make([]T, 0, tr.count), tr.root, nil)
+	}
+	merged := make([]T, 0, len(a)+len(items))
+	var changed []T
+	i, j := 0, 0
+	for i < len(a) && j < len(items) {
+		if tr.less(a[i], items[j]) {
+			merged = append(merged, a[i])
+			i++
+		} else if tr.less(items[j], a[i]) {
+			merged = append(merged, items[j])
+			changed = append(changed, items[j])
+			j++
+		} else {
+			item := onConflict(a[i], items[j])
+			merged = append(merged, item)
+			changed = append(changed, item)
+			i++
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	changed = append(changed, items[j:]...)
+	merged = append(merged, items[j:]...)
+	if tr.maxItems > 0 && len(merged) > tr.maxItems {
+		panic(ErrFull)
+	}
+	tr.freeNodes(tr.allocs.Live)
+	tr.count = len(merged)
+	tr.root = tr.buildNode(merged, tr.childCap(len(merged)))
+	for _, item := range changed {
+		tr.untomb(item)
+	}
+}
+
+// emptyCopy returns a new empty tree with the same options as the tree.
+func (tr *BTreeG[T]) emptyCopy() *BTreeG[T] {
+	tr2 := &BTreeG[T]{
+		isoid:        newIsoID(),
+		locks:        tr.locks,
+		copyItems:    tr.copyItems,
+		isoCopyItems: tr.isoCopyItems,
+		maxItems:     tr.maxItems,
+		shuffle:      tr.shuffle,
+		agg:          tr.agg,
+		aug:          tr.aug,
+		clone:        tr.clone,
+		less:         tr.less,
+		min:          tr.min,
+		max:          tr.max,
+	}
+	if tr2.locks {
+		tr2.mu = new(sync.RWMutex)
+	}
+	if tr.tombs != nil {
+		tr2.tombs = tr.tombs.emptyCopy()
+	}
+	if tr.sum != nil {
+		tr2.SetChecksum(tr.sum)
+	}
 	return tr2
 }
 
@@ -1577,6 +3702,13 @@ func (tr *BTreeG[T]) lock(write bool) bool {
 			tr.mu.RLock()
 		}
 	}
+	if write {
+		tr.gen++
+	}
+	if write && tr.shuffle != nil && tr.shuffle.intn(4) == 0 {
+		// force copy-on-write of the nodes touched by this operation
+		tr.isoid = newIsoID()
+	}
 	return tr.locks
 }
 
@@ -1616,11 +3748,24 @@ func (tr *BTreeG[T]) IterMut() IterG[T] {
 	return tr.iter(true)
 }
 
+// IterSnapshot returns a read-only iterator over a copy-on-write snapshot of
+// the tree. The tree is only locked while the snapshot is taken, so writers
+// are not blocked by the iterator and their changes are not visible to it.
+// The Release method must be called finished with iterator.
+func (tr *BTreeG[T]) IterSnapshot() IterG[T] {
+	var iter IterG[T]
+	iter.tr = tr.Copy()
+	iter.stack = iter.stack0[:0]
+	return iter
+}
+
 func (tr *BTreeG[T]) iter(mut bool) IterG[T] {
 	var iter IterG[T]
 	iter.tr = tr
 	iter.mut = mut
-	iter.locked = tr.lock(iter.mut)
+	if tr != nil {
+		iter.locked = tr.lock(iter.mut)
+	}
 	iter.stack = iter.stack0[:0]
 	return iter
 }
@@ -1860,6 +4005,9 @@ func (tr *BTreeG[T]) ItemsMut() []T {
 }
 
 func (tr *BTreeG[T]) items(mut bool) []T {
+	if tr == nil {
+		return nil
+	}
 	if tr.lock(mut) {
 		defer tr.unlock(mut)
 	}
@@ -1870,6 +4018,49 @@ func (tr *BTreeG[T]) items(mut bool) []T {
 	return items
 }
 
+// AppendItems appends all items in order to dst and returns the extended
+// slice, which allows reusing the capacity of a previous export.
+func (tr *BTreeG[T]) AppendItems(dst []T) []T {
+	if tr == nil {
+		return dst
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root != nil {
+		dst = tr.nodeItems(&tr.root, dst, false)
+	}
+	return dst
+}
+
+// Slice returns the items at the positions [i, j) in order. The positions
+// are clamped to the bounds of the tree. The subtree counts are used to seek
+// directly to the first item.
+// Returns nil if the range is empty.
+func (tr *BTreeG[T]) Slice(i, j int) []T {
+	if tr == nil {
+		return nil
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j > tr.count {
+		j = tr.count
+	}
+	if tr.root == nil || i >= j {
+		return nil
+	}
+	items := make([]T, 0, j-i)
+	tr.nodeAscendAt(tr.root, i, func(item T) bool {
+		items = append(items, item)
+		return len(items) < j-i
+	})
+	return items
+}
+
 func (tr *BTreeG[T]) nodeItems(cn **node[T], items []T, mut bool) []T {
 	n := tr.isoLoad(cn, mut)
 	if n.leaf() {
@@ -1882,7 +4073,60 @@ func (tr *BTreeG[T]) nodeItems(cn **node[T], items []T, mut bool) []T {
 	return tr.nodeItems(&(*n.children)[len(*n.children)-1], items, mut)
 }
 
+// MinN returns up to n of the smallest items, in ascending order.
+func (tr *BTreeG[T]) MinN(n int) []T {
+	return tr.AppendMinN(nil, n)
+}
+
+// MaxN returns up to n of the largest items, in descending order.
+func (tr *BTreeG[T]) MaxN(n int) []T {
+	return tr.AppendMaxN(nil, n)
+}
+
+// AppendMinN appends up to n of the smallest items to dst, in ascending
+// order, and returns the extended slice.
+func (tr *BTreeG[T]) AppendMinN(dst []T, n int) []T {
+	return tr.appendN(dst, n, false)
+}
+
+// AppendMaxN appends up to n of the largest items to dst, in descending
+// order, and returns the extended slice.
+func (tr *BTreeG[T]) AppendMaxN(dst []T, n int) []T {
+	return tr.appendN(dst, n, true)
+}
+
+func (tr *BTreeG[T]) appendN(dst []T, n int, reverse bool) []T {
+	if tr == nil {
+		return dst
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root == nil || n <= 0 {
+		return dst
+	}
+	if n > tr.count {
+		n = tr.count
+	}
+	if cap(dst)-len(dst) < n {
+		dst = append(make([]T, 0, len(dst)+n), dst...)
+	}
+	iter := func(item T) bool {
+		dst = append(dst, item)
+		n--
+		return n > 0
+	}
+	if reverse {
+		tr.nodeReverse(&tr.root, iter, false)
+	} else {
+		tr.nodeScan(&tr.root, iter, false)
+	}
+	return dst
+}
+
 // Clear will delete all items.
+// In tombstone mode every item is recorded as a tombstone, which takes a
+// walk of the tree.
 func (tr *BTreeG[T]) Clear() {
 	if tr.readOnly {
 		panic("read-only tree")
@@ -1890,8 +4134,142 @@ func (tr *BTreeG[T]) Clear() {
 	if tr.lock(true) {
 		defer tr.unlock(true)
 	}
+	if tr.tombs != nil && tr.root != nil {
+		// every cleared item is a delete, so it's recorded like one
+		tr.nodeScan(&tr.root, func(item T) bool {
+			tr.tombs.setHint(item, nil, false)
+			return true
+		}, false)
+	}
 	tr.root = nil
 	tr.count = 0
+	tr.freeNodes(tr.allocs.Live)
+	if tr.sums != nil {
+		tr.sums.Clear()
+	}
+}
+
+// tomb records a deleted item when tombstone mode is enabled, and forgets
+// its checksum.
+func (tr *BTreeG[T]) tomb(item T) {
+	if tr.tombs != nil {
+		tr.tombs.setHint(item, nil, false)
+	}
+	tr.checkDelete(item)
+}
+
+// untomb removes the tombstone for an item that is being set, and records
+// its checksum.
+func (tr *BTreeG[T]) untomb(item T) {
+	if tr.tombs != nil && tr.tombs.root != nil {
+		tr.tombs.deleteHint(item, nil)
+	}
+	tr.checkSet(item)
+}
+
+// Tombstones iterates over all items that were deleted since the last
+// Compact, in order.
+// Only available in tombstone mode, see Options.Tombstones.
+func (tr *BTreeG[T]) Tombstones(iter func(item T) bool) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.tombs != nil && tr.tombs.root != nil {
+		tr.tombs.nodeScan(&tr.tombs.root, iter, false)
+	}
+}
+
+// Compact rebuilds the tree with every node packed as full as possible,
+// reclaiming the memory wasted by underfull nodes after heavy deletions.
+// It also discards all tombstones.
+func (tr *BTreeG[T]) Compact() {
+	if tr.readOnly {
+		panic("read-only tree")
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if tr.root != nil {
+		items := tr.appendNodeItems(make([]T, 0, tr.count), tr.root, nil)
+		tr.freeNodes(tr.allocs.Live)
+		tr.root = tr.buildNode(items, tr.childCap(len(items)))
+	}
+	if tr.tombs != nil {
+		tr.tombs.Clear()
+	}
+}
+
+// appendNodeItems appends all items in the subtree to items, in order,
+// skipping the items for which keep returns false. Pass nil to keep all.
+// Items from nodes that are shared with other trees are copied.
+func (tr *BTreeG[T]) appendNodeItems(items []T, n *node[T],
+	keep func(item T) bool,
+) []T {
+	shared := n.isoid != tr.isoid
+	for i := 0; i <= len(n.items); i++ {
+		if !n.leaf() {
+			items = tr.appendNodeItems(items, (*n.children)[i], keep)
+		}
+		if i == len(n.items) {
+			break
+		}
+		item := n.items[i]
+		if keep != nil && !keep(item) {
+			continue
+		}
+		if shared {
+			item = tr.copyItem(item)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// childCap returns the capacity of each child subtree for the shortest tree
+// that can hold count items. Returns zero if the items fit in a single leaf.
+func (tr *BTreeG[T]) childCap(count int) int {
+	capacity, childCap := tr.max, 0
+	for capacity < count {
+		childCap = capacity
+		capacity = capacity*(tr.max+1) + tr.max
+	}
+	return childCap
+}
+
+// buildNode returns a new subtree holding the sorted items. The items are
+// spread evenly over the fewest children that can hold them, which keeps
+// every node at or above the minimum fill and packs the lower levels full.
+func (tr *BTreeG[T]) buildNode(items []T, childCap int) *node[T] {
+	if childCap == 0 {
+		n := tr.newNode(true)
+		n.items = make([]T, len(items))
+		copy(n.items, items)
+		n.count = len(items)
+		return n
+	}
+	nchildren := (len(items) + childCap + 1) / (childCap + 1)
+	grandCap := (childCap - tr.max) / (tr.max + 1)
+	n := tr.newNode(false)
+	n.items = make([]T, 0, nchildren-1)
+	*n.children = make([]*node[T], 0, nchildren)
+	n.count = len(items)
+	size := len(items) - (nchildren - 1)
+	for i := 0; i < nchildren; i++ {
+		m := size / nchildren
+		if i < size%nchildren {
+			m++
+		}
+		*n.children = append(*n.children, tr.buildNode(items[:m], grandCap))
+		items = items[m:]
+		if i < nchildren-1 {
+			n.items = append(n.items, items[0])
+			items = items[1:]
+		}
+	}
+	return n
 }
 
 // Generic BTree
@@ -1,12 +1,17 @@
 package btree
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
+	"reflect"
 	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -1982,3 +1987,1513 @@ func TestBenchmarkIteratorReuseWorks(t *testing.T) {
 		reusableIter.Release()
 	}
 }
+
+func TestGenericStats(t *testing.T) {
+	tr := testNewBTree()
+	stats := tr.Stats()
+	assert(stats.Height == 0 && stats.Items == 0 && stats.Nodes == 0)
+	N := 100_000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	stats = tr.Stats()
+	assert(stats.Height == tr.Height())
+	assert(stats.Items == N)
+	var count int
+	for _, n := range stats.Depths {
+		count += n
+	}
+	assert(count == N)
+	assert(stats.Depths[len(stats.Depths)-1] > stats.Depths[0])
+}
+
+func TestGenericTombstones(t *testing.T) {
+	tr := NewBTreeGOptions(testLess, Options{Tombstones: true})
+	N := 10_000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	tombs := func() (items []testKind) {
+		tr.Tombstones(func(item testKind) bool {
+			items = append(items, item)
+			return true
+		})
+		return items
+	}
+	assert(len(tombs()) == 0)
+	// deletes from every path
+	for i := 0; i < 100; i++ {
+		tr.Delete(testMakeItem(i * 7))
+	}
+	tr.PopMin()
+	tr.PopMax()
+	tr.DeleteAt(tr.Len() / 2)
+	tr.DeleteRange(testMakeItem(5000), testMakeItem(6000), nil)
+	tr.DeleteAscend(testMakeItem(8000), func(item testKind) Action {
+		if item%2 == 0 {
+			return Delete
+		}
+		return Keep
+	})
+	tr.sane()
+	items := tombs()
+	assert(len(items)+tr.Len() == N)
+	for i, item := range items {
+		_, ok := tr.Get(item)
+		assert(!ok)
+		assert(i == 0 || items[i-1] < item)
+	}
+	// setting an item removes its tombstone
+	tr.Set(items[0])
+	assert(len(tombs()) == len(items)-1)
+	// copies carry their own tombstones
+	tr2 := tr.Copy()
+	tr2.Compact()
+	tr2.Tombstones(func(item testKind) bool { panic("!") })
+	assert(len(tombs()) == len(items)-1)
+	tr.Compact()
+	assert(len(tombs()) == 0)
+	assert(tr.Len() == N-len(items)+1)
+	// clearing records every item, keeping the earlier tombstones
+	tr.Delete(items[0])
+	tr.Clear()
+	assert(tr.Len() == 0 && len(tombs()) == N-len(items)+1)
+	// trees without tombstone mode never record deletes
+	tr3 := testNewBTree()
+	tr3.Set(1)
+	tr3.Delete(1)
+	tr3.Tombstones(func(item testKind) bool { panic("!") })
+}
+
+func TestGenericCompact(t *testing.T) {
+	for _, degree := range []int{2, 3, 32} {
+		for n := 0; n < 1000; n += 1 + n/10 {
+			tr := NewBTreeGOptions(testLess, Options{Degree: degree})
+			for i := 0; i < n; i++ {
+				tr.Set(i)
+			}
+			tr.Compact()
+			tr.sane()
+			assert(tr.Len() == n)
+			for i := 0; i < n; i++ {
+				v, ok := tr.GetAt(i)
+				assert(ok && v == i)
+			}
+		}
+	}
+	tr := testNewBTree()
+	N := 100_000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	for _, key := range randKeys(N)[:N/2] {
+		tr.Delete(key)
+	}
+	before := tr.Stats()
+	tr2 := tr.Copy()
+	tr.Compact()
+	tr.sane()
+	tr2.sane()
+	after := tr.Stats()
+	assert(after.Items == before.Items && after.Nodes < before.Nodes)
+	leaf := after.Fill[len(after.Fill)-1]
+	assert(leaf > before.Fill[len(before.Fill)-1] && leaf > 0.95)
+	assert(tr2.Stats().Nodes == before.Nodes)
+	var items []testKind
+	tr2.Scan(func(item testKind) bool {
+		items = append(items, item)
+		return true
+	})
+	i := 0
+	tr.Scan(func(item testKind) bool {
+		assert(item == items[i])
+		i++
+		return true
+	})
+	assert(i == len(items))
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	tr.sane()
+	assert(tr.Len() == N)
+}
+
+func TestGenericAppendSorted(t *testing.T) {
+	tr := testNewBTree()
+	N := 100_000
+	var items []testKind
+	for i := 0; i < N; i++ {
+		items = append(items, i*2)
+	}
+	tr.AppendSorted(items[:N/2])
+	tr.sane()
+	tr2 := tr.Copy()
+	tr.AppendSorted(items[N/2:])
+	tr.sane()
+	tr2.sane()
+	assert(tr.Len() == N && tr2.Len() == N/2)
+	for i := 0; i < N; i++ {
+		v, ok := tr.GetAt(i)
+		assert(ok && v == i*2)
+	}
+	// out of order and existing items fall back to Set
+	tr.AppendSorted([]testKind{1, 3, 3, N * 2, N*2 + 1, 0})
+	tr.sane()
+	assert(tr.Len() == N+4)
+	v, _ := tr.Max()
+	assert(v == N*2+1)
+}
+
+func TestGenericAscendDescendRange(t *testing.T) {
+	tr := testNewBTree()
+	N := 10_000
+	for _, key := range randKeys(N) {
+		tr.Set(key * 2)
+	}
+	var items []testKind
+	collect := func(item testKind) bool {
+		items = append(items, item)
+		return true
+	}
+	tr.AscendRange(100, 200, collect)
+	assert(len(items) == 50 && items[0] == 100 && items[49] == 198)
+	items = nil
+	tr.AscendRange(101, 201, collect)
+	assert(len(items) == 50 && items[0] == 102 && items[49] == 200)
+	items = nil
+	tr.DescendRange(200, 100, collect)
+	assert(len(items) == 50 && items[0] == 200 && items[49] == 102)
+	items = nil
+	tr.DescendRange(201, 101, collect)
+	assert(len(items) == 50 && items[0] == 200 && items[49] == 102)
+	items = nil
+	tr.AscendRange(200, 100, collect)
+	tr.DescendRange(100, 200, collect)
+	assert(len(items) == 0)
+	var count int
+	tr.AscendRange(0, N*2, func(item testKind) bool {
+		count++
+		return count < 10
+	})
+	assert(count == 10)
+
+	// every bound within small trees, against a scan
+	for _, n := range []int{0, 1, 5, 100} {
+		tr := NewBTreeGOptions(testLess, Options{Degree: 2})
+		for _, key := range randKeys(n) {
+			tr.Set(key * 2)
+		}
+		for lo := -1; lo <= n*2+1; lo++ {
+			for hi := -1; hi <= n*2+1; hi++ {
+				var want []testKind
+				tr.Scan(func(item testKind) bool {
+					if item >= lo && item < hi {
+						want = append(want, item)
+					}
+					return true
+				})
+				items = nil
+				tr.AscendRange(lo, hi, collect)
+				assert(intsEqual(items, want))
+				want = want[:0]
+				tr.Reverse(func(item testKind) bool {
+					if item > lo && item <= hi {
+						want = append(want, item)
+					}
+					return true
+				})
+				items = nil
+				tr.DescendRange(hi, lo, collect)
+				assert(intsEqual(items, want))
+			}
+		}
+	}
+}
+
+func TestGenericDrain(t *testing.T) {
+	tr := testNewBTree()
+	N := 10_000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	tr2 := tr.Copy()
+	var items []testKind
+	tr.Drain(func(item testKind) bool {
+		items = append(items, item)
+		return len(items) < 100
+	})
+	tr.sane()
+	assert(len(items) == 100 && tr.Len() == N-100)
+	tr.Drain(func(item testKind) bool {
+		items = append(items, item)
+		return true
+	})
+	assert(len(items) == N && tr.Len() == 0)
+	for i, item := range items {
+		assert(item == i)
+	}
+	tr2.sane()
+	assert(tr2.Len() == N)
+}
+
+func TestGenericScanErr(t *testing.T) {
+	tr := testNewBTree()
+	for i := 0; i < 1000; i++ {
+		tr.Set(i)
+	}
+	errStop := errors.New("stop")
+	var count int
+	err := tr.ScanErr(func(item testKind) (bool, error) {
+		count++
+		if item == 10 {
+			return true, errStop
+		}
+		return true, nil
+	})
+	assert(err == errStop && count == 11)
+	count = 0
+	err = tr.AscendErr(500, func(item testKind) (bool, error) {
+		count++
+		return item < 509, nil
+	})
+	assert(err == nil && count == 10)
+	count = 0
+	err = tr.DescendErr(500, func(item testKind) (bool, error) {
+		count++
+		if item == 491 {
+			return false, errStop
+		}
+		return true, nil
+	})
+	assert(err == errStop && count == 10)
+	assert(tr.ScanErr(func(item testKind) (bool, error) {
+		return true, nil
+	}) == nil)
+}
+
+func TestGenericAllocStats(t *testing.T) {
+	tr := NewBTreeGOptions(testLess, Options{Degree: 4})
+	check := func() {
+		tr.sane()
+		assert(tr.ReadAllocStats().Live == uint64(tr.Stats().Nodes))
+	}
+	// detached subtrees are released by an estimate
+	checkEstimate := func() {
+		tr.sane()
+		live, nodes := tr.ReadAllocStats().Live, uint64(tr.Stats().Nodes)
+		assert(live >= nodes/2 && live <= nodes*2)
+	}
+	check()
+	N := 10_000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	check()
+	allocs := tr.ReadAllocStats()
+	assert(allocs.Allocs > 0 && allocs.Frees == 0)
+	tr2 := tr.Copy()
+	assert(tr2.ReadAllocStats().Live == allocs.Live)
+	for _, key := range randKeys(N)[:N/4] {
+		tr.Delete(key)
+	}
+	check()
+	assert(tr.ReadAllocStats().Frees > 0)
+	tr.DeleteRange(testMakeItem(N/4), testMakeItem(N/2), nil)
+	checkEstimate()
+	tr.DeleteAscend(testMakeItem(N/2), func(item testKind) Action {
+		if item%3 == 0 {
+			return Delete
+		}
+		return Keep
+	})
+	checkEstimate()
+	for tr.Len() > N/8 {
+		tr.PopMin()
+		tr.PopMax()
+		tr.DeleteAt(tr.Len() / 2)
+	}
+	checkEstimate()
+	tr.AppendSorted([]testKind{N, N + 1, N + 2})
+	checkEstimate()
+	// rebuilding makes it exact again
+	tr.Compact()
+	check()
+	for tr.Len() > 0 {
+		tr.PopMin()
+	}
+	check()
+	assert(tr.ReadAllocStats().Live == 0)
+	tr2.Clear()
+	allocs = tr2.ReadAllocStats()
+	assert(allocs.Live == 0 && allocs.Frees > 0)
+}
+
+func TestGenericScanCtx(t *testing.T) {
+	tr := testNewBTree()
+	N := 10_000
+	for i := 0; i < N; i++ {
+		tr.Set(i)
+	}
+	var count int
+	err := tr.ScanCtx(context.Background(), func(item testKind) bool {
+		count++
+		return true
+	})
+	assert(err == nil && count == N)
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	err = tr.AscendCtx(ctx, 100, func(item testKind) bool {
+		count++
+		if count == 1000 {
+			cancel()
+		}
+		return true
+	})
+	assert(err == context.Canceled)
+	assert(count >= 1000 && count < 1000+ctxCheckInterval)
+	err = tr.DescendCtx(ctx, 100, func(item testKind) bool { panic("!") })
+	assert(err == context.Canceled)
+}
+
+func TestGenericShuffleSeed(t *testing.T) {
+	batches := func(seed int64) (sizes []int) {
+		tr := NewBTreeGOptions(testLess, Options{ShuffleSeed: seed})
+		N := 10_000
+		for i := 0; i < N; i++ {
+			tr.Set(i)
+		}
+		for i := 0; i < N; i += 3 {
+			tr.Delete(i)
+		}
+		tr.sane()
+		var count int
+		tr.Walk(func(items []testKind) bool {
+			sizes = append(sizes, len(items))
+			count += len(items)
+			return true
+		})
+		assert(count == tr.Len())
+		i := 0
+		tr.Walk(func(items []testKind) bool {
+			for _, item := range items {
+				v, _ := tr.GetAt(i)
+				assert(item == v)
+				i++
+			}
+			return true
+		})
+		return sizes
+	}
+	a, b := batches(1), batches(1)
+	assert(reflect.DeepEqual(a, b))
+	assert(!reflect.DeepEqual(a, batches(2)))
+
+	// Set goes through the same hook as the other writes, so some sets
+	// force copy-on-write of the nodes they touch
+	tr := NewBTreeGOptions(testLess, Options{ShuffleSeed: 1})
+	var forced int
+	for i := 0; i < 100; i++ {
+		isoid := tr.isoid
+		tr.Set(i)
+		if tr.isoid != isoid {
+			forced++
+		}
+	}
+	assert(forced > 0 && forced < 100)
+	tr.sane()
+}
+
+func TestGenericScanPage(t *testing.T) {
+	tr := testNewBTree()
+	N := 1005
+	for _, key := range randKeys(N) {
+		tr.Set(key * 2)
+	}
+	var all []testKind
+	var after *testKind
+	var pages int
+	for {
+		page, next, more := tr.ScanPage(after, 100)
+		pages++
+		all = append(all, page...)
+		if !more {
+			break
+		}
+		assert(len(page) == 100 && next == page[99])
+		after = &next
+	}
+	assert(pages == 11 && len(all) == N)
+	for i, item := range all {
+		assert(item == i*2)
+	}
+	// the after item does not need to exist
+	x := 11
+	page, next, more := tr.ScanPage(&x, 2)
+	assert(len(page) == 2 && page[0] == 12 && next == 14 && more)
+	x = N * 2
+	page, _, more = tr.ScanPage(&x, 2)
+	assert(len(page) == 0 && !more)
+	page, _, more = tr.ScanPage(nil, 0)
+	assert(len(page) == 0 && !more)
+}
+
+func TestGenericAscendDescendRef(t *testing.T) {
+	type order struct {
+		id    int
+		price int
+	}
+	tr := NewBTreeG(func(a, b order) bool { return a.id < b.id })
+	N := 10_000
+	for _, i := range rand.Perm(N) {
+		tr.Set(order{i, i})
+	}
+	tr2 := tr.Copy()
+	var count int
+	tr.AscendRef(order{id: 1000}, func(item *order) bool {
+		if item.id >= 2000 {
+			return false
+		}
+		item.price *= 2
+		count++
+		return true
+	})
+	assert(count == 1000)
+	count = 0
+	tr.DescendRef(order{id: 999}, func(item *order) bool {
+		item.price = -1
+		count++
+		return true
+	})
+	assert(count == 1000)
+	tr.sane()
+	tr.Scan(func(item order) bool {
+		switch {
+		case item.id < 1000:
+			assert(item.price == -1)
+		case item.id < 2000:
+			assert(item.price == item.id*2)
+		default:
+			assert(item.price == item.id)
+		}
+		return true
+	})
+	tr2.Scan(func(item order) bool {
+		assert(item.price == item.id)
+		return true
+	})
+}
+
+func TestGenericScanReverseRef(t *testing.T) {
+	type order struct {
+		id    int
+		price int
+	}
+	tr := NewBTreeG(func(a, b order) bool { return a.id < b.id })
+	for _, i := range rand.Perm(1000) {
+		tr.Set(order{i, i})
+	}
+	tr.SetChecksum(func(item order) uint64 { return uint64(item.price) })
+	tr2 := tr.Copy()
+	var count int
+	tr.ScanRef(func(item *order) bool {
+		assert(item.id == count)
+		item.price++
+		count++
+		return true
+	})
+	assert(count == 1000)
+	tr.ReverseRef(func(item *order) bool {
+		count--
+		assert(item.id == count)
+		item.price *= 2
+		return count > 500
+	})
+	assert(count == 500)
+	tr.sane()
+	tr.Scan(func(item order) bool {
+		if item.id >= 500 {
+			assert(item.price == (item.id+1)*2)
+		} else {
+			assert(item.price == item.id+1)
+		}
+		return true
+	})
+	tr2.Scan(func(item order) bool {
+		assert(item.price == item.id)
+		return true
+	})
+}
+
+func TestGenericAscendLimit(t *testing.T) {
+	for _, degree := range []int{2, 32} {
+		tr := NewBTreeGOptions(testLess, Options{Degree: degree})
+		N := 2000
+		for _, key := range randKeys(N) {
+			tr.Set(key * 2)
+		}
+		for _, pivot := range []int{-1, 0, 1, 501, 1000, N*2 - 2, N * 2} {
+			for _, offset := range []int{0, 1, 7, 100, 1999, 2000} {
+				for _, limit := range []int{0, 1, 10, 3000} {
+					var exp []testKind
+					skip := offset
+					tr.Ascend(pivot, func(item testKind) bool {
+						if skip > 0 {
+							skip--
+							return true
+						}
+						if len(exp) == limit {
+							return false
+						}
+						exp = append(exp, item)
+						return true
+					})
+					var got []testKind
+					tr.AscendLimit(pivot, offset, limit, func(item testKind) bool {
+						got = append(got, item)
+						return true
+					})
+					assert(len(got) == len(exp))
+					for i := range got {
+						assert(got[i] == exp[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGenericIterSnapshot(t *testing.T) {
+	tr := testNewBTree()
+	N := 10_000
+	for i := 0; i < N; i++ {
+		tr.Set(i)
+	}
+	iter := tr.IterSnapshot()
+	assert(iter.First())
+	i := 0
+	for ok := true; ok; ok = iter.Next() {
+		assert(iter.Item() == i)
+		// writes do not block and are not visible to the iterator
+		tr.Delete(i + 1)
+		tr.Set(N + i)
+		i++
+	}
+	iter.Release()
+	assert(i == N)
+	tr.sane()
+	assert(tr.Len() == N)
+	v, _ := tr.Min()
+	assert(v == 0)
+}
+
+func TestGenericIndexOf(t *testing.T) {
+	tr := testNewBTree()
+	index, ok := tr.IndexOf(1)
+	assert(index == 0 && !ok)
+	N := 10_000
+	for _, key := range randKeys(N) {
+		tr.Set(key * 2)
+	}
+	for i := 0; i < N; i++ {
+		index, ok := tr.IndexOf(i * 2)
+		assert(index == i && ok)
+		v, _ := tr.GetAt(index)
+		assert(v == i*2)
+		index, ok = tr.IndexOf(i*2 + 1)
+		assert(index == i+1 && !ok)
+	}
+	index, ok = tr.IndexOf(-1)
+	assert(index == 0 && !ok)
+}
+
+func TestGenericCountRange(t *testing.T) {
+	tr := testNewBTree()
+	assert(tr.CountRange(0, 10) == 0)
+	N := 10_000
+	for _, key := range randKeys(N) {
+		tr.Set(key * 2)
+	}
+	assert(tr.CountRange(0, N*2) == N)
+	assert(tr.CountRange(-10, N*3) == N)
+	assert(tr.CountRange(100, 200) == 50)
+	assert(tr.CountRange(101, 201) == 50)
+	assert(tr.CountRange(100, 100) == 0)
+	assert(tr.CountRange(200, 100) == 0)
+	for i := 0; i < 100; i++ {
+		lo, hi := rand.Intn(N*2), rand.Intn(N*2)
+		var count int
+		tr.AscendRange(lo, hi, func(item testKind) bool {
+			count++
+			return true
+		})
+		assert(tr.CountRange(lo, hi) == count)
+	}
+}
+
+func TestGenericQuantile(t *testing.T) {
+	tr := testNewBTree()
+	_, ok := tr.Quantile(0.5)
+	assert(!ok)
+	N := 1000
+	for _, key := range randKeys(N) {
+		tr.Set(key + 1)
+	}
+	for _, c := range []struct {
+		q   float64
+		exp testKind
+	}{{0, 1}, {0.001, 1}, {0.5, 500}, {0.99, 990}, {0.999, 999}, {1, 1000}} {
+		v, ok := tr.Quantile(c.q)
+		assert(ok && v == c.exp)
+	}
+	for _, q := range []float64{-0.1, 1.1, math.NaN()} {
+		_, ok := tr.Quantile(q)
+		assert(!ok)
+	}
+}
+
+func TestGenericRand(t *testing.T) {
+	tr := testNewBTree()
+	rng := rand.New(rand.NewSource(1))
+	_, ok := tr.Rand(rng)
+	assert(!ok)
+	N := 10
+	for i := 0; i < N; i++ {
+		tr.Set(i)
+	}
+	counts := make([]int, N)
+	for i := 0; i < N*1000; i++ {
+		v, ok := tr.Rand(rng)
+		assert(ok)
+		counts[v]++
+	}
+	for _, count := range counts {
+		assert(count > 800 && count < 1200)
+	}
+}
+
+func TestGenericGetLEGE(t *testing.T) {
+	tr := testNewBTree()
+	_, ok := tr.GetLE(0)
+	assert(!ok)
+	N := 1000
+	for _, key := range randKeys(N) {
+		tr.Set(key * 2)
+	}
+	for i := -1; i <= N*2; i++ {
+		v, ok := tr.GetLE(i)
+		if i < 0 {
+			assert(!ok)
+		} else if i > (N-1)*2 {
+			assert(ok && v == (N-1)*2)
+		} else {
+			assert(ok && v == i/2*2)
+		}
+		v, ok = tr.GetGE(i)
+		if i > (N-1)*2 {
+			assert(!ok)
+		} else {
+			assert(ok && v == (i+1)/2*2)
+		}
+	}
+}
+
+func TestGenericPrevNext(t *testing.T) {
+	tr := testNewBTree()
+	_, ok := tr.Prev(0)
+	assert(!ok)
+	N := 1000
+	for _, key := range randKeys(N) {
+		tr.Set(key * 2)
+	}
+	for i := -1; i <= N*2; i++ {
+		v, ok := tr.Prev(i)
+		if i <= 0 {
+			assert(!ok)
+		} else if i > (N-1)*2 {
+			assert(ok && v == (N-1)*2)
+		} else {
+			assert(ok && v == (i-1)/2*2)
+		}
+		v, ok = tr.Next(i)
+		if i >= (N-1)*2 {
+			assert(!ok)
+		} else if i < 0 {
+			assert(ok && v == 0)
+		} else {
+			assert(ok && v == (i+2)/2*2)
+		}
+	}
+}
+
+func TestGenericMinNMaxN(t *testing.T) {
+	tr := testNewBTree()
+	assert(len(tr.MinN(10)) == 0)
+	N := 1000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	items := tr.MinN(10)
+	assert(len(items) == 10 && items[0] == 0 && items[9] == 9)
+	items = tr.MaxN(10)
+	assert(len(items) == 10 && items[0] == N-1 && items[9] == N-10)
+	assert(len(tr.MaxN(N*2)) == N && len(tr.MinN(0)) == 0)
+	items = tr.AppendMinN([]testKind{-1}, 2)
+	assert(len(items) == 3 && items[0] == -1 && items[2] == 1)
+	items = tr.AppendMaxN(items[:1], 1)
+	assert(len(items) == 2 && items[1] == N-1)
+}
+
+func TestGenericGetOrInsert(t *testing.T) {
+	type pair struct{ key, value int }
+	tr := NewBTreeG(func(a, b pair) bool { return a.key < b.key })
+	for i := 0; i < 1000; i++ {
+		actual, loaded := tr.GetOrInsert(pair{i, i})
+		assert(!loaded && actual == pair{i, i})
+	}
+	for i := 0; i < 1000; i++ {
+		actual, loaded := tr.GetOrInsert(pair{i, -1})
+		assert(loaded && actual == pair{i, i})
+	}
+	assert(tr.Len() == 1000)
+	v, _ := tr.Get(pair{key: 500})
+	assert(v.value == 500)
+}
+
+func TestGenericSetNXReplace(t *testing.T) {
+	type pair struct{ key, value int }
+	tr := NewBTreeG(func(a, b pair) bool { return a.key < b.key })
+	_, ok := tr.Replace(pair{1, 1})
+	assert(!ok && tr.Len() == 0)
+	for i := 0; i < 1000; i++ {
+		assert(tr.SetNX(pair{i, i}))
+		assert(!tr.SetNX(pair{i, -1}))
+	}
+	for i := 0; i < 1000; i++ {
+		prev, ok := tr.Replace(pair{i, -i})
+		assert(ok && prev == pair{i, i})
+	}
+	_, ok = tr.Replace(pair{1000, 0})
+	assert(!ok && tr.Len() == 1000)
+	v, _ := tr.Get(pair{key: 500})
+	assert(v.value == -500)
+}
+
+func TestGenericSetIf(t *testing.T) {
+	type versioned struct{ key, version int }
+	tr := NewBTreeG(func(a, b versioned) bool { return a.key < b.key })
+	_, ok := tr.SetIf(versioned{1, 1}, func(prev versioned) bool { return true })
+	assert(!ok && tr.Len() == 0)
+	tr.Set(versioned{1, 1})
+	update := func(v versioned, expect int) bool {
+		_, ok := tr.SetIf(v, func(prev versioned) bool {
+			return prev.version == expect
+		})
+		return ok
+	}
+	assert(update(versioned{1, 2}, 1))
+	assert(!update(versioned{1, 3}, 1))
+	assert(update(versioned{1, 3}, 2))
+	v, _ := tr.Get(versioned{key: 1})
+	assert(v.version == 3)
+}
+
+func TestGenericDeleteIf(t *testing.T) {
+	type versioned struct{ key, version int }
+	tr := NewBTreeG(func(a, b versioned) bool { return a.key < b.key })
+	for i := 0; i < 1000; i++ {
+		tr.Set(versioned{i, i % 2})
+	}
+	for i := 0; i < 1000; i++ {
+		_, ok := tr.DeleteIf(versioned{key: i}, func(prev versioned) bool {
+			return prev.version == 0
+		})
+		assert(ok == (i%2 == 0))
+	}
+	_, ok := tr.DeleteIf(versioned{key: 1000}, func(versioned) bool {
+		return true
+	})
+	assert(!ok && tr.Len() == 500)
+	tr.sane()
+}
+
+func TestGenericSetManyDeleteMany(t *testing.T) {
+	type pair struct{ key, value int }
+	tr := NewBTreeG(func(a, b pair) bool { return a.key < b.key })
+	N := 10000
+	var items []pair
+	for _, key := range randKeys(N) {
+		items = append(items, pair{key, 0})
+	}
+	first := items[0]
+	items = append(items, pair{first.key, 1})
+	assert(tr.SetMany(items) == N)
+	assert(items[0] == first)
+	v, _ := tr.Get(pair{key: first.key})
+	assert(tr.Len() == N && v.value == 1)
+	assert(tr.SetMany(items[:10]) == 0)
+	var keys []pair
+	for i := 0; i < N*2; i += 2 {
+		keys = append(keys, pair{key: i})
+	}
+	assert(tr.DeleteMany(keys) == N/2)
+	assert(tr.Len() == N/2)
+	tr.Scan(func(item pair) bool {
+		assert(item.key%2 == 1)
+		return true
+	})
+}
+
+func TestGenericCloneValue(t *testing.T) {
+	type account struct {
+		id      int
+		balance *int
+	}
+	tr := NewBTreeG(func(a, b account) bool { return a.id < b.id })
+	var clones int
+	tr.SetCloneValue(func(a account) account {
+		clones++
+		balance := *a.balance
+		return account{a.id, &balance}
+	})
+	for i := 0; i < 1000; i++ {
+		balance := i
+		tr.Set(account{i, &balance})
+	}
+	assert(clones == 0)
+	tr2 := tr.Copy()
+	a, ok := tr2.GetMut(account{id: 500})
+	assert(ok && clones > 0)
+	*a.balance = -1
+	a, _ = tr.Get(account{id: 500})
+	assert(*a.balance == 500)
+	a, _ = tr2.Get(account{id: 500})
+	assert(*a.balance == -1)
+	tr.SetCloneValue(nil)
+	tr3 := tr.Copy()
+	a, _ = tr3.GetMut(account{id: 10})
+	b, _ := tr.Get(account{id: 10})
+	assert(a.balance == b.balance)
+}
+
+func TestGenericDeleteFunc(t *testing.T) {
+	tr := testNewBTree()
+	for _, i := range randKeys(10000) {
+		tr.Set(i)
+	}
+	tr2 := tr.Copy()
+	assert(tr.DeleteFunc(func(item testKind) bool { return false }) == 0)
+	assert(tr.Len() == 10000)
+	assert(tr.DeleteFunc(func(item testKind) bool { return item%3 != 0 }) == 6666)
+	assert(tr.Len() == 3334)
+	tr.sane()
+	var i int
+	tr.Scan(func(item testKind) bool {
+		assert(item == testKind(i*3))
+		i++
+		return true
+	})
+	assert(i == 3334)
+	assert(tr2.Len() == 10000)
+	tr2.sane()
+	assert(tr.DeleteFunc(func(item testKind) bool { return true }) == 3334)
+	assert(tr.Len() == 0)
+	_, ok := tr.Min()
+	assert(!ok)
+	tr.Set(1)
+	assert(tr.Len() == 1)
+
+	tr3 := NewBTreeGOptions(testLess, Options{Tombstones: true})
+	for i := 0; i < 100; i++ {
+		tr3.Set(i)
+	}
+	tr3.DeleteFunc(func(item testKind) bool { return item < 10 })
+	var tombs int
+	tr3.Tombstones(func(item testKind) bool {
+		tombs++
+		return true
+	})
+	assert(tombs == 10)
+}
+
+func TestGenericRetain(t *testing.T) {
+	tr := testNewBTree()
+	for _, i := range randKeys(1000) {
+		tr.Set(i)
+	}
+	assert(tr.Retain(func(item testKind) bool { return item < 100 }) == 900)
+	assert(tr.Len() == 100)
+	tr.sane()
+	min, _ := tr.Min()
+	max, _ := tr.Max()
+	assert(min == 0 && max == 99)
+	assert(tr.Retain(func(item testKind) bool { return true }) == 0)
+	assert(tr.Len() == 100)
+}
+
+func TestGenericMaxItems(t *testing.T) {
+	tr := NewBTreeGOptions(testLess, Options{MaxItems: 100})
+	for i := 0; i < 100; i++ {
+		_, _, err := tr.TrySet(i * 2)
+		assert(err == nil)
+	}
+	_, _, err := tr.TrySet(1)
+	assert(err == ErrFull)
+	prev, replaced, err := tr.TrySet(10)
+	assert(err == nil && replaced && prev == 10)
+	assert(testPanics(func() { tr.Set(1) }))
+	assert(testPanics(func() { tr.Load(1000) }))
+	assert(testPanics(func() { tr.GetOrInsert(1) }))
+	assert(testPanics(func() { tr.SetMany([]int{1}) }))
+	assert(!testPanics(func() { tr.Set(4) }))
+	assert(tr.Len() == 100)
+	tr.Delete(0)
+	tr.Set(1)
+	assert(tr.Len() == 100)
+	tr.sane()
+
+	tr2 := NewBTreeGOptions(testLess, Options{MaxItems: 10})
+	assert(testPanics(func() { tr2.AppendSorted(randKeys(20)) }))
+	assert(tr2.Len() == 10)
+	tr2.sane()
+}
+
+func TestGenericTryReplace(t *testing.T) {
+	tr := NewBTreeG(func(a, b testPair) bool { return a.key < b.key })
+	tr.Set(testPair{1, 10})
+	prev, err := tr.TryReplace(testPair{1, 11})
+	assert(err == nil && prev == testPair{1, 10})
+	_, err = tr.TryReplace(testPair{2, 20})
+	assert(errors.Is(err, ErrKeyNotFound))
+	assert(tr.Len() == 1)
+	v, _ := tr.Get(testPair{key: 1})
+	assert(v.val == 11)
+	ro := NewBTreeGOptions(func(a, b testPair) bool { return a.key < b.key },
+		Options{ReadOnly: true})
+	_, err = ro.TryReplace(testPair{1, 10})
+	assert(err == ErrReadOnly)
+}
+
+func TestGenericExtractRange(t *testing.T) {
+	for _, degree := range []int{2, 32} {
+		tr := NewBTreeGOptions(testLess, Options{Degree: degree})
+		for _, i := range randKeys(10000) {
+			tr.Set(i)
+		}
+		tr2 := tr.Copy()
+		ext := tr.ExtractRange(2500, 7500)
+		assert(ext.Len() == 5000 && tr.Len() == 5000)
+		tr.sane()
+		ext.sane()
+		var i int
+		ext.Scan(func(item testKind) bool {
+			assert(item == testKind(i+2500))
+			i++
+			return true
+		})
+		assert(i == 5000)
+		_, ok := tr.Get(2500)
+		assert(!ok)
+		_, ok = tr.Get(7500)
+		assert(ok)
+		ext.Set(20000)
+		assert(ext.Len() == 5001 && tr.Len() == 5000 && tr2.Len() == 10000)
+		tr2.sane()
+		ext = tr.ExtractRange(20000, 30000)
+		assert(ext.Len() == 0 && tr.Len() == 5000)
+	}
+}
+
+func TestGenericLoadSorted(t *testing.T) {
+	for _, degree := range []int{2, 32} {
+		for _, n := range []int{0, 1, 10, 1000, 100000} {
+			items := make([]testKind, n)
+			for i := range items {
+				items[i] = testKind(i * 2)
+			}
+			tr := NewBTreeGOptions(testLess, Options{Degree: degree})
+			tr.LoadSorted(items)
+			assert(tr.Len() == n)
+			tr.sane()
+			tr.LoadSorted([]testKind{-1, n * 2, n*2 + 1})
+			assert(tr.Len() == n+3)
+			tr.sane()
+			var i int
+			tr.Scan(func(item testKind) bool {
+				if i > 0 && i <= n {
+					assert(item == testKind((i-1)*2))
+				}
+				i++
+				return true
+			})
+		}
+	}
+	tr := testNewBTree()
+	assert(testPanics(func() { tr.LoadSorted([]testKind{1, 3, 2}) }))
+	assert(testPanics(func() { tr.LoadSorted([]testKind{1, 1}) }))
+	assert(tr.Len() == 0)
+}
+
+func TestGenericBudget(t *testing.T) {
+	tr := testNewBTree()
+	for _, i := range randKeys(1000) {
+		tr.Set(i)
+	}
+	var count int
+	err := tr.ScanBudget(100, func(item testKind) bool {
+		count++
+		return true
+	})
+	assert(err == ErrBudgetExceeded && count == 100)
+	count = 0
+	err = tr.ScanBudget(1000, func(item testKind) bool {
+		count++
+		return true
+	})
+	assert(err == nil && count == 1000)
+	count = 0
+	err = tr.AscendBudget(990, 10, func(item testKind) bool {
+		count++
+		return true
+	})
+	assert(err == nil && count == 10)
+	err = tr.AscendBudget(990, 9, func(item testKind) bool { return true })
+	assert(err == ErrBudgetExceeded)
+	err = tr.DescendBudget(500, 50, func(item testKind) bool {
+		return item > 480
+	})
+	assert(err == nil)
+	err = tr.DescendBudget(500, 0, func(item testKind) bool { return true })
+	assert(err == ErrBudgetExceeded)
+}
+
+func TestGenericAppendItemsSlice(t *testing.T) {
+	tr := testNewBTree()
+	assert(len(tr.AppendItems(nil)) == 0)
+	assert(tr.Slice(0, 10) == nil)
+	for _, i := range randKeys(1000) {
+		tr.Set(i)
+	}
+	buf := make([]testKind, 0, 2000)
+	items := tr.AppendItems(buf[:1])
+	assert(len(items) == 1001 && &items[0] == &buf[:1][0])
+	for i := 0; i < 1000; i++ {
+		assert(items[i+1] == testKind(i))
+	}
+	s := tr.Slice(100, 250)
+	assert(len(s) == 150)
+	for i, item := range s {
+		assert(item == testKind(i+100))
+	}
+	assert(len(tr.Slice(-5, 5)) == 5)
+	assert(len(tr.Slice(990, 2000)) == 10)
+	assert(tr.Slice(500, 500) == nil)
+	assert(tr.Slice(2000, 3000) == nil)
+}
+
+func TestGenericCopyExactShape(t *testing.T) {
+	tr := NewBTreeGOptions(testLess, Options{Degree: 3})
+	for _, i := range randKeys(1000) {
+		tr.Set(i)
+	}
+	for i := 0; i < 1000; i += 3 {
+		tr.Delete(i)
+	}
+	tr2 := tr.CopyExactShape()
+	tr2.sane()
+	assert(reflect.DeepEqual(tr2.Stats(), tr.Stats()))
+	var shape func(a, b *node[testKind])
+	shape = func(a, b *node[testKind]) {
+		assert(a != b && len(a.items) == len(b.items) && a.leaf() == b.leaf())
+		for i := range a.items {
+			assert(a.items[i] == b.items[i])
+		}
+		if !a.leaf() {
+			for i := range *a.children {
+				shape((*a.children)[i], (*b.children)[i])
+			}
+		}
+	}
+	shape(tr.root, tr2.root)
+	tr2.Set(0)
+	assert(tr2.Len() == tr.Len()+1)
+	tr.sane()
+	tr2.sane()
+}
+
+type testSetter struct {
+	items []testKind
+}
+
+func (s *testSetter) Set(item testKind) (testKind, bool) {
+	s.items = append(s.items, item)
+	return 0, false
+}
+
+func TestGenericCopyTo(t *testing.T) {
+	tr := testNewBTree()
+	for _, i := range randKeys(1000) {
+		tr.Set(i)
+	}
+	dst := testNewBTree()
+	tr.CopyTo(dst)
+	assert(dst.Len() == 1000)
+	dst.sane()
+	rev := NewBTreeG(func(a, b testKind) bool { return a > b })
+	rev.Set(5000)
+	tr.CopyTo(rev)
+	assert(rev.Len() == 1001)
+	rev.sane()
+	var s testSetter
+	tr.CopyTo(&s)
+	assert(len(s.items) == 1000)
+	for i, item := range s.items {
+		assert(item == testKind(i))
+	}
+}
+
+func TestGenericOrdered(t *testing.T) {
+	tr := NewBTreeGOrdered[string]()
+	for _, s := range []string{"c", "a", "b"} {
+		tr.Set(s)
+	}
+	assert(strings.Join(tr.Items(), "") == "abc")
+	tr2 := NewBTreeGOrderedOptions[float64](Options{NoLocks: true, Degree: 2})
+	for _, i := range randKeys(100) {
+		tr2.Set(float64(i) / 2)
+	}
+	min, _ := tr2.Min()
+	max, _ := tr2.Max()
+	assert(tr2.Len() == 100 && min == 0 && max == 49.5)
+	tr2.sane()
+}
+
+func TestGenericSetDup(t *testing.T) {
+	type pair struct{ key, seq int }
+	tr := NewBTreeGOptions(func(a, b pair) bool { return a.key < b.key },
+		Options{NoLocks: true, Degree: 2})
+	const N, K = 1000, 10
+	for i, key := range randKeys(N) {
+		tr.SetDup(pair{key % K, i})
+	}
+	assert(tr.Len() == N && tr.saneheight() && tr.deepcount() == N)
+	prev := pair{key: -1}
+	tr.Scan(func(item pair) bool {
+		assert(prev.key < item.key || prev.key == item.key && prev.seq < item.seq)
+		prev = item
+		return true
+	})
+	for key := 0; key < K; key++ {
+		var seqs []int
+		tr.ScanDup(pair{key: key}, func(item pair) bool {
+			assert(item.key == key)
+			seqs = append(seqs, item.seq)
+			return true
+		})
+		assert(len(seqs) == N/K)
+		for len(seqs) > 0 {
+			item, ok := tr.DeleteOne(pair{key: key})
+			assert(ok && item.seq == seqs[0])
+			seqs = seqs[1:]
+		}
+		_, ok := tr.DeleteOne(pair{key: key})
+		assert(!ok)
+		assert(tr.saneheight() && tr.deepcount() == tr.Len())
+	}
+	assert(tr.Len() == 0)
+}
+
+func TestGenericScanWindow(t *testing.T) {
+	tr := testNewBTree()
+	var count int
+	tr.ScanPairs(func(prev, cur testKind) bool { count++; return true })
+	assert(count == 0)
+	for i := 0; i < 1000; i++ {
+		tr.Set(testKind(i))
+	}
+	tr.ScanPairs(func(prev, cur testKind) bool {
+		assert(cur == prev+1)
+		count++
+		return true
+	})
+	assert(count == 999)
+	for _, n := range []int{1, 2, 7, 1000, 1001} {
+		count = 0
+		tr.ScanWindow(n, func(window []testKind) bool {
+			assert(len(window) == n)
+			for i, item := range window {
+				assert(item == testKind(count+i))
+			}
+			count++
+			return true
+		})
+		if n <= 1000 {
+			assert(count == 1000-n+1)
+		} else {
+			assert(count == 0)
+		}
+	}
+	count = 0
+	tr.ScanWindow(3, func(window []testKind) bool {
+		count++
+		return count < 10
+	})
+	assert(count == 10)
+}
+
+func TestGenericNilEmpty(t *testing.T) {
+	for _, tr := range []*BTreeG[testKind]{nil, Empty[testKind]()} {
+		assert(tr.Len() == 0 && tr.Height() == 0)
+		_, ok := tr.Get(1)
+		assert(!ok)
+		_, ok = tr.Min()
+		assert(!ok)
+		_, ok = tr.Max()
+		assert(!ok)
+		_, ok = tr.GetAt(0)
+		assert(!ok)
+		_, ok = tr.GetLE(1)
+		assert(!ok)
+		tr.Scan(func(item testKind) bool { panic("unreachable") })
+		tr.Reverse(func(item testKind) bool { panic("unreachable") })
+		tr.Ascend(1, func(item testKind) bool { panic("unreachable") })
+		tr.Descend(1, func(item testKind) bool { panic("unreachable") })
+		assert(len(tr.Items()) == 0 && tr.CountRange(0, 10) == 0)
+		assert(tr.Stats().Items == 0)
+		iter := tr.Iter()
+		assert(!iter.First() && !iter.Last())
+		iter.Release()
+		assert(tr.Sane() == nil)
+	}
+	assert(Empty[testKind]() == Empty[testKind]())
+	assert(testPanics(func() { Empty[testKind]().Set(1) }))
+	assert(Empty[string]().Len() == 0)
+}
+
+func TestGenericMerge(t *testing.T) {
+	type pair struct{ key, val int }
+	less := func(a, b pair) bool { return a.key < b.key }
+	sum := func(a, b pair) pair { return pair{a.key, a.val + b.val} }
+	for _, m := range []int{0, 1, 10, 500, 2000} {
+		tr := NewBTreeG(less)
+		for i := 0; i < 1000; i++ {
+			tr.Set(pair{i * 2, 1})
+		}
+		other := NewBTreeG(less)
+		for i := 0; i < m; i++ {
+			other.Set(pair{i * 3, 10})
+		}
+		tr.Merge(other, sum)
+		tr.sane()
+		want := make(map[int]int)
+		for i := 0; i < 1000; i++ {
+			want[i*2] += 1
+		}
+		for i := 0; i < m; i++ {
+			want[i*3] += 10
+		}
+		assert(tr.Len() == len(want) && other.Len() == m)
+		tr.Scan(func(item pair) bool {
+			assert(want[item.key] == item.val)
+			return true
+		})
+	}
+	tr := NewBTreeG(less)
+	tr.Set(pair{1, 1})
+	tr.Merge(tr, nil)
+	assert(tr.Len() == 1)
+	other := NewBTreeG(less)
+	other.Set(pair{1, 2})
+	tr.Merge(other, nil)
+	item, _ := tr.Get(pair{key: 1})
+	assert(item.val == 2)
+
+	full := NewBTreeGOptions(less, Options{MaxItems: 100})
+	for i := 0; i < 100; i++ {
+		full.Set(pair{i, 0})
+	}
+	full.Merge(full.Copy(), nil)
+	other.Set(pair{1000, 0})
+	assert(testPanics(func() { full.Merge(other, nil) }))
+	assert(full.Len() == 100)
+}
+
+func TestGenericGetVersioned(t *testing.T) {
+	tr := testNewBTree()
+	for i := 0; i < 100; i++ {
+		tr.Set(testKind(i))
+	}
+	item, gen, ok := tr.GetVersioned(10)
+	assert(ok && item == 10 && gen == tr.Generation())
+	tr.Get(10)
+	tr.Scan(func(item testKind) bool { return true })
+	_, gen2, _ := tr.GetVersioned(20)
+	assert(gen2 == gen)
+	for _, write := range []func(){
+		func() { tr.Set(10) },
+		func() { tr.Set(1000) },
+		func() { tr.Delete(1000) },
+		func() { tr.Load(2000) },
+		func() { tr.DeleteAt(0) },
+		func() { tr.PopMax() },
+		func() { tr.SetDup(5) },
+		func() { tr.DeleteRange(50, 60, nil) },
+		func() { tr.Clear() },
+	} {
+		write()
+		assert(tr.Generation() != gen)
+		gen = tr.Generation()
+	}
+	noLocks := NewBTreeGOptions(testLess, Options{NoLocks: true})
+	gen = noLocks.Generation()
+	noLocks.Set(1)
+	assert(noLocks.Generation() != gen)
+	_, gen, ok = (*BTreeG[testKind])(nil).GetVersioned(1)
+	assert(!ok && gen == 0)
+}
+
+func TestGenericSplit(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000} {
+		tr := NewBTreeGOptions(testLess, Options{Degree: 3})
+		for _, i := range randKeys(n) {
+			tr.Set(testKind(i * 2))
+		}
+		for _, key := range []testKind{-1, 0, 1, testKind(n), testKind(n + 1),
+			testKind(n * 2)} {
+			left, right := tr.Split(key)
+			left.sane()
+			right.sane()
+			assert(tr.Len() == n && left.Len()+right.Len() == n)
+			left.Scan(func(item testKind) bool {
+				assert(item < key)
+				return true
+			})
+			right.Scan(func(item testKind) bool {
+				assert(item >= key)
+				return true
+			})
+			if max, ok := left.Max(); ok {
+				assert(max == (key-1)/2*2)
+			}
+			left.Set(-100)
+			right.Set(testKind(n * 10))
+			assert(tr.Len() == n)
+			tr.sane()
+		}
+	}
+	tr := NewBTreeGOptions(testLess, Options{Tombstones: true})
+	for i := 0; i < 100; i++ {
+		tr.Set(testKind(i))
+	}
+	left, right := tr.Split(50)
+	var tombs int
+	left.Tombstones(func(item testKind) bool { tombs++; return true })
+	right.Tombstones(func(item testKind) bool { tombs++; return true })
+	assert(tombs == 0 && left.Len() == 50 && right.Len() == 50)
+
+	// concurrent writes never put items on the wrong side
+	tr = testNewBTree()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10000; i++ {
+			tr.Set(testKind(i))
+		}
+		done <- true
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		left, right := tr.Split(5000)
+		max, ok := left.Max()
+		assert(!ok || max < 5000)
+		min, ok := right.Min()
+		assert(!ok || min >= 5000)
+	}
+}
+
+func TestGenericJoin(t *testing.T) {
+	sizes := []int{0, 1, 2, 5, 20, 100, 1000, 5000}
+	for _, degree := range []int{2, 3, 32} {
+		for _, n := range sizes {
+			for _, m := range sizes {
+				tr := NewBTreeGOptions(testLess, Options{Degree: degree})
+				other := NewBTreeGOptions(testLess, Options{Degree: degree})
+				for i := 0; i < n; i++ {
+					tr.Set(testKind(i))
+				}
+				for i := 0; i < m; i++ {
+					other.Set(testKind(n + i))
+				}
+				tr.Join(other)
+				tr.sane()
+				assert(tr.Len() == n+m && other.Len() == m)
+				var i int
+				tr.Scan(func(item testKind) bool {
+					assert(item == testKind(i))
+					i++
+					return true
+				})
+				assert(i == n+m)
+				other.sane()
+				tr.Set(-1)
+				other.Delete(testKind(n))
+				tr.sane()
+				other.sane()
+				_, ok := tr.Get(testKind(n))
+				assert(tr.Len() == n+m+1 && (ok || m == 0))
+			}
+		}
+	}
+	tr := NewBTreeGOptions(testLess, Options{Degree: 3})
+	for _, i := range randKeys(3000) {
+		tr.Set(testKind(i))
+	}
+	for i := 0; i < 50; i++ {
+		left, right := tr.Split(testKind(rand.Intn(3000)))
+		left.Join(right)
+		left.sane()
+		assert(reflect.DeepEqual(left.Items(), tr.Items()))
+	}
+	tr = testNewBTree()
+	tr.Set(10)
+	other := testNewBTree()
+	other.Set(10)
+	assert(testPanics(func() { tr.Join(other) }))
+	assert(tr.Len() == 1)
+}
+
+func TestGenericAscendFilter(t *testing.T) {
+	tr := NewBTreeGOptions(testLess, Options{Degree: 3})
+	for _, i := range randKeys(1000) {
+		tr.Set(testKind(i))
+	}
+	even := func(item testKind) bool { return item%2 == 0 }
+	for _, pivot := range []testKind{-1, 0, 1, 500, 501, 999, 1000} {
+		var items []testKind
+		tr.AscendFilter(pivot, even, func(item testKind) bool {
+			items = append(items, item)
+			return true
+		})
+		var expect []testKind
+		tr.Ascend(pivot, func(item testKind) bool {
+			if even(item) {
+				expect = append(expect, item)
+			}
+			return true
+		})
+		assert(reflect.DeepEqual(items, expect))
+	}
+	var count int
+	tr.AscendFilter(100, even, func(item testKind) bool {
+		assert(item == testKind(100+count*2))
+		count++
+		return count < 10
+	})
+	assert(count == 10)
+	assert(testPanics(func() {
+		tr.AscendFilterAugmented(0, func(any) bool { return false }, even,
+			func(testKind) bool { return true })
+	}))
+}
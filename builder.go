@@ -0,0 +1,124 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// Builder builds a tree from a stream of items in strictly ascending order,
+// such as rows read from a database cursor, without first collecting the
+// items into a slice.
+//
+// The tree is built bottom-up in O(n). Only the rightmost node of each level
+// is open at any time, so the builder holds no more than the tree itself.
+type Builder[T any] struct {
+	tr     *BTreeG[T]
+	levels []*node[T] // open node of each level, leaves first
+	last   T
+	count  int
+}
+
+// NewBuilder returns a new Builder for a tree that uses the less function.
+func NewBuilder[T any](less func(a, b T) bool) *Builder[T] {
+	return NewBuilderOptions(less, Options{})
+}
+
+// NewBuilderOptions returns a new Builder for a tree that is created with
+// the provided options.
+func NewBuilderOptions[T any](less func(a, b T) bool, opts Options,
+) *Builder[T] {
+	return &Builder[T]{tr: NewBTreeGOptions(less, opts)}
+}
+
+// Len returns the number of items appended so far.
+func (b *Builder[T]) Len() int {
+	return b.count
+}
+
+// Append an item, which must be greater than the previously appended item.
+// Panics if the item is out of order, or with ErrFull if the tree would
+// exceed Options.MaxItems.
+func (b *Builder[T]) Append(item T) {
+	if b.count > 0 && !b.tr.less(b.last, item) {
+		panic("items out of order")
+	}
+	if b.tr.maxItems > 0 && b.count == b.tr.maxItems {
+		panic(ErrFull)
+	}
+	b.add(0, item, nil)
+	b.last = item
+	b.count++
+}
+
+// add appends an item to the open node at level, along with the child to
+// the left of the item for levels above the leaves. When the open node is
+// full, it's closed and the item moves up to the next level as the
+// separator between the closed node and a new open node.
+func (b *Builder[T]) add(level int, item T, child *node[T]) {
+	if level == len(b.levels) {
+		b.levels = append(b.levels, b.tr.newNode(level == 0))
+	}
+	n := b.levels[level]
+	if child != nil {
+		*n.children = append(*n.children, child)
+	}
+	if len(n.items) == b.tr.max {
+		n.updateCount()
+		b.levels[level] = b.tr.newNode(level == 0)
+		b.add(level+1, item, n)
+		return
+	}
+	n.items = append(n.items, item)
+}
+
+// Finish returns the tree holding all appended items. The builder is reset
+// and may be used to build another tree.
+func (b *Builder[T]) Finish() *BTreeG[T] {
+	tr := b.tr
+	if b.count > 0 {
+		// Attach the open nodes along the right edge of the tree.
+		top := len(b.levels) - 1
+		for level := 0; level < top; level++ {
+			parent := b.levels[level+1]
+			*parent.children = append(*parent.children, b.levels[level])
+		}
+		// Move items into the open nodes that are underfull from their full
+		// left siblings. This goes top-down, because an open node may be the
+		// only child of its parent until the parent has been filled.
+		for level := top - 1; level >= 0; level-- {
+			n, parent := b.levels[level], b.levels[level+1]
+			if len(n.items) < tr.min {
+				left := (*parent.children)[len(*parent.children)-2]
+				tr.rebalanceRight(left, parent, n)
+			}
+		}
+		for level := 0; level <= top; level++ {
+			b.levels[level].updateCount()
+		}
+		tr.root = b.levels[top]
+		tr.count = b.count
+	}
+	*b = Builder[T]{tr: tr.emptyCopy()}
+	return tr
+}
+
+// rebalanceRight evenly spreads the items of the left node, the last item of
+// the parent, and the items of the right node, which is the last child of
+// the parent, over the left and right nodes.
+func (tr *BTreeG[T]) rebalanceRight(left, parent, right *node[T]) {
+	sep := len(parent.items) - 1
+	items := make([]T, 0, len(left.items)+1+len(right.items))
+	items = append(items, left.items...)
+	items = append(items, parent.items[sep])
+	items = append(items, right.items...)
+	k := (len(items) - 1) / 2
+	left.items = append([]T(nil), items[:k]...)
+	parent.items[sep] = items[k]
+	right.items = append([]T(nil), items[k+1:]...)
+	if !left.leaf() {
+		children := make([]*node[T], 0, len(items)+1)
+		children = append(children, *left.children...)
+		children = append(children, *right.children...)
+		*left.children = append([]*node[T](nil), children[:k+1]...)
+		*right.children = append([]*node[T](nil), children[k+1:]...)
+	}
+	left.updateCount()
+}
@@ -0,0 +1,36 @@
+package btree
+
+import "testing"
+
+func TestBuilder(t *testing.T) {
+	for _, degree := range []int{2, 3, 32} {
+		b := NewBuilderOptions(testLess, Options{Degree: degree})
+		for n := 0; n < 3000; n += 1 + n/7 {
+			for i := 0; i < n; i++ {
+				b.Append(i * 2)
+			}
+			assert(b.Len() == n)
+			tr := b.Finish()
+			assert(tr.Len() == n && b.Len() == 0)
+			tr.sane()
+			var i int
+			tr.Scan(func(item testKind) bool {
+				assert(item == testKind(i*2))
+				i++
+				return true
+			})
+			assert(i == n)
+			tr.Set(1)
+			tr.Delete(0)
+			tr.sane()
+		}
+	}
+	b := NewBuilder(testLess)
+	b.Append(1)
+	assert(testPanics(func() { b.Append(1) }))
+	assert(testPanics(func() { b.Append(0) }))
+	b = NewBuilderOptions(testLess, Options{MaxItems: 2})
+	b.Append(1)
+	b.Append(2)
+	assert(testPanics(func() { b.Append(3) }))
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// BytesMap is an ordered map with []byte keys, which are compared using
+// bytes.Compare, so no less function is needed.
+//
+// Set copies the key, leaving the caller free to reuse its buffer. SetNoCopy
+// adopts the caller's slice instead, which avoids the copy for callers that
+// allocate a fresh key for every insert. The adopted slice belongs to the map
+// from then on, and must not be modified until the key has been deleted.
+// Use CheckKeys in tests to catch keys that were modified in place.
+type BytesMap[V any] struct {
+	tr *BTreeG[bytesEntry[V]]
+}
+
+type bytesEntry[V any] struct {
+	key   []byte
+	value V
+}
+
+// NewBytesMap returns a new BytesMap.
+func NewBytesMap[V any](opts Options) *BytesMap[V] {
+	return &BytesMap[V]{
+		tr: NewBTreeGOptions(func(a, b bytesEntry[V]) bool {
+			return bytes.Compare(a.key, b.key) < 0
+		}, opts),
+	}
+}
+
+// Set a value for a copy of key.
+func (m *BytesMap[V]) Set(key []byte, value V) (V, bool) {
+	return m.set(append([]byte(nil), key...), value)
+}
+
+// SetNoCopy sets a value for key, without copying it. The map takes
+// ownership of the key, which must not be modified afterwards.
+func (m *BytesMap[V]) SetNoCopy(key []byte, value V) (V, bool) {
+	return m.set(key, value)
+}
+
+func (m *BytesMap[V]) set(key []byte, value V) (V, bool) {
+	prev, replaced := m.tr.Set(bytesEntry[V]{key, value})
+	return prev.value, replaced
+}
+
+// Get a value for key. The key is not retained.
+func (m *BytesMap[V]) Get(key []byte) (V, bool) {
+	e, ok := m.tr.Get(bytesEntry[V]{key: key})
+	return e.value, ok
+}
+
+// Delete the value for key. The key is not retained.
+func (m *BytesMap[V]) Delete(key []byte) (V, bool) {
+	e, ok := m.tr.Delete(bytesEntry[V]{key: key})
+	return e.value, ok
+}
+
+// Len returns the number of keys in the map.
+func (m *BytesMap[V]) Len() int {
+	return m.tr.Len()
+}
+
+// Scan iterates over all keys in order. The keys are owned by the map and
+// must not be modified.
+func (m *BytesMap[V]) Scan(iter func(key []byte, value V) bool) {
+	m.tr.Scan(func(e bytesEntry[V]) bool {
+		return iter(e.key, e.value)
+	})
+}
+
+// Ascend iterates over the keys that are greater than or equal to pivot.
+// The keys are owned by the map and must not be modified.
+func (m *BytesMap[V]) Ascend(pivot []byte, iter func(key []byte, value V) bool) {
+	m.tr.Ascend(bytesEntry[V]{key: pivot}, func(e bytesEntry[V]) bool {
+		return iter(e.key, e.value)
+	})
+}
+
+// Descend iterates over the keys that are less than or equal to pivot, in
+// reverse order. The keys are owned by the map and must not be modified.
+func (m *BytesMap[V]) Descend(pivot []byte, iter func(key []byte, value V) bool,
+) {
+	m.tr.Descend(bytesEntry[V]{key: pivot}, func(e bytesEntry[V]) bool {
+		return iter(e.key, e.value)
+	})
+}
+
+// CheckKeys returns an error if the keys are no longer in strictly ascending
+// order, which happens when a key that was adopted by SetNoCopy is modified
+// in place. It visits every key, so it's meant for tests and debugging.
+func (m *BytesMap[V]) CheckKeys() error {
+	var prev []byte
+	var i int
+	var err error
+	m.tr.Scan(func(e bytesEntry[V]) bool {
+		if i > 0 && bytes.Compare(prev, e.key) >= 0 {
+			err = fmt.Errorf("key %d out of order: %q", i, e.key)
+			return false
+		}
+		prev = e.key
+		i++
+		return true
+	})
+	return err
+}
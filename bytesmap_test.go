@@ -0,0 +1,48 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBytesMap(t *testing.T) {
+	m := NewBytesMap[int](Options{})
+	buf := make([]byte, 0, 16)
+	for _, i := range randKeys(1000) {
+		buf = fmt.Appendf(buf[:0], "key:%04d", i)
+		_, replaced := m.Set(buf, i)
+		assert(!replaced)
+	}
+	assert(m.Len() == 1000 && m.CheckKeys() == nil)
+	v, ok := m.Get([]byte("key:0500"))
+	assert(ok && v == 500)
+	var n int
+	m.Scan(func(key []byte, value int) bool {
+		assert(string(key) == fmt.Sprintf("key:%04d", n) && value == n)
+		n++
+		return true
+	})
+	assert(n == 1000)
+	var keys []string
+	m.Ascend([]byte("key:0998"), func(key []byte, value int) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert(len(keys) == 2 && keys[0] == "key:0998")
+	keys = keys[:0]
+	m.Descend([]byte("key:0001x"), func(key []byte, value int) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert(len(keys) == 2 && keys[0] == "key:0001")
+
+	key := []byte("key:0250")
+	prev, replaced := m.SetNoCopy(key, -1)
+	assert(replaced && prev == 250)
+	copy(key, "key:9999") // breaks the ownership contract
+	assert(m.CheckKeys() != nil)
+	copy(key, "key:0250")
+	assert(m.CheckKeys() == nil)
+	v, ok = m.Delete([]byte("key:0250"))
+	assert(ok && v == -1 && m.Len() == 999)
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"sync"
+	"time"
+)
+
+// Options for passing to the NewCache function.
+type CacheOptions[K ordered, V any] struct {
+	// Capacity is the maximum number of entries. When the cache is full the
+	// entry that is closest to expiring is evicted. Zero means unbounded.
+	Capacity int
+	// TTL is how long an entry is fresh after it's set. Zero means entries
+	// never go stale, and are evicted in the order they were set.
+	TTL time.Duration
+	// MaxStale is how long a stale entry continues to be served after its
+	// TTL has passed, giving Refresh a chance to replace it.
+	MaxStale time.Duration
+	// Refresh, if provided, is called in its own goroutine when a stale entry
+	// is served. The returned value replaces the entry, unless an error is
+	// returned. At most one refresh runs per entry at a time.
+	Refresh func(key K, stale V) (V, error)
+}
+
+// Cache is an ordered key-value cache with time-based expiration, a
+// capacity bound, and stale-while-revalidate refreshing.
+// It's safe for concurrent use by multiple goroutines.
+type Cache[K ordered, V any] struct {
+	mu        sync.Mutex
+	opts      CacheOptions[K, V]
+	entries   *BTreeG[*cacheEntry[K, V]] // ordered by key
+	expires   *BTreeG[*cacheEntry[K, V]] // ordered by expires, then seq
+	seq       uint64
+	refreshes sync.WaitGroup
+	closed    bool
+	now       func() time.Time
+}
+
+type cacheEntry[K ordered, V any] struct {
+	key        K
+	value      V
+	stale      time.Time
+	expires    time.Time
+	seq        uint64
+	refreshing bool
+}
+
+// NewCache returns a new Cache.
+func NewCache[K ordered, V any](opts CacheOptions[K, V]) *Cache[K, V] {
+	topts := Options{NoLocks: true}
+	return &Cache[K, V]{
+		opts: opts,
+		entries: NewBTreeGOptions(func(a, b *cacheEntry[K, V]) bool {
+			return a.key < b.key
+		}, topts),
+		expires: NewBTreeGOptions(func(a, b *cacheEntry[K, V]) bool {
+			if !a.expires.Equal(b.expires) {
+				return a.expires.Before(b.expires)
+			}
+			return a.seq < b.seq
+		}, topts),
+		now: time.Now,
+	}
+}
+
+// expire removes all entries that expired at or before now.
+func (c *Cache[K, V]) expire(now time.Time) {
+	if c.opts.TTL == 0 {
+		return
+	}
+	for {
+		e, ok := c.expires.Min()
+		if !ok || e.expires.After(now) {
+			return
+		}
+		c.expires.PopMin()
+		c.entries.Delete(e)
+	}
+}
+
+func (c *Cache[K, V]) set(key K, value V, now time.Time) {
+	if e, ok := c.entries.Get(&cacheEntry[K, V]{key: key}); ok {
+		c.expires.Delete(e)
+		c.entries.Delete(e)
+	}
+	for c.opts.Capacity > 0 && c.entries.Len() >= c.opts.Capacity {
+		e, _ := c.expires.PopMin()
+		c.entries.Delete(e)
+	}
+	c.seq++
+	e := &cacheEntry[K, V]{key: key, value: value, seq: c.seq}
+	if c.opts.TTL != 0 {
+		e.stale = now.Add(c.opts.TTL)
+		e.expires = e.stale.Add(c.opts.MaxStale)
+	}
+	c.entries.Set(e)
+	c.expires.Set(e)
+}
+
+// Set the value for a key, replacing any existing entry.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.expire(now)
+	c.set(key, value, now)
+}
+
+// Get the value for a key.
+// Returns false if the key was not found or its entry has expired.
+// A stale entry is still returned, and triggers a Refresh if one was
+// provided.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.expire(now)
+	e, ok := c.entries.Get(&cacheEntry[K, V]{key: key})
+	if !ok {
+		var empty V
+		return empty, false
+	}
+	if c.opts.TTL != 0 && !now.Before(e.stale) && c.opts.Refresh != nil &&
+		!e.refreshing && !c.closed {
+		e.refreshing = true
+		c.refreshes.Add(1)
+		go c.refresh(e)
+	}
+	return e.value, true
+}
+
+func (c *Cache[K, V]) refresh(e *cacheEntry[K, V]) {
+	defer c.refreshes.Done()
+	value, err := c.opts.Refresh(e.key, e.value)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refreshing = false
+	if err != nil {
+		return
+	}
+	now := c.now()
+	c.expire(now)
+	if cur, ok := c.entries.Get(e); ok && cur == e {
+		// only replace the entry that was refreshed, not one that has since
+		// been set or deleted
+		c.set(e.key, value, now)
+	}
+}
+
+// Delete the entry for a key.
+// Returns false if the key was not found or its entry has expired.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(c.now())
+	e, ok := c.entries.Delete(&cacheEntry[K, V]{key: key})
+	if ok {
+		c.expires.Delete(e)
+	}
+	return ok
+}
+
+// Len returns the number of entries that have not expired.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(c.now())
+	return c.entries.Len()
+}
+
+// Ascend the entries that have not expired within the range [pivot, last],
+// in key order. Stale entries are included but are not refreshed.
+// Return false to stop iterating.
+func (c *Cache[K, V]) Ascend(pivot K, iter func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(c.now())
+	c.entries.Ascend(&cacheEntry[K, V]{key: pivot},
+		func(e *cacheEntry[K, V]) bool {
+			return iter(e.key, e.value)
+		})
+}
+
+// Close stops starting refreshes and waits for the running ones to return.
+// The cache can still be used after it's closed, but stale entries are no
+// longer refreshed.
+func (c *Cache[K, V]) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.refreshes.Wait()
+}
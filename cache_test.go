@@ -0,0 +1,122 @@
+package btree
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var calls int
+	var fail bool
+	c := NewCache(CacheOptions[int, string]{
+		Capacity: 3,
+		TTL:      time.Second,
+		MaxStale: time.Second,
+		Refresh: func(key int, stale string) (string, error) {
+			calls++
+			if fail {
+				return "", errors.New("refresh failed")
+			}
+			return stale + "!", nil
+		},
+	})
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "a")
+	now = now.Add(time.Millisecond)
+	c.Set(2, "b")
+	now = now.Add(time.Millisecond)
+	c.Set(3, "c")
+	now = now.Add(time.Millisecond)
+	c.Set(4, "d")
+	assert(c.Len() == 3)
+	_, ok := c.Get(1)
+	assert(!ok)
+	var keys []int
+	c.Ascend(0, func(key int, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert(len(keys) == 3 && keys[0] == 2 && keys[2] == 4)
+
+	// stale entries are served and refreshed
+	now = now.Add(time.Second)
+	v, ok := c.Get(2)
+	assert(ok && v == "b")
+	c.refreshes.Wait()
+	assert(calls == 1)
+	v, _ = c.Get(2)
+	assert(v == "b!")
+	assert(calls == 1)
+
+	// failed refreshes are retried on the next get
+	fail = true
+	v, _ = c.Get(3)
+	c.refreshes.Wait()
+	assert(v == "c" && calls == 2)
+	v, _ = c.Get(3)
+	c.refreshes.Wait()
+	assert(v == "c" && calls == 3)
+
+	// entries expire after their stale period, except for the refreshed one
+	now = now.Add(time.Second)
+	assert(c.Len() == 1)
+	v, ok = c.Get(2)
+	assert(ok && v == "b!")
+	assert(c.Delete(2))
+	assert(!c.Delete(2))
+	assert(c.Len() == 0)
+}
+
+func TestCacheNoTTL(t *testing.T) {
+	c := NewCache(CacheOptions[string, int]{Capacity: 2})
+	c.Set("c", 1)
+	c.Set("b", 2)
+	c.Set("a", 3)
+	_, ok := c.Get("c")
+	assert(!ok)
+	v, ok := c.Get("a")
+	assert(ok && v == 3)
+	c.now = func() time.Time { return time.Now().Add(time.Hour) }
+	assert(c.Len() == 2)
+}
+
+func TestCacheClose(t *testing.T) {
+	release := make(chan struct{})
+	c := NewCache(CacheOptions[int, int]{
+		TTL:      time.Second,
+		MaxStale: time.Second,
+		Refresh: func(key int, stale int) (int, error) {
+			<-release
+			return stale + 1, nil
+		},
+	})
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+	c.Set(1, 1)
+	now = now.Add(time.Second)
+	c.Get(1)
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close returned before the refresh")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	v, _ := c.Get(1)
+	assert(v == 2)
+
+	// no refreshes are started after close
+	now = now.Add(time.Second)
+	c.Get(1)
+	c.refreshes.Wait()
+	v, _ = c.Get(1)
+	assert(v == 2)
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import "fmt"
+
+// itemSum is the checksum of a stored item.
+type itemSum[T any] struct {
+	item T
+	sum  uint64
+}
+
+// SetChecksum enables a debug mode that detects items which are modified in
+// place after they were stored, such as through a pointer or a shared slice.
+//
+// The sum function must return a checksum, or any other fingerprint, of the
+// contents of an item. It is called for every item that is stored, and again
+// whenever an item is read by Get, Min, Max, GetAt, or by the Scan, Ascend,
+// Descend and Reverse families of functions. A read panics when the checksum
+// of the item no longer matches the one recorded when it was stored.
+//
+// Items read through the Mut functions may be modified by the caller, so
+// their checksums are recorded again on their next read.
+//
+// Checksums are recorded by key, so this mode can't be used with the
+// duplicate items stored by SetDup. Enabling it on a tree that holds
+// duplicates panics, as does SetDup once it's enabled.
+//
+// This mode is slow and is meant for tests. Pass nil to disable it.
+func (tr *BTreeG[T]) SetChecksum(sum func(item T) uint64) {
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	if sum == nil {
+		tr.sum, tr.sums = nil, nil
+		return
+	}
+	if tr.root != nil {
+		var prev T
+		var dup, started bool
+		tr.nodeScan(&tr.root, func(item T) bool {
+			dup = started && !tr.less(prev, item)
+			prev, started = item, true
+			return !dup
+		}, false)
+		if dup {
+			panic("SetChecksum with duplicate items")
+		}
+	}
+	less := tr.less
+	// The checksums have their own lock, because reads record the checksums
+	// of items that are missing one while holding a shared lock. They are
+	// stored as any, because a tree of itemSum[T] inside a tree of T would
+	// be an instantiation cycle.
+	tr.sums = NewBTreeG(func(a, b any) bool {
+		return less(a.(itemSum[T]).item, b.(itemSum[T]).item)
+	})
+	tr.sum = sum
+	if tr.root != nil {
+		tr.nodeScan(&tr.root, func(item T) bool {
+			tr.checkSet(item)
+			return true
+		}, false)
+	}
+}
+
+// checkSet records the checksum of an item that is being stored.
+func (tr *BTreeG[T]) checkSet(item T) {
+	if tr.sum != nil {
+		tr.sums.Set(itemSum[T]{item, tr.sum(item)})
+	}
+}
+
+// checkDelete forgets the checksum of an item that is being deleted.
+func (tr *BTreeG[T]) checkDelete(item T) {
+	if tr.sum != nil {
+		tr.sums.Delete(itemSum[T]{item: item})
+	}
+}
+
+// checkRead verifies the checksum of an item that is being read.
+func (tr *BTreeG[T]) checkRead(item T, mut bool) {
+	if tr.sum == nil {
+		return
+	}
+	if mut {
+		tr.sums.Delete(itemSum[T]{item: item})
+		return
+	}
+	sum := tr.sum(item)
+	prev, ok := tr.sums.Get(itemSum[T]{item: item})
+	if !ok {
+		tr.sums.Set(itemSum[T]{item, sum})
+	} else if prev.(itemSum[T]).sum != sum {
+		panic(fmt.Sprintf("item modified after it was stored: %v", item))
+	}
+}
+
+// checkIter wraps iter to verify the checksum of every item.
+func (tr *BTreeG[T]) checkIter(iter func(item T) bool, mut bool,
+) func(item T) bool {
+	if tr.sum == nil {
+		return iter
+	}
+	return func(item T) bool {
+		tr.checkRead(item, mut)
+		return iter(item)
+	}
+}
+
+// checkRefIter wraps iter to record the checksum of every item again after
+// it may have been updated in place.
+func (tr *BTreeG[T]) checkRefIter(iter func(item *T) bool) func(item *T) bool {
+	if tr.sum == nil {
+		return iter
+	}
+	return func(item *T) bool {
+		ok := iter(item)
+		tr.checkSet(*item)
+		return ok
+	}
+}
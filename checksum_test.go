@@ -0,0 +1,96 @@
+package btree
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+type testCounter struct {
+	key   int
+	count *int
+}
+
+func testCounterSum(item testCounter) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(item.key), byte(*item.count)})
+	return h.Sum64()
+}
+
+func testPanics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
+
+func TestChecksum(t *testing.T) {
+	tr := NewBTreeG(func(a, b testCounter) bool { return a.key < b.key })
+	counts := make([]int, 100)
+	for i := 0; i < 50; i++ {
+		tr.Set(testCounter{i, &counts[i]})
+	}
+	tr.SetChecksum(testCounterSum)
+	for i := 50; i < 100; i++ {
+		tr.Set(testCounter{i, &counts[i]})
+	}
+	tr.Scan(func(item testCounter) bool { return true })
+
+	// modified in place
+	counts[10]++
+	assert(testPanics(func() { tr.Get(testCounter{key: 10}) }))
+	assert(testPanics(func() { tr.Scan(func(item testCounter) bool { return true }) }))
+	assert(!testPanics(func() { tr.Get(testCounter{key: 11}) }))
+
+	// replaced
+	tr.Set(testCounter{10, &counts[10]})
+	assert(!testPanics(func() { tr.Scan(func(item testCounter) bool { return true }) }))
+
+	// modified after a mut read
+	item, _ := tr.GetMut(testCounter{key: 20})
+	*item.count++
+	assert(!testPanics(func() { tr.Get(testCounter{key: 20}) }))
+
+	// deleted and set again after being modified
+	tr.Delete(testCounter{key: 30})
+	counts[30]++
+	tr.Set(testCounter{30, &counts[30]})
+	assert(!testPanics(func() { tr.Get(testCounter{key: 30}) }))
+
+	// copies
+	tr2 := tr.Copy()
+	counts[99]++
+	assert(testPanics(func() { tr2.Max() }))
+	assert(testPanics(func() { tr.Max() }))
+
+	tr.SetChecksum(nil)
+	assert(!testPanics(func() { tr.Max() }))
+}
+
+func TestChecksumSetDup(t *testing.T) {
+	tr := NewBTreeG(func(a, b testCounter) bool { return a.key < b.key })
+	counts := make([]int, 2)
+	tr.SetChecksum(testCounterSum)
+	tr.Set(testCounter{1, &counts[0]})
+	assert(testPanics(func() { tr.SetDup(testCounter{1, &counts[1]}) }))
+	assert(tr.Len() == 1)
+	assert(!testPanics(func() { tr.Scan(func(item testCounter) bool { return true }) }))
+
+	tr.SetChecksum(nil)
+	tr.SetDup(testCounter{1, &counts[1]})
+	assert(testPanics(func() { tr.SetChecksum(testCounterSum) }))
+	assert(!testPanics(func() { tr.Scan(func(item testCounter) bool { return true }) }))
+	assert(tr.Len() == 2)
+}
+
+func TestChecksumDeleteRange(t *testing.T) {
+	tr := NewBTreeG(testLess)
+	tr.SetChecksum(func(item testKind) uint64 { return uint64(item) })
+	for i := 0; i < 10000; i++ {
+		tr.Set(i)
+	}
+	// the checksums of detached subtrees are forgotten with them
+	tr.DeleteRange(100, 9900, &DeleteRangeOptions{NoReturn: true})
+	assert(tr.Len() == 200 && tr.sums.Len() == 200)
+	tr.sane()
+}
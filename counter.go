@@ -0,0 +1,243 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"hash/maphash"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// counterShards is the number of shards of a CounterTree.
+const counterShards = 16
+
+// CounterTree is a set of int64 counters ordered by key, for metrics such as
+// requests by endpoint.
+// The counters are spread over shards by the hash of their key, each with
+// its own lock, so increments of different keys rarely contend. Every shard
+// keeps the sums of its subtrees as aggregates, which makes Sum O(log n).
+// It's safe for concurrent use by multiple goroutines.
+type CounterTree[K ordered] struct {
+	hash   func(key K) uint64
+	shards [counterShards]counterShard[K]
+}
+
+type counterShard[K ordered] struct {
+	mu sync.RWMutex
+	tr *BTreeG[counterEntry[K]]
+}
+
+type counterEntry[K ordered] struct {
+	key   K
+	value int64
+}
+
+// NewCounterTree returns a new empty CounterTree.
+func NewCounterTree[K ordered]() *CounterTree[K] {
+	c := &CounterTree[K]{hash: counterHash[K]()}
+	agg := &Aggregator[counterEntry[K]]{
+		Sum: func(a, b counterEntry[K]) counterEntry[K] {
+			return counterEntry[K]{value: a.value + b.value}
+		},
+	}
+	for i := range c.shards {
+		// the shard lock guards the tree
+		c.shards[i].tr = NewBTreeGOptions(func(a, b counterEntry[K]) bool {
+			return a.key < b.key
+		}, Options{NoLocks: true})
+		c.shards[i].tr.SetAggregator(agg)
+	}
+	return c
+}
+
+// counterHash returns the hash function for keys of type K. The type is
+// resolved here rather than for every key, so built-in key types are hashed
+// without reflection. Named key types are read through reflect by their
+// kind.
+func counterHash[K ordered]() func(key K) uint64 {
+	seed := maphash.MakeSeed()
+	salt := maphash.String(seed, "")
+	num := func(x uint64) uint64 {
+		// the splitmix64 finalizer
+		x ^= salt
+		x ^= x >> 30
+		x *= 0xbf58476d1ce4e5b9
+		x ^= x >> 27
+		x *= 0x94d049bb133111eb
+		return x ^ x>>31
+	}
+	float := func(f float64) uint64 {
+		if f == 0 {
+			// -0 and +0 are the same key
+			f = 0
+		}
+		return num(math.Float64bits(f))
+	}
+	var zero K
+	switch any(zero).(type) {
+	case string:
+		return func(k K) uint64 { return maphash.String(seed, any(k).(string)) }
+	case int:
+		return func(k K) uint64 { return num(uint64(any(k).(int))) }
+	case int8:
+		return func(k K) uint64 { return num(uint64(any(k).(int8))) }
+	case int16:
+		return func(k K) uint64 { return num(uint64(any(k).(int16))) }
+	case int32:
+		return func(k K) uint64 { return num(uint64(any(k).(int32))) }
+	case int64:
+		return func(k K) uint64 { return num(uint64(any(k).(int64))) }
+	case uint:
+		return func(k K) uint64 { return num(uint64(any(k).(uint))) }
+	case uint8:
+		return func(k K) uint64 { return num(uint64(any(k).(uint8))) }
+	case uint16:
+		return func(k K) uint64 { return num(uint64(any(k).(uint16))) }
+	case uint32:
+		return func(k K) uint64 { return num(uint64(any(k).(uint32))) }
+	case uint64:
+		return func(k K) uint64 { return num(any(k).(uint64)) }
+	case uintptr:
+		return func(k K) uint64 { return num(uint64(any(k).(uintptr))) }
+	case float32:
+		return func(k K) uint64 { return float(float64(any(k).(float32))) }
+	case float64:
+		return func(k K) uint64 { return float(any(k).(float64)) }
+	}
+	switch reflect.TypeOf(zero).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return func(k K) uint64 { return num(uint64(reflect.ValueOf(k).Int())) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return func(k K) uint64 { return num(reflect.ValueOf(k).Uint()) }
+	case reflect.Float32, reflect.Float64:
+		return func(k K) uint64 { return float(reflect.ValueOf(k).Float()) }
+	default:
+		return func(k K) uint64 {
+			return maphash.String(seed, reflect.ValueOf(k).String())
+		}
+	}
+}
+
+// shard returns the shard that holds the counter for key.
+func (c *CounterTree[K]) shard(key K) *counterShard[K] {
+	return &c.shards[c.hash(key)%counterShards]
+}
+
+// Incr adds delta to the counter for key, creating it if needed.
+// Returns the new value.
+func (c *CounterTree[K]) Incr(key K, delta int64) int64 {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, _ := s.tr.Get(counterEntry[K]{key: key})
+	e.key = key
+	e.value += delta
+	s.tr.Set(e)
+	return e.value
+}
+
+// Get returns the value of the counter for key.
+// Returns false if there is no counter for key.
+func (c *CounterTree[K]) Get(key K) (int64, bool) {
+	s := c.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.tr.Get(counterEntry[K]{key: key})
+	return e.value, ok
+}
+
+// Delete the counter for key.
+// Returns the final value of the counter or false if there was no counter
+// for key.
+func (c *CounterTree[K]) Delete(key K) (int64, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.tr.Delete(counterEntry[K]{key: key})
+	return e.value, ok
+}
+
+// Len returns the number of counters.
+func (c *CounterTree[K]) Len() int {
+	var n int
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.RLock()
+		n += s.tr.Len()
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Scan all counters in key order.
+// Return false to stop iterating.
+func (c *CounterTree[K]) Scan(iter func(key K, value int64) bool) {
+	c.ascend(nil, iter)
+}
+
+// Ascend the counters within the range [pivot, last], in key order.
+// Return false to stop iterating.
+func (c *CounterTree[K]) Ascend(pivot K, iter func(key K, value int64) bool) {
+	c.ascend(&pivot, iter)
+}
+
+// ascend merges the shards in key order, starting at pivot, or at the first
+// counter when pivot is nil. All shards are read locked while iterating so
+// that the counters are seen at a single point in time.
+func (c *CounterTree[K]) ascend(pivot *K,
+	iter func(key K, value int64) bool,
+) {
+	var iters [counterShards]IterG[counterEntry[K]]
+	var ok [counterShards]bool
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		iters[i] = s.tr.Iter()
+		defer iters[i].Release()
+		if pivot == nil {
+			ok[i] = iters[i].First()
+		} else {
+			ok[i] = iters[i].Seek(counterEntry[K]{key: *pivot})
+		}
+	}
+	for {
+		j := -1
+		for i := range iters {
+			if ok[i] && (j < 0 || iters[i].Item().key < iters[j].Item().key) {
+				j = i
+			}
+		}
+		if j < 0 {
+			return
+		}
+		e := iters[j].Item()
+		if !iter(e.key, e.value) {
+			return
+		}
+		ok[j] = iters[j].Next()
+	}
+}
+
+// Sum returns the total of the counters within the range
+// [greaterOrEqual, lessThan), in O(log n) using the aggregates of the
+// shards.
+func (c *CounterTree[K]) Sum(greaterOrEqual, lessThan K) int64 {
+	if !(greaterOrEqual < lessThan) {
+		return 0
+	}
+	lo := counterEntry[K]{key: greaterOrEqual}
+	hi := counterEntry[K]{key: lessThan}
+	var sum int64
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.RLock()
+		sum += s.tr.AggregateRange(lo, hi).value
+		s.mu.RUnlock()
+	}
+	return sum
+}
@@ -0,0 +1,113 @@
+package btree
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestCounterTree(t *testing.T) {
+	c := NewCounterTree[int]()
+	_, ok := c.Get(1)
+	assert(!ok)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Incr(j%10, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert(c.Len() == 10)
+	for i := 0; i < 10; i++ {
+		v, ok := c.Get(i)
+		assert(ok && v == 800)
+	}
+	assert(c.Incr(3, -300) == 500)
+	assert(c.Sum(0, 10) == 7700)
+	assert(c.Sum(2, 4) == 1300)
+	assert(c.Sum(4, 2) == 0)
+	var keys []int
+	c.Ascend(8, func(key int, value int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert(len(keys) == 2 && keys[0] == 8 && keys[1] == 9)
+	v, ok := c.Delete(3)
+	assert(ok && v == 500)
+	_, ok = c.Delete(3)
+	assert(!ok)
+	var sum int64
+	c.Scan(func(key int, value int64) bool {
+		sum += value
+		return true
+	})
+	assert(c.Len() == 9 && sum == 7200)
+}
+
+func TestCounterTreeShards(t *testing.T) {
+	c := NewCounterTree[string]()
+	keys := randKeys(1000)
+	var want int64
+	for i, k := range keys {
+		c.Incr(fmt.Sprint(k), int64(i))
+		want += int64(i)
+	}
+	assert(c.Len() == 1000 && c.Sum("", "~") == want)
+	var prev string
+	var n int
+	c.Scan(func(key string, value int64) bool {
+		assert(n == 0 || prev < key)
+		prev = key
+		n++
+		return true
+	})
+	assert(n == 1000)
+
+	// increments racing with deletes must not be lost after the delete
+	f := NewCounterTree[float64]()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			f.Incr(1, 1)
+		}
+	}()
+	var deleted int64
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			v, _ := f.Delete(1)
+			deleted += v
+		}
+	}()
+	wg.Wait()
+	v, _ := f.Get(1)
+	assert(v+deleted == 1000)
+	f.Incr(math.Copysign(0, -1), 5)
+	v, ok := f.Get(0)
+	assert(ok && v == 5)
+}
+
+func TestCounterTreeHash(t *testing.T) {
+	type id int
+	ids := NewCounterTree[id]()
+	for i := 0; i < 100; i++ {
+		ids.Incr(id(i), 1)
+		ids.Incr(id(i), 1)
+	}
+	assert(ids.Len() == 100 && ids.Sum(0, 100) == 200)
+
+	// hashing built-in keys doesn't allocate
+	c := NewCounterTree[int]()
+	c.Incr(1000, 1)
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Incr(1000, 1)
+	})
+	assert(allocs == 0)
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// ScanCursor is an ascending scan over a frozen snapshot of a tree that may
+// be stopped and resumed, including from another process.
+//
+// The last emitted item is available from Checkpoint. Saving it and later
+// passing it to ResumeScan continues the scan right after it. When the tree
+// that is resumed holds the same items as the original snapshot, such as a
+// tree restored from a backup taken with BackupTo, every item is emitted
+// exactly once over all runs.
+type ScanCursor[T any] struct {
+	tr      *BTreeG[T]
+	last    T
+	started bool
+	done    bool
+}
+
+// NewScan returns a cursor positioned before the first item of a
+// copy-on-write snapshot of the tree. Changes made to the tree afterwards are
+// not seen by the cursor.
+func (tr *BTreeG[T]) NewScan() *ScanCursor[T] {
+	return &ScanCursor[T]{tr: tr.Copy()}
+}
+
+// ResumeScan returns a cursor over a copy-on-write snapshot of the tree that
+// is positioned after the checkpointed item.
+func (tr *BTreeG[T]) ResumeScan(last T) *ScanCursor[T] {
+	return &ScanCursor[T]{tr: tr.Copy(), last: last, started: true}
+}
+
+// Scan continues the scan, calling iter for each remaining item until iter
+// returns false. Every item passed to iter counts as emitted, even when iter
+// returns false for it.
+// Returns true once all items have been emitted.
+func (c *ScanCursor[T]) Scan(iter func(item T) bool) bool {
+	if c.done {
+		return true
+	}
+	done := true
+	next := func(item T) bool {
+		c.last, c.started = item, true
+		if !iter(item) {
+			done = false
+			return false
+		}
+		return true
+	}
+	if !c.started {
+		c.tr.Scan(next)
+	} else {
+		last := c.last
+		c.tr.Ascend(last, func(item T) bool {
+			if !c.tr.less(last, item) {
+				return true // already emitted
+			}
+			return next(item)
+		})
+	}
+	c.done = done
+	return done
+}
+
+// Checkpoint returns the last emitted item.
+// Returns false if no items have been emitted.
+func (c *ScanCursor[T]) Checkpoint() (last T, ok bool) {
+	return c.last, c.started
+}
@@ -0,0 +1,54 @@
+package btree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScanCursor(t *testing.T) {
+	tr := NewBTreeG(func(a, b int) bool { return a < b })
+	for _, i := range randKeys(1000) {
+		tr.Set(i * 2)
+	}
+	var buf bytes.Buffer
+	assert(tr.BackupTo(&buf, encodeInt, nil) == nil)
+
+	c := tr.NewScan()
+	_, ok := c.Checkpoint()
+	assert(!ok)
+	var items []int
+	done := c.Scan(func(item int) bool {
+		items = append(items, item)
+		return len(items) < 100
+	})
+	assert(!done && len(items) == 100)
+	last, ok := c.Checkpoint()
+	assert(ok && last == 198)
+
+	// changes after the cursor was created are not seen
+	tr.Set(199)
+	tr.Delete(200)
+	assert(!c.Scan(func(item int) bool {
+		items = append(items, item)
+		return len(items) < 300
+	}))
+	assert(len(items) == 300 && items[100] == 200)
+
+	// resume against a restored snapshot
+	last, _ = c.Checkpoint()
+	tr2 := NewBTreeG(func(a, b int) bool { return a < b })
+	assert(tr2.Restore(&buf, decodeInt, nil) == nil)
+	c = tr2.ResumeScan(last)
+	for !c.Scan(func(item int) bool {
+		items = append(items, item)
+		return len(items)%77 != 0
+	}) {
+		last, _ = c.Checkpoint()
+		c = tr2.ResumeScan(last)
+	}
+	assert(len(items) == 1000)
+	for i, item := range items {
+		assert(item == i*2)
+	}
+	assert(c.Scan(func(item int) bool { panic("unreachable") }))
+}
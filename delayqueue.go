@@ -0,0 +1,148 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"sync"
+	"time"
+)
+
+// DelayQueue holds items until their ready time, for scheduling retries,
+// timeouts and other deferred work. Items with the same ready time are
+// popped in the order they were pushed.
+// It's safe for concurrent use by multiple goroutines.
+type DelayQueue[T any] struct {
+	mu    sync.Mutex
+	items *BTreeG[delayEntry[T]]
+	seq   uint64
+	ready chan struct{}
+	timer *time.Timer
+	armed bool      // the timer is pending
+	next  time.Time // the ready time the timer is armed for
+}
+
+type delayEntry[T any] struct {
+	ready time.Time
+	seq   uint64
+	item  T
+}
+
+// NewDelayQueue returns a new empty DelayQueue.
+func NewDelayQueue[T any]() *DelayQueue[T] {
+	return &DelayQueue[T]{
+		items: NewBTreeGOptions(func(a, b delayEntry[T]) bool {
+			if !a.ready.Equal(b.ready) {
+				return a.ready.Before(b.ready)
+			}
+			return a.seq < b.seq
+		}, Options{NoLocks: true}),
+	}
+}
+
+// Push an item that becomes ready at the provided time.
+func (q *DelayQueue[T]) Push(ready time.Time, item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	q.items.Set(delayEntry[T]{ready, q.seq, item})
+	q.arm()
+}
+
+// PopReady removes and returns all items that are ready at or before now, in
+// ready time order.
+func (q *DelayQueue[T]) PopReady(now time.Time) []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []T
+	for {
+		e, ok := q.items.Min()
+		if !ok || e.ready.After(now) {
+			break
+		}
+		q.items.PopMin()
+		items = append(items, e.item)
+	}
+	q.arm()
+	return items
+}
+
+// Next returns the ready time of the earliest item.
+// Returns false if the queue is empty.
+func (q *DelayQueue[T]) Next() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.items.Min()
+	return e.ready, ok
+}
+
+// Len returns the number of items in the queue.
+func (q *DelayQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// Ready returns a channel that receives a value when the earliest item in
+// the queue becomes ready. Receivers should call PopReady, which may return
+// no items if another goroutine already popped them.
+//
+//	for range q.Ready() {
+//		for _, item := range q.PopReady(time.Now()) {
+//			...
+//		}
+//	}
+func (q *DelayQueue[T]) Ready() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+		q.arm()
+	}
+	return q.ready
+}
+
+// arm schedules a signal on the ready channel for the earliest item. Does
+// nothing until Ready has been called. The queue must be locked.
+func (q *DelayQueue[T]) arm() {
+	if q.ready == nil {
+		return
+	}
+	e, ok := q.items.Min()
+	if !ok {
+		if q.armed {
+			q.timer.Stop()
+			q.armed = false
+		}
+		return
+	}
+	if q.armed && q.next.Equal(e.ready) {
+		return
+	}
+	q.armed = true
+	q.next = e.ready
+	if q.timer == nil {
+		q.timer = time.AfterFunc(time.Until(e.ready), q.fire)
+	} else {
+		q.timer.Reset(time.Until(e.ready))
+	}
+}
+
+func (q *DelayQueue[T]) fire() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.armed = false
+	e, ok := q.items.Min()
+	if !ok {
+		return
+	}
+	if e.ready.After(time.Now()) {
+		// the timer fired early or the earliest item changed
+		q.arm()
+		return
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,54 @@
+package btree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayQueue(t *testing.T) {
+	q := NewDelayQueue[int]()
+	_, ok := q.Next()
+	assert(!ok)
+	start := time.Unix(0, 0)
+	for i := 9; i >= 0; i-- {
+		q.Push(start.Add(time.Duration(i/2)*time.Second), i)
+	}
+	assert(q.Len() == 10)
+	next, ok := q.Next()
+	assert(ok && next.Equal(start))
+	assert(len(q.PopReady(start.Add(-time.Second))) == 0)
+	items := q.PopReady(start.Add(time.Second))
+	assert(len(items) == 4)
+	// same ready time pops in push order
+	assert(items[0] == 1 && items[1] == 0 && items[2] == 3 && items[3] == 2)
+	items = q.PopReady(start.Add(time.Hour))
+	assert(len(items) == 6 && items[5] == 8)
+	assert(q.Len() == 0)
+}
+
+func TestDelayQueueReady(t *testing.T) {
+	q := NewDelayQueue[string]()
+	ready := q.Ready()
+	now := time.Now()
+	q.Push(now.Add(time.Hour), "later")
+	q.Push(now.Add(20*time.Millisecond), "soon")
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	items := q.PopReady(time.Now())
+	assert(len(items) == 1 && items[0] == "soon")
+	select {
+	case <-ready:
+		t.Fatal("unexpected ready")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.PopReady(now.Add(time.Hour))
+	q.Push(now, "past")
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// DiffOp is the kind of a difference that is reported by Diff.
+type DiffOp int
+
+const (
+	// DiffAdded is an item that is only in the other tree.
+	DiffAdded DiffOp = iota
+	// DiffRemoved is an item that is only in the tree.
+	DiffRemoved
+	// DiffChanged is an item of the other tree that replaced a different
+	// item with the same key.
+	DiffChanged
+)
+
+// Diff calls fn, in key order, for every difference between the tree and
+// other, which must have the same order. Items with equal keys are reported
+// as changed when equal returns false for them. Pass nil for equal to never
+// report changed items. Return false from fn to stop.
+//
+// Trees that were created from each other using Copy share the nodes that
+// neither tree has modified since. Shared subtrees are skipped without being
+// visited, so diffing a tree with a copy costs about the number of changes,
+// rather than the number of items. Both trees are read from copy-on-write
+// snapshots and are not locked while fn is called.
+func (tr *BTreeG[T]) Diff(other *BTreeG[T], equal func(a, b T) bool,
+	fn func(op DiffOp, item T) bool,
+) {
+	a, b := tr.Copy(), other.Copy()
+	if a == nil {
+		if b == nil {
+			return
+		}
+		a = b.emptyCopy()
+	} else if b == nil {
+		b = a.emptyCopy()
+	}
+	ca, cb := newDiffCursor(a.root), newDiffCursor(b.root)
+	for {
+		na, itemA, okA := ca.peek()
+		nb, itemB, okB := cb.peek()
+		switch {
+		case !okA && !okB:
+			return
+		case na != nil && na == nb:
+			// shared subtree
+			ca.next()
+			cb.next()
+		case na != nil && (nb == nil || na.count >= nb.count):
+			ca.expand()
+			if nb != nil && nb.count == na.count {
+				cb.expand()
+			}
+		case nb != nil:
+			cb.expand()
+		case !okB || okA && a.less(itemA, itemB):
+			if !fn(DiffRemoved, itemA) {
+				return
+			}
+			ca.next()
+		case !okA || a.less(itemB, itemA):
+			if !fn(DiffAdded, itemB) {
+				return
+			}
+			cb.next()
+		default:
+			if equal != nil && !equal(itemA, itemB) {
+				if !fn(DiffChanged, itemB) {
+					return
+				}
+			}
+			ca.next()
+			cb.next()
+		}
+	}
+}
+
+// diffCursor walks a tree as a sequence of elements, where each element is
+// either an item or a whole subtree that may be expanded into its own
+// elements.
+type diffCursor[T any] struct {
+	stack []diffFrame[T]
+}
+
+// diffFrame is a position in the elements of a node. The elements of a
+// branch alternate between children and items, starting with a child.
+type diffFrame[T any] struct {
+	n *node[T]
+	i int
+}
+
+// newDiffCursor returns a cursor whose only element is the subtree at root.
+func newDiffCursor[T any](root *node[T]) *diffCursor[T] {
+	c := new(diffCursor[T])
+	if root != nil {
+		// A single child branch that holds the root as its only element.
+		children := []*node[T]{root}
+		c.stack = append(c.stack, diffFrame[T]{&node[T]{children: &children}, 0})
+	}
+	return c
+}
+
+// peek returns the next element, which is a subtree when n is not nil, or
+// false when there are no elements left.
+func (c *diffCursor[T]) peek() (n *node[T], item T, ok bool) {
+	for len(c.stack) > 0 {
+		f := &c.stack[len(c.stack)-1]
+		if f.n.leaf() {
+			if f.i < len(f.n.items) {
+				return nil, f.n.items[f.i], true
+			}
+		} else if f.i < 2*len(f.n.items)+1 {
+			if f.i%2 == 0 {
+				return (*f.n.children)[f.i/2], item, true
+			}
+			return nil, f.n.items[f.i/2], true
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return nil, item, false
+}
+
+// next skips the next element.
+func (c *diffCursor[T]) next() {
+	c.stack[len(c.stack)-1].i++
+}
+
+// expand replaces the next element, which must be a subtree, with the
+// elements of the subtree.
+func (c *diffCursor[T]) expand() {
+	f := &c.stack[len(c.stack)-1]
+	n := (*f.n.children)[f.i/2]
+	f.i++
+	c.stack = append(c.stack, diffFrame[T]{n, 0})
+}
@@ -0,0 +1,95 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type testDiff struct {
+	op   DiffOp
+	item testPair
+}
+
+type testPair struct{ key, val int }
+
+func testDiffs(a, b *BTreeG[testPair]) []testDiff {
+	var diffs []testDiff
+	a.Diff(b, func(a, b testPair) bool { return a == b },
+		func(op DiffOp, item testPair) bool {
+			diffs = append(diffs, testDiff{op, item})
+			return true
+		})
+	return diffs
+}
+
+func TestDiff(t *testing.T) {
+	var compares int
+	less := func(a, b testPair) bool {
+		compares++
+		return a.key < b.key
+	}
+	for _, degree := range []int{2, 3, 32} {
+		tr := NewBTreeGOptions(less, Options{Degree: degree})
+		for _, i := range randKeys(10000) {
+			tr.Set(testPair{i * 2, 0})
+		}
+		tr2 := tr.Copy()
+		assert(len(testDiffs(tr, tr2)) == 0)
+		want := make(map[int]testDiff)
+		for i := 0; i < 50; i++ {
+			key := rand.Intn(20000)
+			switch rand.Intn(3) {
+			case 0:
+				if prev, ok := tr2.Delete(testPair{key: key}); ok {
+					if d, ok := want[key]; ok && d.op == DiffAdded {
+						delete(want, key)
+					} else {
+						orig, _ := tr.Get(prev)
+						want[key] = testDiff{DiffRemoved, orig}
+					}
+				}
+			default:
+				item := testPair{key, i + 1}
+				_, found := tr.Get(item)
+				tr2.Set(item)
+				if d, ok := want[key]; ok && d.op == DiffAdded || !found {
+					want[key] = testDiff{DiffAdded, item}
+				} else {
+					want[key] = testDiff{DiffChanged, item}
+				}
+			}
+		}
+		compares = 0
+		diffs := testDiffs(tr, tr2)
+		assert(compares < 5000)
+		assert(len(diffs) == len(want))
+		for i, d := range diffs {
+			assert(want[d.item.key] == d)
+			if i > 0 {
+				assert(diffs[i-1].item.key < d.item.key)
+			}
+		}
+		// the reverse diff swaps added and removed items
+		for _, d := range testDiffs(tr2, tr) {
+			w := want[d.item.key]
+			assert(d.op == DiffChanged && w.op == DiffChanged ||
+				d.op == DiffAdded && w.op == DiffRemoved ||
+				d.op == DiffRemoved && w.op == DiffAdded)
+		}
+		// unrelated trees are diffed item by item
+		tr3 := NewBTreeGOptions(less, Options{Degree: degree})
+		tr2.Scan(func(item testPair) bool {
+			tr3.Set(item)
+			return true
+		})
+		assert(len(testDiffs(tr, tr3)) == len(want))
+	}
+	var empty *BTreeG[testPair]
+	tr := NewBTreeG(less)
+	tr.Set(testPair{1, 1})
+	diffs := testDiffs(empty, tr)
+	assert(len(diffs) == 1 && diffs[0].op == DiffAdded)
+	diffs = testDiffs(tr, empty)
+	assert(len(diffs) == 1 && diffs[0].op == DiffRemoved)
+	assert(len(testDiffs(empty, empty)) == 0)
+}
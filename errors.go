@@ -0,0 +1,30 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import "errors"
+
+var (
+	// ErrReadOnly is returned by error-returning operations that modify a
+	// read-only tree.
+	ErrReadOnly = errors.New("read-only tree")
+	// ErrCorruptSnapshot is returned when a snapshot is truncated, fails its
+	// checksum, or is otherwise malformed.
+	ErrCorruptSnapshot = errors.New("corrupt snapshot")
+	// ErrVersionNotFound is returned when a requested version is not
+	// available, such as a snapshot written with an unknown format version.
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrKeyNotFound is returned by error-returning variants of operations
+	// that require an existing key, such as TryReplace.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrFull is returned, or raised as a panic, when an insert would exceed
+	// Options.MaxItems.
+	ErrFull = errors.New("tree is full")
+	// ErrBudgetExceeded is returned by the budgeted scans, such as
+	// ScanBudget, when they stop before visiting all items.
+	ErrBudgetExceeded = errors.New("budget exceeded")
+	// ErrCondFailed is returned by CompareAndApply when one of its
+	// conditions does not hold.
+	ErrCondFailed = errors.New("condition failed")
+)
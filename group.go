@@ -0,0 +1,36 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// GroupBy streams grouped aggregates in a single ordered scan of the tree.
+// Items are grouped by the key returned by group, such as a prefix of the
+// item key, which must be monotonic in the tree order so that every group is
+// a contiguous run of items. Each group is reduced by calling reduce with
+// the accumulator, starting from the zero value, and each item in order.
+// Emit is called with every group key and its aggregate, in order.
+// Return false from emit to stop.
+func GroupBy[T any, P comparable, R any](tr *BTreeG[T], group func(item T) P,
+	reduce func(acc R, item T) R, emit func(key P, acc R) bool,
+) {
+	var key P
+	var acc R
+	var started, stopped bool
+	tr.Scan(func(item T) bool {
+		k := group(item)
+		if started && k != key {
+			if !emit(key, acc) {
+				stopped = true
+				return false
+			}
+			var zero R
+			acc = zero
+		}
+		key, started = k, true
+		acc = reduce(acc, item)
+		return true
+	})
+	if started && !stopped {
+		emit(key, acc)
+	}
+}
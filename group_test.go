@@ -0,0 +1,36 @@
+package btree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	tr := NewBTreeG(func(a, b string) bool { return a < b })
+	for _, s := range []string{"a:1", "a:2", "b:1", "c:1", "c:2", "c:3"} {
+		tr.Set(s)
+	}
+	prefix := func(item string) string { return item[:strings.IndexByte(item, ':')] }
+	count := func(acc int, item string) int { return acc + 1 }
+	var groups []string
+	var counts []int
+	GroupBy(tr, prefix, count, func(key string, n int) bool {
+		groups = append(groups, key)
+		counts = append(counts, n)
+		return true
+	})
+	assert(strings.Join(groups, ",") == "a,b,c")
+	assert(intsEqual(counts, []int{2, 1, 3}))
+
+	groups = groups[:0]
+	GroupBy(tr, prefix, count, func(key string, n int) bool {
+		groups = append(groups, key)
+		return key != "b"
+	})
+	assert(strings.Join(groups, ",") == "a,b")
+
+	GroupBy(NewBTreeG(func(a, b string) bool { return a < b }), prefix, count,
+		func(key string, n int) bool {
+			panic("unexpected")
+		})
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"math"
+	"sync"
+)
+
+// Histogram records the exact count of every distinct value, with each
+// value stored as a bucket in a tree. Unlike a sketch, quantiles are exact.
+// The tree keeps the count of each subtree as an aggregate, so both Record
+// and Quantile are O(log n), where n is the number of distinct values.
+// It's safe for concurrent use by multiple goroutines.
+type Histogram struct {
+	mu    sync.Mutex
+	tr    *BTreeG[histBucket]
+	total uint64
+}
+
+type histBucket struct {
+	value float64
+	count uint64
+}
+
+// NewHistogram returns a new empty Histogram.
+func NewHistogram() *Histogram {
+	h := &Histogram{
+		tr: NewBTreeGOptions(func(a, b histBucket) bool {
+			return a.value < b.value
+		}, Options{NoLocks: true}),
+	}
+	h.tr.SetAggregator(&Aggregator[histBucket]{
+		Sum: func(a, b histBucket) histBucket {
+			return histBucket{count: a.count + b.count}
+		},
+	})
+	return h
+}
+
+// Record a value.
+func (h *Histogram) Record(v float64) {
+	h.RecordN(v, 1)
+}
+
+// RecordN records a value n times. NaN values are ignored.
+func (h *Histogram) RecordN(v float64, n uint64) {
+	if math.IsNaN(v) || n == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordN(v, n)
+}
+
+func (h *Histogram) recordN(v float64, n uint64) {
+	// buckets are replaced rather than updated in place, so that the
+	// aggregates of the nodes on the path are recomputed
+	b, _ := h.tr.Get(histBucket{value: v})
+	h.tr.Set(histBucket{value: v, count: b.count + n})
+	h.total += n
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Quantile returns the value at the q-th quantile, where q is between 0 and
+// 1, using the nearest-rank method.
+// Returns false if the histogram is empty or q is out of range.
+func (h *Histogram) Quantile(q float64) (float64, bool) {
+	if !(q >= 0 && q <= 1) {
+		return 0, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0, false
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+	return h.quantile(rank), true
+}
+
+// quantile descends to the bucket holding the value of the given rank,
+// skipping the subtrees before it by their aggregate counts.
+func (h *Histogram) quantile(rank uint64) float64 {
+	n := h.tr.root
+	for {
+		var child *node[histBucket]
+		for i := 0; ; i++ {
+			if !n.leaf() {
+				c := (*n.children)[i]
+				if count := h.tr.nodeAggregate(c).count; rank > count {
+					rank -= count
+				} else {
+					child = c
+					break
+				}
+			}
+			// rank is at most the total, so it's found before the last
+			// child is passed
+			if rank <= n.items[i].count {
+				return n.items[i].value
+			}
+			rank -= n.items[i].count
+		}
+		n = child
+	}
+}
+
+// Buckets iterates over the distinct values and their counts, in ascending
+// order.
+func (h *Histogram) Buckets(iter func(value float64, count uint64) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tr.Scan(func(b histBucket) bool {
+		return iter(b.value, b.count)
+	})
+}
+
+// Merge adds all values recorded by other into the histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	var buckets []histBucket
+	other.Buckets(func(value float64, count uint64) bool {
+		buckets = append(buckets, histBucket{value, count})
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, b := range buckets {
+		h.recordN(b.value, b.count)
+	}
+}
@@ -0,0 +1,52 @@
+package btree
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram()
+	_, ok := h.Quantile(0.5)
+	assert(!ok)
+	N := 10_000
+	var values []float64
+	for i := 0; i < N; i++ {
+		v := float64(rand.Intn(500)) / 10
+		values = append(values, v)
+		h.Record(v)
+	}
+	h.Record(math.NaN())
+	sort.Float64s(values)
+	assert(h.Count() == uint64(N))
+	for i := 0; i <= 1000; i++ {
+		q := float64(i) / 1000
+		v, ok := h.Quantile(q)
+		index := int(math.Ceil(q*float64(N))) - 1
+		if index < 0 {
+			index = 0
+		}
+		assert(ok && v == values[index])
+	}
+	_, ok = h.Quantile(2)
+	assert(!ok)
+
+	h2 := NewHistogram()
+	h2.RecordN(1000, uint64(N))
+	h.Merge(h2)
+	assert(h.Count() == uint64(N*2))
+	v, _ := h.Quantile(0.5)
+	assert(v == values[N-1])
+	v, _ = h.Quantile(0.51)
+	assert(v == 1000)
+	var buckets int
+	var total uint64
+	h.Buckets(func(value float64, count uint64) bool {
+		buckets++
+		total += count
+		return true
+	})
+	assert(buckets <= 501 && total == h.Count())
+}
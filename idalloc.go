@@ -0,0 +1,205 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import "sync"
+
+// IDAllocator hands out integer ids, such as ports, inode numbers, or shard
+// ids, from the range [min, max]. Allocated ids are tracked as a tree of
+// disjoint ranges, so memory use depends on how fragmented the ids are
+// rather than how many are allocated. Each subtree keeps the largest gap
+// between its ranges as an aggregate, so finding a gap is O(log n) in the
+// number of ranges.
+// It's safe for concurrent use by multiple goroutines.
+type IDAllocator struct {
+	mu       sync.Mutex
+	tr       *BTreeG[idRange]
+	min, max uint64
+	count    uint64
+}
+
+// idRange is a range of allocated ids [lo, hi]. As an aggregate it spans the
+// ranges of a subtree, and gap is the largest number of free ids between
+// them. The aggregate of no ranges has lo greater than hi.
+type idRange struct {
+	lo, hi uint64
+	gap    uint64
+}
+
+// NewIDAllocator returns an allocator for the ids in the range [min, max].
+func NewIDAllocator(min, max uint64) *IDAllocator {
+	if min > max {
+		panic("invalid range")
+	}
+	a := &IDAllocator{
+		tr: NewBTreeGOptions(func(a, b idRange) bool {
+			return a.lo < b.lo
+		}, Options{NoLocks: true}),
+		min: min,
+		max: max,
+	}
+	a.tr.SetAggregator(&Aggregator[idRange]{
+		Sum: func(x, y idRange) idRange {
+			if x.lo > x.hi {
+				return y
+			}
+			if y.lo > y.hi {
+				return x
+			}
+			gap := x.gap
+			if y.gap > gap {
+				gap = y.gap
+			}
+			if g := y.lo - x.hi - 1; g > gap {
+				gap = g
+			}
+			return idRange{lo: x.lo, hi: y.hi, gap: gap}
+		},
+		Identity: idRange{lo: 1},
+	})
+	return a
+}
+
+// Len returns the number of allocated ids.
+func (a *IDAllocator) Len() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.count
+}
+
+// AllocateLowest allocates the lowest free id.
+// Returns false if all ids are allocated.
+func (a *IDAllocator) AllocateLowest() (uint64, bool) {
+	return a.AllocateRange(1)
+}
+
+// AllocateRange allocates the lowest n consecutive free ids and returns the
+// first one, in O(log n) in the number of allocated ranges.
+// Returns false if there is no gap large enough.
+func (a *IDAllocator) AllocateRange(n uint64) (uint64, bool) {
+	if n == 0 {
+		return 0, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cursor := a.min
+	var found, full bool
+	if a.tr.root != nil {
+		found, full = a.gap(a.tr.root, &cursor, n)
+	}
+	if !found && (full || a.max-cursor < n-1) {
+		return 0, false
+	}
+	a.insert(cursor, cursor+n-1)
+	return cursor, true
+}
+
+// gap finds the first gap of at least n free ids in the subtree, where
+// cursor is the first id after the ranges that precede the subtree. On
+// return cursor is the first id of the gap, or the first id after the
+// subtree if there is no such gap. Returns full if the subtree reaches max.
+// Subtrees are skipped by their aggregates, and only a subtree that holds a
+// large enough gap is descended into.
+func (a *IDAllocator) gap(nd *node[idRange], cursor *uint64, n uint64,
+) (found, full bool) {
+	for i := 0; i <= len(nd.items); i++ {
+		if !nd.leaf() {
+			c := (*nd.children)[i]
+			r := a.tr.nodeAggregate(c)
+			if r.lo-*cursor >= n {
+				return true, false
+			}
+			if r.gap >= n {
+				return a.gap(c, cursor, n)
+			}
+			if r.hi == a.max {
+				return false, true
+			}
+			*cursor = r.hi + 1
+		}
+		if i < len(nd.items) {
+			r := nd.items[i]
+			if r.lo-*cursor >= n {
+				return true, false
+			}
+			if r.hi == a.max {
+				return false, true
+			}
+			*cursor = r.hi + 1
+		}
+	}
+	return false, false
+}
+
+// Allocate allocates a specific id.
+// Returns false if the id is already allocated or is out of range.
+func (a *IDAllocator) Allocate(id uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if id < a.min || id > a.max {
+		return false
+	}
+	if _, ok := a.find(id); ok {
+		return false
+	}
+	a.insert(id, id)
+	return true
+}
+
+// IsAllocated returns true if the id is allocated.
+func (a *IDAllocator) IsAllocated(id uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.find(id)
+	return ok
+}
+
+// Free releases an allocated id.
+// Returns false if the id was not allocated.
+func (a *IDAllocator) Free(id uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.find(id)
+	if !ok {
+		return false
+	}
+	a.tr.Delete(r)
+	if r.lo < id {
+		a.tr.Set(idRange{lo: r.lo, hi: id - 1})
+	}
+	if id < r.hi {
+		a.tr.Set(idRange{lo: id + 1, hi: r.hi})
+	}
+	a.count--
+	return true
+}
+
+// find returns the allocated range containing the id.
+func (a *IDAllocator) find(id uint64) (idRange, bool) {
+	var r idRange
+	var ok bool
+	a.tr.Descend(idRange{lo: id}, func(item idRange) bool {
+		r, ok = item, item.hi >= id
+		return false
+	})
+	return r, ok
+}
+
+// insert adds the free ids [lo, hi], merging with adjacent ranges.
+func (a *IDAllocator) insert(lo, hi uint64) {
+	a.count += hi - lo + 1
+	if lo > 0 {
+		if prev, ok := a.find(lo - 1); ok {
+			a.tr.Delete(prev)
+			lo = prev.lo
+		}
+	}
+	if hi < a.max {
+		if next, ok := a.tr.Get(idRange{lo: hi + 1}); ok {
+			a.tr.Delete(next)
+			hi = next.hi
+		}
+	}
+	a.tr.Set(idRange{lo: lo, hi: hi})
+}
@@ -0,0 +1,95 @@
+package btree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestIDAllocator(t *testing.T) {
+	a := NewIDAllocator(10, 1009)
+	for i := 0; i < 1000; i++ {
+		id, ok := a.AllocateLowest()
+		assert(ok && id == uint64(10+i))
+	}
+	_, ok := a.AllocateLowest()
+	assert(!ok)
+	assert(a.Len() == 1000 && a.tr.Len() == 1)
+	assert(a.Free(500) && !a.Free(500) && !a.Free(5))
+	assert(a.tr.Len() == 2 && !a.IsAllocated(500) && a.IsAllocated(501))
+	for _, id := range []uint64{100, 101, 102, 200} {
+		assert(a.Free(id))
+	}
+	_, ok = a.AllocateRange(4)
+	assert(!ok)
+	id, ok := a.AllocateRange(3)
+	assert(ok && id == 100)
+	id, _ = a.AllocateLowest()
+	assert(id == 200)
+	id, _ = a.AllocateLowest()
+	assert(id == 500)
+	assert(a.tr.Len() == 1 && a.Len() == 1000)
+	assert(!a.Allocate(10) && !a.Allocate(2000))
+
+	// random allocations and frees match a reference
+	a = NewIDAllocator(0, 999)
+	ref := make(map[uint64]bool)
+	for i := 0; i < 10000; i++ {
+		switch rand.Intn(4) {
+		case 0:
+			id, ok := a.AllocateLowest()
+			if ok {
+				assert(!ref[id])
+				for j := uint64(0); j < id; j++ {
+					assert(ref[j])
+				}
+				ref[id] = true
+			} else {
+				assert(len(ref) == 1000)
+			}
+		case 1:
+			id := uint64(rand.Intn(1000))
+			assert(a.Free(id) == ref[id])
+			delete(ref, id)
+		case 2:
+			id := uint64(rand.Intn(1000))
+			assert(a.Allocate(id) == !ref[id])
+			ref[id] = true
+		case 3:
+			n := uint64(1 + rand.Intn(5))
+			want, fits := uint64(0), false
+			for lo := uint64(0); lo+n <= 1000 && !fits; lo++ {
+				fits = true
+				for j := lo; j < lo+n; j++ {
+					if ref[j] {
+						fits = false
+						break
+					}
+				}
+				want = lo
+			}
+			id, ok := a.AllocateRange(n)
+			assert(ok == fits && (!ok || id == want))
+			for j := id; ok && j < id+n; j++ {
+				ref[j] = true
+			}
+		}
+		assert(a.Len() == uint64(len(ref)))
+	}
+	var prev *idRange
+	a.tr.Scan(func(r idRange) bool {
+		// ranges are disjoint and never adjacent
+		assert(r.lo <= r.hi && (prev == nil || prev.hi+1 < r.lo))
+		prev = &r
+		return true
+	})
+
+	// the full uint64 range
+	a = NewIDAllocator(0, math.MaxUint64)
+	assert(a.Allocate(math.MaxUint64))
+	id, ok = a.AllocateRange(math.MaxUint64)
+	assert(ok && id == 0)
+	_, ok = a.AllocateLowest()
+	assert(!ok)
+	assert(a.tr.Len() == 1)
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// Interner assigns stable uint64 IDs to strings. IDs start at 1 and are
+// assigned in the order strings are first interned. Both directions of the
+// mapping are kept in trees, so strings can be enumerated in order, and the
+// mapping can be persisted using BackupTo and Restore.
+// It's safe for concurrent use by multiple goroutines.
+type Interner struct {
+	mu    sync.RWMutex
+	byStr *BTreeG[*internEntry]
+	byID  *BTreeG[*internEntry]
+	last  uint64
+}
+
+type internEntry struct {
+	str string
+	id  uint64
+}
+
+// NewInterner returns a new empty Interner.
+func NewInterner() *Interner {
+	in := new(Interner)
+	in.byStr, in.byID = newInternTrees()
+	return in
+}
+
+func newInternTrees() (byStr, byID *BTreeG[*internEntry]) {
+	opts := Options{NoLocks: true}
+	byStr = NewBTreeGOptions(func(a, b *internEntry) bool {
+		return a.str < b.str
+	}, opts)
+	byID = NewBTreeGOptions(func(a, b *internEntry) bool {
+		return a.id < b.id
+	}, opts)
+	return byStr, byID
+}
+
+// Intern returns the ID for s, assigning a new one if s has not been
+// interned.
+func (in *Interner) Intern(s string) uint64 {
+	if id, ok := in.ID(s); ok {
+		return id
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if e, ok := in.byStr.Get(&internEntry{str: s}); ok {
+		return e.id
+	}
+	in.last++
+	e := &internEntry{s, in.last}
+	in.byStr.Set(e)
+	in.byID.Set(e)
+	return e.id
+}
+
+// ID returns the ID for s.
+// Returns false if s has not been interned.
+func (in *Interner) ID(s string) (uint64, bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	e, ok := in.byStr.Get(&internEntry{str: s})
+	if !ok {
+		return 0, false
+	}
+	return e.id, true
+}
+
+// Lookup returns the string for an ID.
+// Returns false if the ID has not been assigned.
+func (in *Interner) Lookup(id uint64) (string, bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	e, ok := in.byID.Get(&internEntry{id: id})
+	if !ok {
+		return "", false
+	}
+	return e.str, true
+}
+
+// Len returns the number of interned strings.
+func (in *Interner) Len() int {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return in.byStr.Len()
+}
+
+// Scan all interned strings and their IDs, in string order.
+// Return false to stop iterating.
+func (in *Interner) Scan(iter func(s string, id uint64) bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	in.byStr.Scan(func(e *internEntry) bool {
+		return iter(e.str, e.id)
+	})
+}
+
+// BackupTo writes a snapshot of the interner to w.
+// The interner is only locked while the snapshot is captured.
+func (in *Interner) BackupTo(w io.Writer) error {
+	in.mu.Lock()
+	snap := in.byStr.Copy()
+	in.mu.Unlock()
+	return snap.BackupTo(w, func(dst []byte, e *internEntry) []byte {
+		dst = binary.AppendUvarint(dst, e.id)
+		return append(dst, e.str...)
+	}, nil)
+}
+
+// Restore replaces the contents of the interner with a snapshot that was
+// written by BackupTo.
+// On error the interner is left unchanged.
+func (in *Interner) Restore(r io.Reader) error {
+	byStr, byID := newInternTrees()
+	err := byStr.Restore(r, func(data []byte) (*internEntry, error) {
+		id, n := binary.Uvarint(data)
+		if n <= 0 || id == 0 {
+			return nil, ErrCorruptSnapshot
+		}
+		return &internEntry{string(data[n:]), id}, nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	var last uint64
+	var dup bool
+	byStr.Scan(func(e *internEntry) bool {
+		if _, dup = byID.Set(e); dup {
+			return false
+		}
+		if e.id > last {
+			last = e.id
+		}
+		return true
+	})
+	if dup {
+		return ErrCorruptSnapshot
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.byStr, in.byID, in.last = byStr, byID, last
+	return nil
+}
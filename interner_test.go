@@ -0,0 +1,47 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestInterner(t *testing.T) {
+	in := NewInterner()
+	_, ok := in.ID("a")
+	assert(!ok)
+	assert(in.Intern("c") == 1)
+	assert(in.Intern("a") == 2)
+	assert(in.Intern("b") == 3)
+	assert(in.Intern("a") == 2)
+	assert(in.Len() == 3)
+	s, ok := in.Lookup(3)
+	assert(ok && s == "b")
+	_, ok = in.Lookup(4)
+	assert(!ok)
+	var strs []string
+	in.Scan(func(s string, id uint64) bool {
+		strs = append(strs, s)
+		return true
+	})
+	assert(len(strs) == 3 && strs[0] == "a" && strs[2] == "c")
+
+	var buf bytes.Buffer
+	assert(in.BackupTo(&buf) == nil)
+	data := buf.Bytes()
+	in2 := NewInterner()
+	in2.Intern("x")
+	assert(in2.Restore(bytes.NewReader(data)) == nil)
+	assert(in2.Len() == 3)
+	id, ok := in2.ID("c")
+	assert(ok && id == 1)
+	_, ok = in2.ID("x")
+	assert(!ok)
+	assert(in2.Intern("d") == 4)
+
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-5] ^= 0xFF
+	err := in2.Restore(bytes.NewReader(bad))
+	assert(errors.Is(err, ErrCorruptSnapshot))
+	assert(in2.Len() == 4)
+}
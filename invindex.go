@@ -0,0 +1,99 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import "sort"
+
+// InvertedIndex maps terms to ordered sets of document ids, known as posting
+// lists, for small search features that don't need a full search engine.
+// It's not safe for concurrent use by multiple goroutines.
+type InvertedIndex[K ordered, D ordered] struct {
+	terms Map[K, *Set[D]]
+}
+
+// AddPosting adds a document to the posting list for a term.
+func (ix *InvertedIndex[K, D]) AddPosting(term K, doc D) {
+	postings, ok := ix.terms.Get(term)
+	if !ok {
+		postings = new(Set[D])
+		ix.terms.Set(term, postings)
+	}
+	postings.Insert(doc)
+}
+
+// RemovePosting removes a document from the posting list for a term.
+// Returns false if the document was not in the posting list.
+func (ix *InvertedIndex[K, D]) RemovePosting(term K, doc D) bool {
+	postings, ok := ix.terms.Get(term)
+	if !ok || !postings.Contains(doc) {
+		return false
+	}
+	postings.Delete(doc)
+	if postings.Len() == 0 {
+		ix.terms.Delete(term)
+	}
+	return true
+}
+
+// Count returns the number of documents in the posting list for a term.
+func (ix *InvertedIndex[K, D]) Count(term K) int {
+	postings, ok := ix.terms.Get(term)
+	if !ok {
+		return 0
+	}
+	return postings.Len()
+}
+
+// Terms iterates over all terms in order.
+func (ix *InvertedIndex[K, D]) Terms(iter func(term K) bool) {
+	ix.terms.Scan(func(term K, _ *Set[D]) bool {
+		return iter(term)
+	})
+}
+
+// Postings iterates over the documents in the posting list for a term, in
+// ascending order.
+func (ix *InvertedIndex[K, D]) Postings(term K, iter func(doc D) bool) {
+	postings, ok := ix.terms.Get(term)
+	if ok {
+		postings.Scan(iter)
+	}
+}
+
+// Intersect iterates over the documents that are in the posting lists of
+// all the terms, in ascending order.
+// The posting lists are joined by leapfrogging with iterator seeks, so the
+// cost depends on the size of the smallest list rather than the largest.
+func (ix *InvertedIndex[K, D]) Intersect(terms []K, iter func(doc D) bool) {
+	if len(terms) == 0 {
+		return
+	}
+	its := make([]SetIter[D], len(terms))
+	for i, term := range terms {
+		postings, ok := ix.terms.Get(term)
+		if !ok {
+			return
+		}
+		its[i] = postings.Iter()
+		if !its[i].First() {
+			return
+		}
+	}
+	sort.Slice(its, func(i, j int) bool {
+		return its[i].Key() < its[j].Key()
+	})
+	target := its[len(its)-1].Key()
+	for p := 0; ; p = (p + 1) % len(its) {
+		it := &its[p]
+		if it.Key() == target {
+			// every iterator is on the same document
+			if !iter(target) || !it.Next() {
+				return
+			}
+		} else if !it.Seek(target) {
+			return
+		}
+		target = it.Key()
+	}
+}
@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestInvertedIndex(t *testing.T) {
+	var ix InvertedIndex[string, int]
+	N := 10_000
+	for _, doc := range rand.Perm(N) {
+		ix.AddPosting("all", doc)
+		if doc%2 == 0 {
+			ix.AddPosting("two", doc)
+		}
+		if doc%3 == 0 {
+			ix.AddPosting("three", doc)
+		}
+		if doc%5 == 0 {
+			ix.AddPosting("five", doc)
+		}
+	}
+	assert(ix.Count("all") == N && ix.Count("two") == N/2)
+	var terms []string
+	ix.Terms(func(term string) bool {
+		terms = append(terms, term)
+		return true
+	})
+	assert(len(terms) == 4 && terms[0] == "all" && terms[3] == "two")
+	var docs []int
+	ix.Intersect([]string{"two", "three", "five", "all"}, func(doc int) bool {
+		docs = append(docs, doc)
+		return true
+	})
+	assert(len(docs) == (N+29)/30)
+	for i, doc := range docs {
+		assert(doc == i*30)
+	}
+	docs = nil
+	ix.Intersect([]string{"five"}, func(doc int) bool {
+		docs = append(docs, doc)
+		return len(docs) < 3
+	})
+	assert(len(docs) == 3 && docs[2] == 10)
+	ix.Intersect([]string{"two", "missing"}, func(doc int) bool { panic("!") })
+	ix.Intersect(nil, func(doc int) bool { panic("!") })
+
+	assert(ix.RemovePosting("five", 0))
+	assert(!ix.RemovePosting("five", 0))
+	assert(!ix.RemovePosting("missing", 0))
+	for doc := 5; doc < N; doc += 5 {
+		assert(ix.RemovePosting("five", doc))
+	}
+	assert(ix.Count("five") == 0)
+	ix.Postings("five", func(doc int) bool { panic("!") })
+	var count int
+	ix.Postings("three", func(doc int) bool {
+		assert(doc%3 == 0)
+		count++
+		return true
+	})
+	assert(count == ix.Count("three"))
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+
+package btree
+
+import "iter"
+
+// All returns an iterator over all items in the tree, in ascending order.
+//
+//	for item := range tr.All() {
+//		...
+//	}
+func (tr *BTreeG[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		tr.Scan(yield)
+	}
+}
+
+// Backward returns an iterator over all items in the tree, in descending
+// order.
+func (tr *BTreeG[T]) Backward() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		tr.Reverse(yield)
+	}
+}
+
+// Values returns an iterator over the items in the tree within the range
+// [pivot, last], in ascending order.
+func (tr *BTreeG[T]) Values(pivot T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		tr.Ascend(pivot, yield)
+	}
+}
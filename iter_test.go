@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package btree
+
+import "testing"
+
+func TestGenericRangeFunc(t *testing.T) {
+	tr := testNewBTree()
+	N := 1000
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	i := 0
+	for item := range tr.All() {
+		assert(item == i)
+		i++
+	}
+	assert(i == N)
+	for item := range tr.Backward() {
+		i--
+		assert(item == i)
+	}
+	assert(i == 0)
+	i = 500
+	for item := range tr.Values(500) {
+		assert(item == i)
+		if i == 600 {
+			break
+		}
+		i++
+	}
+	assert(i == 600)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// Join2 performs an ordered merge-join of two maps in a single pass, calling
+// fn in key order for every key that is in both maps.
+// Return false to stop iterating.
+func Join2[K ordered, A, B any](a *Map[K, A], b *Map[K, B],
+	fn func(key K, a A, b B) bool,
+) {
+	ia, ib := a.Iter(), b.Iter()
+	oka, okb := ia.First(), ib.First()
+	for oka && okb {
+		ka, kb := ia.Key(), ib.Key()
+		switch {
+		case ka < kb:
+			oka = seekIter(&ia, kb)
+		case kb < ka:
+			okb = seekIter(&ib, ka)
+		default:
+			if !fn(ka, ia.Value(), ib.Value()) {
+				return
+			}
+			oka, okb = ia.Next(), ib.Next()
+		}
+	}
+}
+
+// LeftJoin2 is like Join2, but calls fn for every key in a, along with the
+// value for the key in b and whether the key was found in b.
+// Return false to stop iterating.
+func LeftJoin2[K ordered, A, B any](a *Map[K, A], b *Map[K, B],
+	fn func(key K, a A, b B, ok bool) bool,
+) {
+	var empty B
+	ia, ib := a.Iter(), b.Iter()
+	okb := ib.First()
+	for oka := ia.First(); oka; oka = ia.Next() {
+		ka := ia.Key()
+		if okb && ib.Key() < ka {
+			okb = seekIter(&ib, ka)
+		}
+		var ok bool
+		if okb && ib.Key() == ka {
+			ok = fn(ka, ia.Value(), ib.Value(), true)
+		} else {
+			ok = fn(ka, ia.Value(), empty, false)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// AntiJoin2 calls fn in key order for every key in a that is not in b.
+// Return false to stop iterating.
+func AntiJoin2[K ordered, A, B any](a *Map[K, A], b *Map[K, B],
+	fn func(key K, a A) bool,
+) {
+	LeftJoin2(a, b, func(key K, a A, b B, ok bool) bool {
+		return ok || fn(key, a)
+	})
+}
+
+// seekIter moves the iterator forward to the first key that is greater than
+// or equal to key. It steps once before falling back to a seek, which suits
+// both dense and sparse joins.
+func seekIter[K ordered, V any](iter *MapIter[K, V], key K) bool {
+	if !iter.Next() {
+		return false
+	}
+	if !(iter.Key() < key) {
+		return true
+	}
+	return iter.Seek(key)
+}
@@ -0,0 +1,84 @@
+package btree
+
+import "testing"
+
+func TestJoin2(t *testing.T) {
+	var a Map[int, string]
+	var b Map[int, int]
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			a.Set(i, "a")
+		}
+		if i%3 == 0 || i > 900 {
+			b.Set(i, i*10)
+		}
+	}
+	inA := func(i int) bool { return i%2 == 0 }
+	inB := func(i int) bool { return i%3 == 0 || i > 900 }
+
+	var keys []int
+	Join2(&a, &b, func(key int, av string, bv int) bool {
+		assert(av == "a" && bv == key*10)
+		keys = append(keys, key)
+		return true
+	})
+	var exp []int
+	for i := 0; i < 1000; i++ {
+		if inA(i) && inB(i) {
+			exp = append(exp, i)
+		}
+	}
+	assert(intsEqual(keys, exp))
+
+	keys = keys[:0]
+	var found int
+	LeftJoin2(&a, &b, func(key int, av string, bv int, ok bool) bool {
+		assert(ok == inB(key))
+		if ok {
+			assert(bv == key*10)
+			found++
+		} else {
+			assert(bv == 0)
+		}
+		keys = append(keys, key)
+		return true
+	})
+	assert(len(keys) == a.Len() && found == len(exp))
+
+	keys = keys[:0]
+	AntiJoin2(&a, &b, func(key int, av string) bool {
+		assert(inA(key) && !inB(key))
+		keys = append(keys, key)
+		return true
+	})
+	assert(len(keys) == a.Len()-len(exp))
+
+	var count int
+	Join2(&a, &b, func(key int, av string, bv int) bool {
+		count++
+		return count < 3
+	})
+	assert(count == 3)
+	var empty Map[int, int]
+	Join2(&a, &empty, func(key int, av string, bv int) bool {
+		panic("unexpected")
+	})
+	count = 0
+	AntiJoin2(&a, &empty, func(key int, av string) bool {
+		count++
+		return true
+	})
+	assert(count == a.Len())
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
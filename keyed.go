@@ -0,0 +1,105 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// KeyedBTreeG is a tree of items that are ordered by a key extracted from
+// each item. Lookups take the key itself, so there's no need to build a
+// dummy item with the right key fields.
+type KeyedBTreeG[T any, K ordered] struct {
+	tr    *BTreeG[keyedItem[T, K]]
+	keyOf func(item T) K
+}
+
+type keyedItem[T any, K ordered] struct {
+	key  K // extracted once, when the item is set
+	item T
+}
+
+// NewBTreeGByKey returns a new KeyedBTreeG that orders items by the key
+// returned by keyOf. The key of an item must not change while the item is in
+// the tree.
+func NewBTreeGByKey[T any, K ordered](keyOf func(item T) K, opts Options,
+) *KeyedBTreeG[T, K] {
+	return &KeyedBTreeG[T, K]{
+		tr: NewBTreeGOptions(func(a, b keyedItem[T, K]) bool {
+			return a.key < b.key
+		}, opts),
+		keyOf: keyOf,
+	}
+}
+
+// Set or replace the item with the same key.
+func (tr *KeyedBTreeG[T, K]) Set(item T) (prev T, replaced bool) {
+	e, replaced := tr.tr.Set(keyedItem[T, K]{tr.keyOf(item), item})
+	return e.item, replaced
+}
+
+// Get the item for key.
+func (tr *KeyedBTreeG[T, K]) Get(key K) (T, bool) {
+	e, ok := tr.tr.Get(keyedItem[T, K]{key: key})
+	return e.item, ok
+}
+
+// Delete the item for key and return it.
+func (tr *KeyedBTreeG[T, K]) Delete(key K) (T, bool) {
+	e, ok := tr.tr.Delete(keyedItem[T, K]{key: key})
+	return e.item, ok
+}
+
+// Len returns the number of items in the tree.
+func (tr *KeyedBTreeG[T, K]) Len() int {
+	return tr.tr.Len()
+}
+
+// Min returns the item with the smallest key.
+func (tr *KeyedBTreeG[T, K]) Min() (T, bool) {
+	e, ok := tr.tr.Min()
+	return e.item, ok
+}
+
+// Max returns the item with the largest key.
+func (tr *KeyedBTreeG[T, K]) Max() (T, bool) {
+	e, ok := tr.tr.Max()
+	return e.item, ok
+}
+
+// Scan iterates over all items in key order.
+func (tr *KeyedBTreeG[T, K]) Scan(iter func(item T) bool) {
+	tr.tr.Scan(func(e keyedItem[T, K]) bool {
+		return iter(e.item)
+	})
+}
+
+// Reverse iterates over all items in reverse key order.
+func (tr *KeyedBTreeG[T, K]) Reverse(iter func(item T) bool) {
+	tr.tr.Reverse(func(e keyedItem[T, K]) bool {
+		return iter(e.item)
+	})
+}
+
+// Ascend iterates over the items with keys greater than or equal to pivot.
+func (tr *KeyedBTreeG[T, K]) Ascend(pivot K, iter func(item T) bool) {
+	tr.tr.Ascend(keyedItem[T, K]{key: pivot}, func(e keyedItem[T, K]) bool {
+		return iter(e.item)
+	})
+}
+
+// Descend iterates over the items with keys less than or equal to pivot, in
+// reverse key order.
+func (tr *KeyedBTreeG[T, K]) Descend(pivot K, iter func(item T) bool) {
+	tr.tr.Descend(keyedItem[T, K]{key: pivot}, func(e keyedItem[T, K]) bool {
+		return iter(e.item)
+	})
+}
+
+// AscendRange iterates over the items with keys in the range
+// [greaterOrEqual, lessThan).
+func (tr *KeyedBTreeG[T, K]) AscendRange(greaterOrEqual, lessThan K,
+	iter func(item T) bool,
+) {
+	tr.tr.AscendRange(keyedItem[T, K]{key: greaterOrEqual},
+		keyedItem[T, K]{key: lessThan}, func(e keyedItem[T, K]) bool {
+			return iter(e.item)
+		})
+}
@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestKeyedBTreeG(t *testing.T) {
+	type user struct {
+		id   int
+		name string
+	}
+	tr := NewBTreeGByKey(func(u user) int { return u.id }, Options{})
+	keys := randKeys(1000)
+	for _, id := range keys {
+		_, replaced := tr.Set(user{id, strconv.Itoa(id)})
+		assert(!replaced)
+	}
+	assert(tr.Len() == 1000)
+	prev, replaced := tr.Set(user{2, "two"})
+	assert(replaced && prev.name == "2")
+	u, ok := tr.Get(2)
+	assert(ok && u.name == "two")
+	_, ok = tr.Get(1000)
+	assert(!ok)
+	min, _ := tr.Min()
+	max, _ := tr.Max()
+	assert(min.id == 0 && max.id == 999)
+	var ids []int
+	tr.AscendRange(10, 15, func(u user) bool {
+		ids = append(ids, u.id)
+		return true
+	})
+	assert(intsEqual(ids, []int{10, 11, 12, 13, 14}))
+	ids = ids[:0]
+	tr.Descend(500, func(u user) bool {
+		ids = append(ids, u.id)
+		return len(ids) < 3
+	})
+	assert(intsEqual(ids, []int{500, 499, 498}))
+	ids = ids[:0]
+	tr.Ascend(998, func(u user) bool {
+		ids = append(ids, u.id)
+		return true
+	})
+	assert(intsEqual(ids, []int{998, 999}))
+	var n int
+	tr.Scan(func(u user) bool {
+		assert(u.id == n)
+		n++
+		return true
+	})
+	tr.Reverse(func(u user) bool {
+		n--
+		assert(u.id == n)
+		return true
+	})
+	for _, id := range keys {
+		u, ok := tr.Delete(id)
+		assert(ok && u.id == id)
+	}
+	assert(tr.Len() == 0)
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease is a reservation of the key range [Lo, Hi) by an owner.
+type Lease[K ordered] struct {
+	Lo, Hi  K
+	Owner   string
+	Expires time.Time
+}
+
+// LeaseManager grants time-limited, non-overlapping reservations of key
+// ranges, for coordination such as partition ownership within a single
+// process. Expired leases are released automatically.
+// It's safe for concurrent use by multiple goroutines.
+type LeaseManager[K ordered] struct {
+	mu      sync.Mutex
+	leases  *BTreeG[*Lease[K]] // ordered by Lo
+	expires *BTreeG[*Lease[K]] // ordered by Expires, then Lo
+	now     func() time.Time
+}
+
+// NewLeaseManager returns a new LeaseManager.
+func NewLeaseManager[K ordered]() *LeaseManager[K] {
+	opts := Options{NoLocks: true}
+	return &LeaseManager[K]{
+		leases: NewBTreeGOptions(func(a, b *Lease[K]) bool {
+			return a.Lo < b.Lo
+		}, opts),
+		expires: NewBTreeGOptions(func(a, b *Lease[K]) bool {
+			if !a.Expires.Equal(b.Expires) {
+				return a.Expires.Before(b.Expires)
+			}
+			return a.Lo < b.Lo
+		}, opts),
+		now: time.Now,
+	}
+}
+
+// expire releases all leases that expired at or before now.
+func (m *LeaseManager[K]) expire(now time.Time) {
+	for {
+		l, ok := m.expires.Min()
+		if !ok || l.Expires.After(now) {
+			return
+		}
+		m.expires.PopMin()
+		m.leases.Delete(l)
+	}
+}
+
+// overlaps returns the leases that overlap the range [lo, hi).
+func (m *LeaseManager[K]) overlaps(lo, hi K) []*Lease[K] {
+	var leases []*Lease[K]
+	// the lease starting before lo may extend into the range
+	m.leases.Descend(&Lease[K]{Lo: lo}, func(l *Lease[K]) bool {
+		if l.Lo < lo && lo < l.Hi {
+			leases = append(leases, l)
+		}
+		return false
+	})
+	m.leases.AscendRange(&Lease[K]{Lo: lo}, &Lease[K]{Lo: hi},
+		func(l *Lease[K]) bool {
+			leases = append(leases, l)
+			return true
+		})
+	return leases
+}
+
+// Reserve the key range [lo, hi) for owner for the ttl duration.
+// Returns false if the range is empty or overlaps a lease that has not
+// expired. Use Renew to extend an existing lease.
+func (m *LeaseManager[K]) Reserve(lo, hi K, owner string, ttl time.Duration,
+) (Lease[K], bool) {
+	if !(lo < hi) {
+		return Lease[K]{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.expire(now)
+	if len(m.overlaps(lo, hi)) > 0 {
+		return Lease[K]{}, false
+	}
+	l := &Lease[K]{Lo: lo, Hi: hi, Owner: owner, Expires: now.Add(ttl)}
+	m.leases.Set(l)
+	m.expires.Set(l)
+	return *l, true
+}
+
+// Renew extends the lease starting at lo, which must be held by owner, to
+// expire ttl from now.
+// Returns false if there is no such lease or it has expired.
+func (m *LeaseManager[K]) Renew(lo K, owner string, ttl time.Duration,
+) (Lease[K], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.expire(now)
+	l, ok := m.leases.Get(&Lease[K]{Lo: lo})
+	if !ok || l.Owner != owner {
+		return Lease[K]{}, false
+	}
+	m.expires.Delete(l)
+	l.Expires = now.Add(ttl)
+	m.expires.Set(l)
+	return *l, true
+}
+
+// Release the lease starting at lo, which must be held by owner.
+// Returns false if there is no such lease or it has expired.
+func (m *LeaseManager[K]) Release(lo K, owner string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(m.now())
+	l, ok := m.leases.Get(&Lease[K]{Lo: lo})
+	if !ok || l.Owner != owner {
+		return false
+	}
+	m.leases.Delete(l)
+	m.expires.Delete(l)
+	return true
+}
+
+// Lookup returns the lease that covers key.
+// Returns false if the key is not covered by a lease that has not expired.
+func (m *LeaseManager[K]) Lookup(key K) (Lease[K], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(m.now())
+	var lease Lease[K]
+	var ok bool
+	m.leases.Descend(&Lease[K]{Lo: key}, func(l *Lease[K]) bool {
+		lease, ok = *l, key < l.Hi
+		return false
+	})
+	return lease, ok
+}
+
+// Len returns the number of leases that have not expired.
+func (m *LeaseManager[K]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(m.now())
+	return m.leases.Len()
+}
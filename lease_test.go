@@ -0,0 +1,49 @@
+package btree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseManager(t *testing.T) {
+	m := NewLeaseManager[int]()
+	now := time.Unix(0, 0)
+	m.now = func() time.Time { return now }
+
+	_, ok := m.Reserve(10, 20, "a", time.Second)
+	assert(ok)
+	_, ok = m.Reserve(30, 40, "b", 2*time.Second)
+	assert(ok)
+	for _, r := range [][2]int{{5, 11}, {15, 16}, {19, 31}, {0, 100}, {39, 50},
+		{20, 20}, {25, 24}} {
+		_, ok = m.Reserve(r[0], r[1], "c", time.Second)
+		assert(!ok)
+	}
+	_, ok = m.Reserve(20, 30, "c", time.Second)
+	assert(ok)
+	assert(m.Len() == 3)
+	l, ok := m.Lookup(35)
+	assert(ok && l.Owner == "b")
+	_, ok = m.Lookup(40)
+	assert(!ok)
+
+	assert(!m.Release(20, "a"))
+	assert(m.Release(20, "c"))
+	_, ok = m.Renew(10, "b", time.Second)
+	assert(!ok)
+	l, ok = m.Renew(10, "a", 3*time.Second)
+	assert(ok && l.Expires.Equal(now.Add(3*time.Second)))
+
+	// b expires, a was renewed
+	now = now.Add(2 * time.Second)
+	assert(m.Len() == 1)
+	_, ok = m.Lookup(35)
+	assert(!ok)
+	_, ok = m.Reserve(30, 40, "d", time.Second)
+	assert(ok)
+	assert(!m.Release(30, "b"))
+	now = now.Add(time.Second)
+	assert(m.Len() == 0)
+	_, ok = m.Reserve(0, 100, "e", time.Second)
+	assert(ok)
+}
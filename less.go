@@ -0,0 +1,64 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// LessBy returns a less function that orders items by the key returned by
+// the key function.
+func LessBy[T any, K ordered](key func(item T) K) func(a, b T) bool {
+	return func(a, b T) bool {
+		return key(a) < key(b)
+	}
+}
+
+// LessBy2 returns a less function that orders items by the key returned by
+// k1, and then by the key returned by k2 for items with equal first keys.
+func LessBy2[T any, K1, K2 ordered](k1 func(item T) K1, k2 func(item T) K2,
+) func(a, b T) bool {
+	return func(a, b T) bool {
+		if a1, b1 := k1(a), k1(b); a1 != b1 {
+			return a1 < b1
+		}
+		return k2(a) < k2(b)
+	}
+}
+
+// LessBy3 is like LessBy2, with a third key for items with equal first and
+// second keys, such as (tenant, timestamp, id).
+func LessBy3[T any, K1, K2, K3 ordered](k1 func(item T) K1,
+	k2 func(item T) K2, k3 func(item T) K3,
+) func(a, b T) bool {
+	return func(a, b T) bool {
+		if a1, b1 := k1(a), k1(b); a1 != b1 {
+			return a1 < b1
+		}
+		if a2, b2 := k2(a), k2(b); a2 != b2 {
+			return a2 < b2
+		}
+		return k3(a) < k3(b)
+	}
+}
+
+// LessThen returns a less function that compares items using each of the
+// less functions in turn, moving on to the next function only when the
+// items are equal according to the previous one.
+func LessThen[T any](less ...func(a, b T) bool) func(a, b T) bool {
+	return func(a, b T) bool {
+		for _, less := range less {
+			if less(a, b) {
+				return true
+			}
+			if less(b, a) {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// LessDesc returns a less function for the reverse order of less.
+func LessDesc[T any](less func(a, b T) bool) func(a, b T) bool {
+	return func(a, b T) bool {
+		return less(b, a)
+	}
+}
@@ -0,0 +1,53 @@
+package btree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestLessBy(t *testing.T) {
+	type row struct {
+		tenant string
+		ts     int64
+		id     int
+	}
+	var rows []row
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, row{
+			string(rune('a' + rand.Intn(3))), int64(rand.Intn(10)), i,
+		})
+	}
+	tenant := func(r row) string { return r.tenant }
+	ts := func(r row) int64 { return r.ts }
+	id := func(r row) int { return r.id }
+	want := func(a, b row) bool {
+		if a.tenant != b.tenant {
+			return a.tenant < b.tenant
+		}
+		if a.ts != b.ts {
+			return a.ts < b.ts
+		}
+		return a.id < b.id
+	}
+	for _, less := range []func(a, b row) bool{
+		LessBy3(tenant, ts, id),
+		LessThen(LessBy(tenant), LessBy2(ts, id)),
+		LessThen(LessBy2(tenant, ts), LessBy(id)),
+	} {
+		tr := NewBTreeG(less)
+		for _, r := range rows {
+			tr.Set(r)
+		}
+		assert(tr.Len() == len(rows))
+		tr.sane()
+		items := tr.Items()
+		assert(sort.SliceIsSorted(items, func(i, j int) bool {
+			return want(items[i], items[j])
+		}))
+	}
+	desc := LessThen(LessBy(tenant), LessDesc(LessBy(ts)))
+	assert(desc(row{"a", 5, 0}, row{"a", 4, 0}))
+	assert(!desc(row{"a", 5, 0}, row{"a", 5, 1}))
+	assert(desc(row{"a", 0, 0}, row{"b", 9, 0}))
+}
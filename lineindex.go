@@ -0,0 +1,241 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"math/big"
+	"strings"
+)
+
+// LineIndex is a positional index of text lines for editors and config
+// diffing. Lines are looked up, inserted and deleted by line number in
+// O(log n). Copy takes an O(1) snapshot of the current version, and Diff
+// produces the edit script between two versions.
+//
+// Each line is stored under an ordering key that is generated between the
+// keys of its neighbors when it's inserted, and never changes. The key gives
+// the line an identity that is shared by every version copied from the one
+// it was inserted into.
+//
+// A LineIndex is not safe for concurrent writes.
+type LineIndex struct {
+	tr *BTreeG[lineEntry]
+}
+
+type lineEntry struct {
+	key  string
+	text string
+}
+
+// LineOp is the kind of a LineEdit.
+type LineOp int
+
+const (
+	LineInsert LineOp = iota
+	LineDelete
+	LineReplace
+)
+
+// LineEdit is a single step of an edit script. Line is the line number at
+// the time the edit is applied, after all previous edits in the script.
+type LineEdit struct {
+	Op   LineOp
+	Line int
+	Text string // the new text, for inserts and replaces
+}
+
+// NewLineIndex returns a new LineIndex holding the provided lines.
+func NewLineIndex(lines ...string) *LineIndex {
+	idx := &LineIndex{
+		tr: NewBTreeGOptions(func(a, b lineEntry) bool {
+			return a.key < b.key
+		}, Options{NoLocks: true}),
+	}
+	idx.InsertLines(0, lines...)
+	return idx
+}
+
+// Len returns the number of lines.
+func (idx *LineIndex) Len() int {
+	return idx.tr.Len()
+}
+
+// LineAt returns the text of the line at index.
+// Returns false if the index is out of bounds.
+func (idx *LineIndex) LineAt(index int) (string, bool) {
+	e, ok := idx.tr.GetAt(index)
+	return e.text, ok
+}
+
+// SetLine replaces the text of the line at index. The line keeps its
+// identity, so Diff reports the change as a replace.
+// Returns false if the index is out of bounds.
+func (idx *LineIndex) SetLine(index int, text string) bool {
+	e, ok := idx.tr.GetAt(index)
+	if !ok {
+		return false
+	}
+	e.text = text
+	idx.tr.Set(e)
+	return true
+}
+
+// InsertLines inserts lines before the line at index. An index equal to Len
+// appends the lines.
+// Panics if the index is out of bounds.
+func (idx *LineIndex) InsertLines(index int, lines ...string) {
+	if index < 0 || index > idx.tr.Len() {
+		panic("line index out of range")
+	}
+	if len(lines) == 0 {
+		return
+	}
+	var lo, hi string
+	if index > 0 {
+		e, _ := idx.tr.GetAt(index - 1)
+		lo = e.key
+	}
+	if index < idx.tr.Len() {
+		e, _ := idx.tr.GetAt(index)
+		hi = e.key
+	}
+	for i, key := range lineKeys(lo, hi, len(lines)) {
+		idx.tr.Set(lineEntry{key, lines[i]})
+	}
+}
+
+// DeleteLines deletes up to n lines starting at index.
+// Returns the number of deleted lines.
+func (idx *LineIndex) DeleteLines(index, n int) int {
+	if index < 0 || index >= idx.tr.Len() || n <= 0 {
+		return 0
+	}
+	if n > idx.tr.Len()-index {
+		n = idx.tr.Len() - index
+	}
+	first, _ := idx.tr.GetAt(index)
+	last, _ := idx.tr.GetAt(index + n - 1)
+	idx.tr.DeleteRange(first, last,
+		&DeleteRangeOptions{NoReturn: true, MaxInclusive: true})
+	return n
+}
+
+// Lines iterates over the lines in order, starting at index.
+// Return false to stop iterating.
+func (idx *LineIndex) Lines(index int, iter func(index int, text string) bool) {
+	idx.tr.AscendLimit(lineEntry{}, index, idx.tr.Len(),
+		func(e lineEntry) bool {
+			ok := iter(index, e.text)
+			index++
+			return ok
+		})
+}
+
+// String returns the lines joined by newlines.
+func (idx *LineIndex) String() string {
+	var sb strings.Builder
+	idx.tr.Scan(func(e lineEntry) bool {
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(e.text)
+		return true
+	})
+	return sb.String()
+}
+
+// Copy returns a snapshot of the current version. This is a copy-on-write
+// operation and is very fast.
+func (idx *LineIndex) Copy() *LineIndex {
+	return &LineIndex{tr: idx.tr.Copy()}
+}
+
+// Diff returns the edit script that transforms the old version into idx.
+// Both must be copied from the same LineIndex. The script is minimal with
+// respect to line identity: a line that was deleted and reinserted with the
+// same text is reported as a delete and an insert.
+func (idx *LineIndex) Diff(old *LineIndex) []LineEdit {
+	var edits []LineEdit
+	iter1, iter2 := old.tr.Iter(), idx.tr.Iter()
+	defer iter1.Release()
+	defer iter2.Release()
+	ok1, ok2 := iter1.First(), iter2.First()
+	var line int
+	for ok1 || ok2 {
+		switch {
+		case ok1 && (!ok2 || iter1.Item().key < iter2.Item().key):
+			edits = append(edits, LineEdit{Op: LineDelete, Line: line})
+			ok1 = iter1.Next()
+		case ok2 && (!ok1 || iter2.Item().key < iter1.Item().key):
+			edits = append(edits, LineEdit{LineInsert, line, iter2.Item().text})
+			line++
+			ok2 = iter2.Next()
+		default:
+			if iter1.Item().text != iter2.Item().text {
+				edits = append(edits,
+					LineEdit{LineReplace, line, iter2.Item().text})
+			}
+			line++
+			ok1, ok2 = iter1.Next(), iter2.Next()
+		}
+	}
+	return edits
+}
+
+// lineKeys returns n ordered keys that sort between lo and hi. An empty lo
+// sorts before all keys and an empty hi sorts after all keys.
+//
+// Keys are base-256 fractions, with trailing zeros trimmed so that string
+// order matches numeric order. They are spaced evenly but at most 2^32
+// apart, which leaves room for billions of appends or prepends before the
+// keys grow longer than eight bytes.
+func lineKeys(lo, hi string, n int) []string {
+	size := 8
+	if len(lo) > size {
+		size = len(lo)
+	}
+	if len(hi) > size {
+		size = len(hi)
+	}
+	for ; ; size++ {
+		a := lineKeyInt(lo, size)
+		b := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+		if hi != "" {
+			b = lineKeyInt(hi, size)
+		} else if lo == "" {
+			// start an empty index in the middle of the key space
+			a.Rsh(b, 1)
+		}
+		step := new(big.Int).Sub(b, a)
+		step.Quo(step, big.NewInt(int64(n+1)))
+		if step.Sign() == 0 {
+			continue
+		}
+		if max := new(big.Int).Lsh(big.NewInt(1), 32); step.Cmp(max) > 0 {
+			step = max
+		}
+		// keys are placed just before hi when prepending, and just after lo
+		// otherwise
+		base := a
+		if lo == "" && hi != "" {
+			base = new(big.Int).Mul(step, big.NewInt(int64(n+1)))
+			base.Sub(b, base)
+		}
+		keys := make([]string, n)
+		buf := make([]byte, size)
+		for i := range keys {
+			base.Add(base, step)
+			base.FillBytes(buf)
+			keys[i] = strings.TrimRight(string(buf), "\x00")
+		}
+		return keys
+	}
+}
+
+// lineKeyInt returns the key as an integer of size bytes.
+func lineKeyInt(key string, size int) *big.Int {
+	buf := make([]byte, size)
+	copy(buf, key)
+	return new(big.Int).SetBytes(buf)
+}
@@ -0,0 +1,103 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func applyLineEdits(lines []string, edits []LineEdit) []string {
+	lines = append([]string(nil), lines...)
+	for _, e := range edits {
+		switch e.Op {
+		case LineInsert:
+			lines = append(lines[:e.Line],
+				append([]string{e.Text}, lines[e.Line:]...)...)
+		case LineDelete:
+			lines = append(lines[:e.Line], lines[e.Line+1:]...)
+		case LineReplace:
+			lines[e.Line] = e.Text
+		}
+	}
+	return lines
+}
+
+func TestLineIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	idx := NewLineIndex("a", "b", "c")
+	assert(idx.String() == "a\nb\nc")
+	var lines []string
+	idx.Lines(0, func(index int, text string) bool {
+		lines = append(lines, text)
+		return true
+	})
+	assert(strings.Join(lines, "") == "abc")
+	old, oldLines := idx.Copy(), lines
+	for i := 0; i < 2000; i++ {
+		index := rng.Intn(len(lines) + 1)
+		switch rng.Intn(4) {
+		case 0, 1:
+			var text []string
+			for j := rng.Intn(5); j >= 0; j-- {
+				text = append(text, fmt.Sprint(i, j))
+			}
+			idx.InsertLines(index, text...)
+			lines = append(lines[:index],
+				append(text, lines[index:]...)...)
+		case 2:
+			n := rng.Intn(4)
+			deleted := idx.DeleteLines(index, n)
+			if n > len(lines)-index {
+				n = len(lines) - index
+			}
+			assert(deleted == n)
+			lines = append(lines[:index], lines[index+n:]...)
+		case 3:
+			text := fmt.Sprint(i)
+			ok := idx.SetLine(index, text)
+			assert(ok == (index < len(lines)))
+			if ok {
+				lines[index] = text
+			}
+		}
+		assert(idx.Len() == len(lines))
+		if i%100 == 0 {
+			assert(idx.String() == strings.Join(lines, "\n"))
+			edits := idx.Diff(old)
+			assert(strings.Join(applyLineEdits(oldLines, edits), "\n") ==
+				strings.Join(lines, "\n"))
+			old, oldLines = idx.Copy(), append([]string(nil), lines...)
+		}
+	}
+	for i, line := range lines {
+		text, ok := idx.LineAt(i)
+		assert(ok && text == line)
+	}
+	_, ok := idx.LineAt(len(lines))
+	assert(!ok)
+	assert(len(idx.Diff(idx.Copy())) == 0)
+}
+
+func TestLineIndexKeys(t *testing.T) {
+	// appending and prepending one line at a time keeps keys short
+	idx := NewLineIndex()
+	for i := 0; i < 1000; i++ {
+		idx.InsertLines(idx.Len(), "x")
+		idx.InsertLines(0, "x")
+	}
+	idx.tr.Scan(func(e lineEntry) bool {
+		assert(len(e.key) <= 8)
+		return true
+	})
+	// inserting repeatedly at one spot grows keys slowly
+	for i := 0; i < 1000; i++ {
+		idx.InsertLines(1000, "y")
+	}
+	var prev string
+	idx.tr.Scan(func(e lineEntry) bool {
+		assert(len(e.key) <= 8+1000/8+1 && e.key > prev)
+		prev = e.key
+		return true
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package lsm
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	// DefaultCompactionTrigger is the default number of similarly sized
+	// tables that triggers a compaction.
+	DefaultCompactionTrigger = 4
+	// maxCompactionTables is the most tables merged by one compaction.
+	maxCompactionTables = 32
+)
+
+// signalCompaction wakes the background compaction. The DB must be locked.
+func (db *DB) signalCompaction() {
+	select {
+	case db.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+func (db *DB) compactLoop() {
+	defer db.done.Done()
+	for range db.compactCh {
+		if db.opts.CompactionTrigger < 0 {
+			continue
+		}
+		for {
+			ok, err := db.compact(false)
+			if err != nil && err != ErrClosed {
+				db.mu.Lock()
+				db.compactErr = err
+				db.mu.Unlock()
+			}
+			if !ok || err != nil {
+				break
+			}
+		}
+	}
+}
+
+// Compact merges all tables into a single table, purging tombstones.
+// It does not flush the memtable.
+func (db *DB) Compact() error {
+	_, err := db.compact(true)
+	return err
+}
+
+// pickRun returns the range [i, j) of the first run of adjacent tables with
+// similar sizes that is long enough to trigger a compaction. Tables that are
+// smaller than a memtable are considered to be of the same size.
+func pickRun(tables []*table, trigger int, minSize int64) (i, j int) {
+	size := func(t *table) int64 {
+		if t.size < minSize {
+			return minSize
+		}
+		return t.size
+	}
+	for i = 0; i < len(tables); i++ {
+		total := size(tables[i])
+		for j = i + 1; j < len(tables) && j-i < maxCompactionTables; j++ {
+			avg := total / int64(j-i)
+			if s := size(tables[j]); s < avg/2 || s > avg*2 {
+				break
+			}
+			total += size(tables[j])
+		}
+		if j-i >= trigger {
+			return i, j
+		}
+	}
+	return 0, 0
+}
+
+// compact merges a run of tables into one. When full is true all tables are
+// merged, otherwise the run is chosen by pickRun.
+// Returns false if there was nothing to compact.
+func (db *DB) compact(full bool) (bool, error) {
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return false, ErrClosed
+	}
+	i, j := 0, len(db.tables)
+	if !full {
+		i, j = pickRun(db.tables, db.opts.CompactionTrigger,
+			int64(db.opts.MemtableSize))
+	}
+	if j-i < 2 {
+		db.mu.RUnlock()
+		return false, nil
+	}
+	run := append([]*table(nil), db.tables[i:j]...)
+	for _, t := range run {
+		t.acquire()
+	}
+	bottom := j == len(db.tables)
+	db.mu.RUnlock()
+	defer releaseTables(run)
+
+	t, err := db.writeTable(run[len(run)-1].lo, run[0].hi,
+		db.opts.CompactionRate, func(add func(key, value []byte) error,
+		) error {
+			m := newMergeIter(nil, run)
+			defer m.release()
+			var buf []byte
+			for ok := m.seek(nil); ok; ok = m.next() {
+				if m.deleted && bottom {
+					continue
+				}
+				buf = appendValue(buf[:0], m.value, m.deleted)
+				if err := add(m.key, buf); err != nil {
+					return err
+				}
+			}
+			return m.err
+		})
+	if err != nil {
+		return false, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		// the table is complete and covers the run, which is removed the
+		// next time the DB is opened
+		t.release()
+		return false, ErrClosed
+	}
+	// flushes only add newer tables, so the run is still in place
+	for i = 0; db.tables[i] != run[0]; i++ {
+	}
+	tables := append([]*table(nil), db.tables[:i]...)
+	tables = append(tables, t)
+	db.tables = append(tables, db.tables[i+len(run):]...)
+	for _, t := range run {
+		t.obsolete.Store(true)
+		t.release()
+	}
+	return true, nil
+}
+
+// throttledWriter limits the rate of writes to w in bytes per second.
+type throttledWriter struct {
+	w     io.Writer
+	rate  int
+	start time.Time
+	n     int64
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	due := time.Duration(w.n * int64(time.Second) / int64(w.rate))
+	if ahead := due - time.Since(w.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+	return n, err
+}
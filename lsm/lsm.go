@@ -0,0 +1,567 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package lsm is a small log-structured merge storage engine.
+//
+// Writes go to an in-memory btree.BTreeG memtable. When the memtable grows
+// past Options.MemtableSize it's flushed to an immutable sstable file. The
+// table is written in the background of a fresh memtable, so reads and writes
+// continue during a flush. Reads merge the memtables with the tables, newest
+// first, so the latest write for a key wins and deletes are recorded as
+// tombstones until they are merged away.
+//
+// A background compaction merges runs of similarly sized tables into one
+// larger table, which keeps the number of tables that a read must consult
+// logarithmic in the size of the data. Tombstones are purged when a
+// compaction includes the oldest table, because there is no older data left
+// for them to hide.
+//
+// Table files are named after the range of flushes they hold, so a table
+// left over from a compaction that was interrupted by a crash is recognized
+// as covered by the compacted table and removed on Open.
+//
+// There is no write-ahead log. Writes that have not been flushed, either
+// explicitly or by Close, are lost if the process exits.
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/btree"
+	"github.com/tidwall/btree/sstable"
+)
+
+// DefaultMemtableSize is the memtable size at which it's flushed to a table.
+const DefaultMemtableSize = 4 << 20
+
+// ErrClosed is returned when using a closed DB.
+var ErrClosed = errors.New("lsm: closed")
+
+// Value kinds, stored as the first byte of each table value.
+const (
+	kindValue     = 0
+	kindTombstone = 1
+)
+
+// Options for passing to the Open function.
+type Options struct {
+	// MemtableSize is the approximate size in bytes of keys and values held
+	// in memory before they are flushed to a table. Default is
+	// DefaultMemtableSize.
+	MemtableSize int
+	// Table options used when writing tables.
+	Table *sstable.Options
+	// CompactionTrigger is the number of similarly sized adjacent tables
+	// that triggers a compaction. Default is DefaultCompactionTrigger. Set
+	// to a negative number to only compact when Compact is called.
+	CompactionTrigger int
+	// CompactionRate, if provided, limits the rate in bytes per second at
+	// which compactions write tables, leaving disk bandwidth for flushes
+	// and reads.
+	CompactionRate int
+}
+
+// DB is a key-value store.
+// It's safe for concurrent use by multiple goroutines.
+type DB struct {
+	mu      sync.RWMutex
+	dir     string
+	opts    Options
+	mem     *btree.BTreeG[memEntry]
+	memSize int
+	imm     *btree.BTreeG[memEntry] // memtable being flushed, if any
+	tables  []*table                // newest first
+	nextID  uint64
+	closed  bool
+
+	flushMu    sync.Mutex    // held while a flush runs
+	compactMu  sync.Mutex    // held while a compaction runs
+	compactCh  chan struct{} // signals the background compaction
+	compactErr error         // last background compaction error
+	done       sync.WaitGroup
+}
+
+type memEntry struct {
+	key     string
+	value   []byte
+	deleted bool
+}
+
+// table is an open table file. It's reference counted so that it can be
+// removed by a compaction while readers are still using it.
+type table struct {
+	lo, hi uint64 // range of flush ids held by the table
+	path   string
+	f      *os.File
+	rd     *sstable.Reader
+	size   int64
+	refs   int32
+	// obsolete tables are removed when the last reference is released
+	obsolete atomic.Bool
+}
+
+func (t *table) acquire() {
+	atomic.AddInt32(&t.refs, 1)
+}
+
+func (t *table) release() {
+	if atomic.AddInt32(&t.refs, -1) == 0 {
+		t.f.Close()
+		if t.obsolete.Load() {
+			os.Remove(t.path)
+		}
+	}
+}
+
+func newMemtable() *btree.BTreeG[memEntry] {
+	return btree.NewBTreeGOptions(func(a, b memEntry) bool {
+		return a.key < b.key
+	}, btree.Options{NoLocks: true})
+}
+
+func tableName(lo, hi uint64) string {
+	return fmt.Sprintf("%06d-%06d.sst", lo, hi)
+}
+
+// Open the DB stored in dir, creating the directory if needed.
+func Open(dir string, opts *Options) (*DB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	db := &DB{dir: dir, mem: newMemtable(), nextID: 1}
+	if opts != nil {
+		db.opts = *opts
+	}
+	if db.opts.MemtableSize <= 0 {
+		db.opts.MemtableSize = DefaultMemtableSize
+	}
+	if db.opts.CompactionTrigger == 0 {
+		db.opts.CompactionTrigger = DefaultCompactionTrigger
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.sst"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		var lo, hi uint64
+		base := filepath.Base(name)
+		if _, err := fmt.Sscanf(base, "%d-%d.sst", &lo, &hi); err != nil ||
+			tableName(lo, hi) != base {
+			continue
+		}
+		t, err := openTable(name, lo, hi)
+		if err != nil {
+			db.closeTables()
+			return nil, err
+		}
+		db.tables = append(db.tables, t)
+		if hi >= db.nextID {
+			db.nextID = hi + 1
+		}
+	}
+	// wider ranges first, so that covered tables follow their compaction
+	sort.Slice(db.tables, func(i, j int) bool {
+		if db.tables[i].hi != db.tables[j].hi {
+			return db.tables[i].hi > db.tables[j].hi
+		}
+		return db.tables[i].lo < db.tables[j].lo
+	})
+	tables := db.tables[:0]
+	for _, t := range db.tables {
+		if len(tables) > 0 && tables[len(tables)-1].lo <= t.lo {
+			// left over from an interrupted compaction
+			t.obsolete.Store(true)
+			t.release()
+			continue
+		}
+		tables = append(tables, t)
+	}
+	db.tables = tables
+	// remove tables that were being written when the process exited
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*.sst.tmp"))
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+	db.compactCh = make(chan struct{}, 1)
+	db.done.Add(1)
+	go db.compactLoop()
+	db.signalCompaction()
+	return db, nil
+}
+
+func openTable(path string, lo, hi uint64) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rd, err := sstable.Open(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &table{lo: lo, hi: hi, path: path, f: f, rd: rd, size: fi.Size(),
+		refs: 1}, nil
+}
+
+func (db *DB) closeTables() {
+	for _, t := range db.tables {
+		t.release()
+	}
+	db.tables = nil
+}
+
+// Put sets the value for a key.
+func (db *DB) Put(key, value []byte) error {
+	return db.write(key, value, false)
+}
+
+// Delete the value for a key.
+func (db *DB) Delete(key []byte) error {
+	return db.write(key, nil, true)
+}
+
+func (db *DB) write(key, value []byte, deleted bool) error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	e := memEntry{string(key), append([]byte(nil), value...), deleted}
+	prev, replaced := db.mem.Set(e)
+	if replaced {
+		db.memSize -= len(prev.key) + len(prev.value)
+	}
+	db.memSize += len(e.key) + len(e.value)
+	full := db.memSize >= db.opts.MemtableSize
+	db.mu.Unlock()
+	if full {
+		// The write has landed in the memtable, so a failed flush does not
+		// fail it. The entries stay in the memtable and the flush is retried
+		// by the next one, or reported by Flush or Close.
+		db.flush(false)
+	}
+	return nil
+}
+
+// Get the value for a key.
+// Returns false if the key was not found.
+func (db *DB) Get(key []byte) ([]byte, bool, error) {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return nil, false, ErrClosed
+	}
+	if e, ok := db.mem.Get(memEntry{key: string(key)}); ok {
+		db.mu.RUnlock()
+		if e.deleted {
+			return nil, false, nil
+		}
+		// the memtable keeps the value, so the caller gets a copy as it
+		// does for table values
+		return append([]byte(nil), e.value...), true, nil
+	}
+	if db.imm != nil {
+		if e, ok := db.imm.Get(memEntry{key: string(key)}); ok {
+			db.mu.RUnlock()
+			if e.deleted {
+				return nil, false, nil
+			}
+			return append([]byte(nil), e.value...), true, nil
+		}
+	}
+	tables := db.acquireTables()
+	db.mu.RUnlock()
+	defer releaseTables(tables)
+	for _, t := range tables {
+		value, ok, err := t.rd.Get(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			if len(value) == 0 || value[0] == kindTombstone {
+				return nil, false, nil
+			}
+			return append([]byte(nil), value[1:]...), true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// acquireTables returns the current tables, newest first, with a reference
+// held on each. The DB must be locked.
+func (db *DB) acquireTables() []*table {
+	tables := append([]*table(nil), db.tables...)
+	for _, t := range tables {
+		t.acquire()
+	}
+	return tables
+}
+
+func releaseTables(tables []*table) {
+	for _, t := range tables {
+		t.release()
+	}
+}
+
+// Flush writes the memtable to a new table.
+func (db *DB) Flush() error {
+	return db.flush(true)
+}
+
+// flush moves the memtable aside as the immutable memtable and writes it to
+// a new table without holding the DB lock. Reads consult the immutable
+// memtable until the table is installed. Unless force is true, the memtable
+// is only flushed when it has reached Options.MemtableSize, because a flush
+// that ran while waiting for flushMu may have already moved it aside.
+func (db *DB) flush(force bool) error {
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	if db.mem.Len() == 0 || (!force && db.memSize < db.opts.MemtableSize) {
+		db.mu.Unlock()
+		return nil
+	}
+	imm, immSize, id := db.mem, db.memSize, db.nextID
+	snap := imm.Copy()
+	db.imm = imm
+	db.mem = newMemtable()
+	db.memSize = 0
+	db.nextID++
+	db.mu.Unlock()
+
+	t, err := db.writeMemtable(snap, id)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.imm = nil
+	if err != nil {
+		// put the newer writes over the immutable memtable, which becomes
+		// the memtable again so that the next flush retries it
+		db.mem.Scan(func(e memEntry) bool {
+			prev, replaced := imm.Set(e)
+			if replaced {
+				immSize -= len(prev.key) + len(prev.value)
+			}
+			immSize += len(e.key) + len(e.value)
+			return true
+		})
+		db.mem, db.memSize = imm, immSize
+		return err
+	}
+	db.tables = append([]*table{t}, db.tables...)
+	db.signalCompaction()
+	return nil
+}
+
+// writeMemtable writes the memtable to a new table with the flush id.
+func (db *DB) writeMemtable(mem *btree.BTreeG[memEntry], id uint64,
+) (*table, error) {
+	return db.writeTable(id, id, 0, func(add func(key, value []byte) error,
+	) error {
+		var err error
+		var buf []byte
+		mem.Scan(func(e memEntry) bool {
+			buf = appendValue(buf[:0], e.value, e.deleted)
+			err = add([]byte(e.key), buf)
+			return err == nil
+		})
+		return err
+	})
+}
+
+func appendValue(dst, value []byte, deleted bool) []byte {
+	if deleted {
+		return append(dst, kindTombstone)
+	}
+	return append(append(dst, kindValue), value...)
+}
+
+// writeTable writes a new table holding the range of flush ids. The table is
+// written to a temporary file that is renamed once it's complete, so a
+// partially written table is never opened. A non-zero rate limits the write
+// rate in bytes per second.
+func (db *DB) writeTable(lo, hi uint64, rate int,
+	fill func(add func(key, value []byte) error) error,
+) (*table, error) {
+	path := filepath.Join(db.dir, tableName(lo, hi))
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	var w io.Writer = f
+	if rate > 0 {
+		w = &throttledWriter{w: f, rate: rate, start: time.Now()}
+	}
+	wr := sstable.NewWriter(w, db.opts.Table)
+	err = fill(wr.Add)
+	if err == nil {
+		err = wr.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return nil, err
+	}
+	return openTable(path, lo, hi)
+}
+
+// Close flushes the memtable, waits for a running compaction and closes
+// the DB.
+func (db *DB) Close() error {
+	// holding flushMu means that there's no immutable memtable
+	db.flushMu.Lock()
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		db.flushMu.Unlock()
+		return ErrClosed
+	}
+	var err error
+	if db.mem.Len() > 0 {
+		var t *table
+		t, err = db.writeMemtable(db.mem, db.nextID)
+		if err == nil {
+			db.nextID++
+			db.tables = append([]*table{t}, db.tables...)
+			db.mem = newMemtable()
+			db.memSize = 0
+		}
+	}
+	db.closed = true
+	close(db.compactCh)
+	db.mu.Unlock()
+	db.flushMu.Unlock()
+	db.done.Wait()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closeTables()
+	if err == nil {
+		err = db.compactErr
+	}
+	return err
+}
+
+// Scan the keys within the range [start, end) in key order, along with their
+// values. An empty end scans to the last key.
+// Return false to stop iterating.
+//
+// The scan reads a consistent snapshot of the DB, and writes may continue
+// while it runs. The key and value are only valid until iter returns.
+func (db *DB) Scan(start, end []byte, iter func(key, value []byte) bool,
+) error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	mems := []*btree.BTreeG[memEntry]{db.mem.Copy()}
+	if db.imm != nil {
+		mems = append(mems, db.imm.Copy())
+	}
+	tables := db.acquireTables()
+	db.mu.Unlock()
+	defer releaseTables(tables)
+
+	m := newMergeIter(mems, tables)
+	defer m.release()
+	for ok := m.seek(start); ok; ok = m.next() {
+		if len(end) > 0 && bytes.Compare(m.key, end) >= 0 {
+			break
+		}
+		if m.deleted {
+			continue
+		}
+		if !iter(m.key, m.value) {
+			break
+		}
+	}
+	return m.err
+}
+
+// KeyRange is the range of keys [Start, End). An empty End extends the range
+// to the last key.
+type KeyRange struct {
+	Start, End []byte
+}
+
+// Prefetch reads the table blocks that hold the key ranges, so that the
+// first reads of hot ranges after Open are served from the operating system
+// cache rather than waiting on the disk. Up to concurrency blocks are read at
+// once, or one if concurrency is less than one.
+func (db *DB) Prefetch(ranges []KeyRange, concurrency int) error {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	tables := db.acquireTables()
+	db.mu.RUnlock()
+	defer releaseTables(tables)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for _, t := range tables {
+		for _, r := range ranges {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(t *table, r KeyRange) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if err := t.rd.Prefetch(r.Start, r.End); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}(t, r)
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Tables returns the file names of the tables, newest first.
+func (db *DB) Tables() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var names []string
+	for _, t := range db.tables {
+		names = append(names, filepath.Base(t.path))
+	}
+	return names
+}
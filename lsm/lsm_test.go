@@ -0,0 +1,308 @@
+package lsm
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func checkDB(t *testing.T, db *DB, expect map[string]string) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key:%04d", i)
+		value, ok, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		evalue, eok := expect[key]
+		if ok != eok || string(value) != evalue {
+			t.Fatalf("%s: expected %v %q, got %v %q", key, eok, evalue, ok,
+				value)
+		}
+	}
+	var keys []string
+	for key := range expect {
+		if key >= "key:0100" && key < "key:0400" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var i int
+	err := db.Scan([]byte("key:0100"), []byte("key:0400"),
+		func(key, value []byte) bool {
+			if i >= len(keys) || string(key) != keys[i] ||
+				string(value) != expect[keys[i]] {
+				t.Fatalf("bad scan at %d: %q %q", i, key, value)
+			}
+			i++
+			return true
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), i)
+	}
+}
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	opts := &Options{MemtableSize: 1024}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := make(map[string]string)
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("key:%04d", rng.Intn(500))
+		if rng.Intn(4) == 0 {
+			err = db.Delete([]byte(key))
+			delete(expect, key)
+		} else {
+			value := fmt.Sprint(i)
+			err = db.Put([]byte(key), []byte(value))
+			expect[key] = value
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%1000 == 0 {
+			checkDB(t, db, expect)
+		}
+	}
+	if len(db.Tables()) == 0 {
+		t.Fatal("expected flushed tables")
+	}
+	checkDB(t, db, expect)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("a"), nil); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Prefetch([]KeyRange{
+		{Start: []byte("key:0100"), End: []byte("key:0200")},
+		{Start: []byte("key:0400")},
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDB(t, db, expect)
+}
+
+func TestScanSnapshot(t *testing.T) {
+	db, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		db.Put([]byte{byte(i)}, []byte{byte(i)})
+	}
+	db.Flush()
+	var n int
+	db.Scan(nil, nil, func(key, value []byte) bool {
+		// writes during a scan are not seen by it
+		db.Put([]byte{byte(n + 100)}, nil)
+		db.Delete([]byte{byte(9 - n)})
+		n++
+		return true
+	})
+	if n != 10 {
+		t.Fatalf("expected 10, got %d", n)
+	}
+}
+
+func TestGetCopy(t *testing.T) {
+	db, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("a"), []byte("value"))
+	value, _, _ := db.Get([]byte("a"))
+	value[0] = 'X'
+	value, ok, err := db.Get([]byte("a"))
+	if err != nil || !ok || string(value) != "value" {
+		t.Fatalf("expected value, got %q %v %v", value, ok, err)
+	}
+}
+
+func TestFlushError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	opts := &Options{MemtableSize: 64, CompactionTrigger: -1}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flushes fail while the directory is missing
+	os.RemoveAll(dir)
+	expect := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key, value := fmt.Sprintf("key:%04d", i), fmt.Sprint(i)
+		if err := db.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("write failed with the flush: %v", err)
+		}
+		expect[key] = value
+	}
+	if err := db.Flush(); err == nil {
+		t.Fatal("expected flush error")
+	}
+	checkDB(t, db, expect)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Tables()) != 1 {
+		t.Fatalf("expected 1 table, got %d", len(db.Tables()))
+	}
+	checkDB(t, db, expect)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkDB(t, db, expect)
+}
+
+func TestFlushConcurrent(t *testing.T) {
+	db, err := Open(t.TempDir(), &Options{MemtableSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// keys written before the readers start must be seen while the
+	// memtables holding them are flushed
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("key:%04d", i)), []byte("x"))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("new:%d:%04d", w, i)
+				if err := db.Put([]byte(key), []byte("y")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key:%04d", i%100)
+				value, ok, err := db.Get([]byte(key))
+				if err != nil || !ok || string(value) != "x" {
+					t.Errorf("%s: got %q %v %v", key, value, ok, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	var n int
+	db.Scan(nil, nil, func(key, value []byte) bool {
+		n++
+		return true
+	})
+	if n != 2100 {
+		t.Fatalf("expected 2100 keys, got %d", n)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	opts := &Options{MemtableSize: 256, CompactionTrigger: -1}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("key:%04d", i%500)
+		if i%3 == 0 {
+			db.Delete([]byte(key))
+			delete(expect, key)
+		} else {
+			db.Put([]byte(key), []byte(fmt.Sprint(i)))
+			expect[key] = fmt.Sprint(i)
+		}
+	}
+	db.Flush()
+	tables := db.Tables()
+	if len(tables) < 20 {
+		t.Fatalf("expected many tables, got %d", len(tables))
+	}
+	// keep a copy of a table to simulate a crash before it was removed
+	leftover, err := os.ReadFile(filepath.Join(dir, tables[3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Tables()) != 1 {
+		t.Fatalf("expected 1 table, got %v", db.Tables())
+	}
+	checkDB(t, db, expect)
+	// tombstones were purged
+	var n int
+	it := db.tables[0].rd.Iter()
+	for ok := it.First(); ok; ok = it.Next() {
+		n++
+	}
+	if n != len(expect) {
+		t.Fatalf("expected %d entries, got %d", len(expect), n)
+	}
+	db.Close()
+	os.WriteFile(filepath.Join(dir, tables[3]), leftover, 0o644)
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if len(db.Tables()) != 1 {
+		t.Fatalf("expected 1 table, got %v", db.Tables())
+	}
+	if _, err := os.Stat(filepath.Join(dir, tables[3])); !os.IsNotExist(err) {
+		t.Fatalf("expected leftover table to be removed, got %v", err)
+	}
+	checkDB(t, db, expect)
+}
+
+func TestPickRun(t *testing.T) {
+	var tables []*table
+	for _, size := range []int64{10, 100, 100, 120, 90, 1000, 4000, 4000,
+		4000, 4000} {
+		tables = append(tables, &table{size: size})
+	}
+	if i, j := pickRun(tables, 4, 50); i != 0 || j != 5 {
+		t.Fatalf("expected [0, 5), got [%d, %d)", i, j)
+	}
+	if i, j := pickRun(tables, 4, 1); i != 1 || j != 5 {
+		t.Fatalf("expected [1, 5), got [%d, %d)", i, j)
+	}
+	if i, j := pickRun(tables[5:], 4, 1); i != 1 || j != 5 {
+		t.Fatalf("expected [1, 5), got [%d, %d)", i, j)
+	}
+	if i, j := pickRun(tables, 5, 1); i != 0 || j != 0 {
+		t.Fatalf("expected no run, got [%d, %d)", i, j)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package lsm
+
+import (
+	"bytes"
+
+	"github.com/tidwall/btree"
+	"github.com/tidwall/btree/sstable"
+)
+
+// mergeSource is a sorted source of entries for a mergeIter, either a
+// memtable or a table.
+type mergeSource struct {
+	mem     *btree.IterG[memEntry]
+	table   *sstable.Iterator
+	valid   bool
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+func (s *mergeSource) seek(key []byte) {
+	if s.mem != nil {
+		s.valid = s.mem.Seek(memEntry{key: string(key)})
+	} else {
+		s.valid = s.table.Seek(key)
+	}
+	s.load()
+}
+
+func (s *mergeSource) next() {
+	if s.mem != nil {
+		s.valid = s.mem.Next()
+	} else {
+		s.valid = s.table.Next()
+	}
+	s.load()
+}
+
+func (s *mergeSource) load() {
+	if !s.valid {
+		return
+	}
+	if s.mem != nil {
+		e := s.mem.Item()
+		s.key, s.value, s.deleted = []byte(e.key), e.value, e.deleted
+		return
+	}
+	s.key = s.table.Key()
+	value := s.table.Value()
+	s.deleted = len(value) == 0 || value[0] == kindTombstone
+	if !s.deleted {
+		s.value = value[1:]
+	}
+}
+
+// mergeIter merges sorted sources into a single sorted sequence. When more
+// than one source holds a key, the entry from the earliest source wins.
+// Deleted entries are returned, so that tombstones can be carried forward
+// by compactions.
+type mergeIter struct {
+	sources []*mergeSource // newest first
+	key     []byte
+	value   []byte
+	deleted bool
+	err     error
+}
+
+// newMergeIter returns a mergeIter over the memtables and the tables, both
+// newest first.
+func newMergeIter(mems []*btree.BTreeG[memEntry], tables []*table,
+) *mergeIter {
+	m := new(mergeIter)
+	for _, mem := range mems {
+		iter := mem.Iter()
+		m.sources = append(m.sources, &mergeSource{mem: &iter})
+	}
+	for _, t := range tables {
+		m.sources = append(m.sources, &mergeSource{table: t.rd.Iter()})
+	}
+	return m
+}
+
+func (m *mergeIter) release() {
+	for _, s := range m.sources {
+		if s.mem != nil {
+			s.mem.Release()
+		}
+	}
+}
+
+// seek moves to the first key greater than or equal to key.
+func (m *mergeIter) seek(key []byte) bool {
+	for _, s := range m.sources {
+		s.seek(key)
+	}
+	return m.pick()
+}
+
+// next moves past the current key in every source.
+func (m *mergeIter) next() bool {
+	for _, s := range m.sources {
+		if s.valid && bytes.Equal(s.key, m.key) {
+			s.next()
+		}
+	}
+	return m.pick()
+}
+
+// pick makes the smallest key across the sources current.
+func (m *mergeIter) pick() bool {
+	var min *mergeSource
+	for _, s := range m.sources {
+		if !s.valid {
+			if s.table != nil && s.table.Err() != nil {
+				m.err = s.table.Err()
+				return false
+			}
+			continue
+		}
+		if min == nil || bytes.Compare(s.key, min.key) < 0 {
+			min = s
+		}
+	}
+	if min == nil {
+		return false
+	}
+	m.key = append(m.key[:0], min.key...)
+	m.value = append(m.value[:0], min.value...)
+	m.deleted = min.deleted
+	return true
+}
@@ -36,6 +36,12 @@ func newIsoID() uint64 {
 	return atomic.AddUint64(&gisoid, 1)
 }
 
+// KV is a key/value pair of a Map.
+type KV[K ordered, V any] struct {
+	Key   K
+	Value V
+}
+
 type mapPair[K ordered, V any] struct {
 	// The `value` field should be before the `key` field because doing so
 	// allows for the Go compiler to optimize away the `value` field when
@@ -129,19 +135,28 @@ func (n *mapNode[K, V]) leaf() bool {
 }
 
 func (tr *Map[K, V]) search(n *mapNode[K, V], key K) (index int, found bool) {
-	low, high := 0, len(n.items)
-	for low < high {
-		h := (low + high) / 2
-		if !(key < n.items[h].key) {
-			low = h + 1
-		} else {
-			high = h
+	// Branch-reduced binary search. The loop always runs log2(n) times and
+	// the conditional add compiles to a conditional move for integer keys,
+	// which avoids the branch mispredictions that dominate wide nodes.
+	items := n.items
+	if len(items) == 0 {
+		return 0, false
+	}
+	base, size := 0, len(items)
+	for size > 1 {
+		half := size >> 1
+		if !(key < items[base+half].key) {
+			base += half
 		}
+		size -= half
 	}
-	if low > 0 && !(n.items[low-1].key < key) {
-		return low - 1, true
+	if key < items[base].key {
+		return base, false
 	}
-	return low, false
+	if items[base].key < key {
+		return base + 1, false
+	}
+	return base, true
 }
 
 func (tr *Map[K, V]) init(degree int) {
@@ -705,6 +720,18 @@ func (tr *Map[K, V]) maxMut(mut bool) (K, V, bool) {
 	}
 }
 
+// Drain removes key/value pairs in ascending order, passing each removed
+// pair to iter. Return false to stop draining. The pair passed to that call
+// has already been removed, so every pair is consumed exactly once.
+func (tr *Map[K, V]) Drain(iter func(key K, value V) bool) {
+	for {
+		key, value, ok := tr.PopMin()
+		if !ok || !iter(key, value) {
+			return
+		}
+	}
+}
+
 // PopMin removes the minimum item in tree and returns it.
 // Returns nil if the tree has no items.
 func (tr *Map[K, V]) PopMin() (K, V, bool) {
@@ -878,6 +905,102 @@ outer:
 	return tr.empty.key, tr.empty.value, false
 }
 
+// DeleteAll deletes every key/value pair for which pred returns true, using
+// a single traversal of the tree.
+// Returns the deleted pairs, in order.
+//
+// Pairs are removed in place, except when that would leave a node with too
+// few items. Such a pair is deleted from the root, rebalancing the tree, and
+// the traversal restarts from the root after it, which costs O(log n) for
+// each of those pairs.
+func (tr *Map[K, V]) DeleteAll(pred func(key K, value V) bool) []KV[K, V] {
+	var deleted []KV[K, V]
+	type stackItem struct {
+		node  *mapNode[K, V]
+		index int
+	}
+	var stack []stackItem
+	var pivot K
+	first := true
+restart:
+	if tr.root == nil {
+		return deleted
+	}
+	n := tr.isoLoad(&tr.root, true)
+	stack = append(stack[:0], stackItem{n, 0})
+	for {
+		var i int
+		var found bool
+		if !first {
+			i, found = tr.search(n, pivot)
+		}
+	next:
+		if n.children != nil {
+			if found {
+				item := n.items[i]
+				if pred(item.key, item.value) {
+					deleted = append(deleted, KV[K, V]{item.key, item.value})
+					pivot = item.key
+					first = false
+					tr.Delete(item.key)
+					goto restart
+				}
+				n = tr.isoLoad(&(*n.children)[i+1], true)
+				stack = append(stack, stackItem{n, i + 1})
+				for !n.leaf() {
+					n = tr.isoLoad(&(*n.children)[0], true)
+					stack = append(stack, stackItem{n, 0})
+				}
+				i = 0
+			} else {
+				// at branch, continue to leaf
+				n = tr.isoLoad(&(*n.children)[i], true)
+				stack = append(stack, stackItem{n, i})
+				continue
+			}
+		}
+		// at leaf
+		for ; i < len(n.items); i++ {
+			item := n.items[i]
+			if !pred(item.key, item.value) {
+				continue
+			}
+			deleted = append(deleted, KV[K, V]{item.key, item.value})
+			if len(n.items) > tr.min {
+				copy(n.items[i:], n.items[i+1:])
+				n.items[len(n.items)-1] = tr.empty
+				n.items = n.items[:len(n.items)-1]
+				for j := 0; j < len(stack); j++ {
+					stack[j].node.count--
+				}
+				tr.count--
+				i--
+			} else {
+				// the leaf would underflow, delete and rebalance from the
+				// root and then continue after the deleted key.
+				pivot = item.key
+				first = false
+				tr.Delete(item.key)
+				goto restart
+			}
+		}
+		// end of leaf items. traverse upwards
+		for {
+			i = stack[len(stack)-1].index
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				// end of tree
+				return deleted
+			}
+			n = stack[len(stack)-1].node
+			if i < len(n.items) {
+				found = true
+				goto next
+			}
+		}
+	}
+}
+
 // Height returns the height of the tree.
 // Returns zero if tree has no items.
 func (tr *Map[K, V]) Height() int {
@@ -1153,6 +1276,15 @@ func (tr *Map[K, V]) Keys() []K {
 	return keys
 }
 
+// AppendKeys appends all the keys in order to dst and returns the extended
+// slice, which allows reusing the capacity of a previous export.
+func (tr *Map[K, V]) AppendKeys(dst []K) []K {
+	if tr.root != nil {
+		dst = tr.root.keys(dst)
+	}
+	return dst
+}
+
 func (n *mapNode[K, V]) keys(keys []K) []K {
 	if n.leaf() {
 		for i := 0; i < len(n.items); i++ {
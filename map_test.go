@@ -205,6 +205,10 @@ func TestMapKeyValues(t *testing.T) {
 	if !kindsAreEqual(values, values2) {
 		t.Fatalf("not equal")
 	}
+	keys2 = tr.AppendKeys(keys2[:0])
+	if !kindsAreEqual(keys, keys2) {
+		t.Fatalf("not equal")
+	}
 }
 
 func TestMapSimpleRandom(t *testing.T) {
@@ -1484,3 +1488,35 @@ func TestMapDeepCopy(t *testing.T) {
 	assert(count1 == Ncols*Nvals/2)
 	assert(count2 == Ncols*Nvals/2)
 }
+
+func TestMapDeleteAll(t *testing.T) {
+	for _, degree := range []int{2, 3, 32} {
+		tr := NewMap[int, int](degree)
+		N := 10_000
+		for _, i := range rand.Perm(N) {
+			tr.Set(i, i*10)
+		}
+		tr2 := tr.Copy()
+		pairs := tr.DeleteAll(func(key, value int) bool {
+			return key%3 == 0 || (key > 5000 && key < 6000)
+		})
+		tr.sane()
+		tr2.sane()
+		assert(tr2.Len() == N)
+		assert(len(pairs)+tr.Len() == N)
+		for i, kv := range pairs {
+			assert(kv.Value == kv.Key*10)
+			assert(i == 0 || pairs[i-1].Key < kv.Key)
+			_, ok := tr.Get(kv.Key)
+			assert(!ok)
+		}
+		tr.Scan(func(key, value int) bool {
+			assert(key%3 != 0 && !(key > 5000 && key < 6000))
+			return true
+		})
+		rest := tr.DeleteAll(func(key, value int) bool { return true })
+		assert(tr.Len() == 0 && len(rest) == N-len(pairs))
+		rest = tr.DeleteAll(func(key, value int) bool { return true })
+		assert(len(rest) == 0)
+	}
+}
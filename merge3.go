@@ -0,0 +1,104 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// diffChange is a difference that was reported by Diff.
+type diffChange[T any] struct {
+	op   DiffOp
+	item T
+}
+
+// changes returns the differences between base and tr, in key order.
+func changes[T any](base, tr *BTreeG[T], equal func(a, b T) bool,
+) []diffChange[T] {
+	var diffs []diffChange[T]
+	base.Diff(tr, equal, func(op DiffOp, item T) bool {
+		diffs = append(diffs, diffChange[T]{op, item})
+		return true
+	})
+	return diffs
+}
+
+// Merge3 returns a new tree that merges the changes that were made to the
+// trees a and b since they were copied from base. Items with equal keys are
+// the same when equal returns true for them.
+//
+// Changes made only to b are applied to a copy of a. When both a and b have
+// changed the same key in different ways, resolve is called with the items
+// of base, a and b, and returns the item to keep, or false to leave the key
+// out of the merged tree. Items that are missing on a side, because the key
+// was added or deleted, are passed as the zero value.
+//
+// The changes are found using Diff, which skips the subtrees that a and b
+// still share with base, so the cost depends on the number of changes rather
+// than the number of items.
+func Merge3[T any](base, a, b *BTreeG[T], equal func(x, y T) bool,
+	resolve func(base, a, b T) (T, bool),
+) *BTreeG[T] {
+	merged := a.Copy()
+	da, db := changes(base, a, equal), changes(base, b, equal)
+	var empty T
+	i := 0
+	for _, cb := range db {
+		for i < len(da) && merged.less(da[i].item, cb.item) {
+			i++
+		}
+		if i == len(da) || merged.less(cb.item, da[i].item) {
+			// only b changed the key
+			if cb.op == DiffRemoved {
+				merged.Delete(cb.item)
+			} else {
+				merged.Set(cb.item)
+			}
+			continue
+		}
+		ca := da[i]
+		if ca.op == DiffRemoved && cb.op == DiffRemoved ||
+			ca.op != DiffRemoved && cb.op != DiffRemoved &&
+				equal(ca.item, cb.item) {
+			// both made the same change
+			continue
+		}
+		baseItem, itemA, itemB := empty, empty, empty
+		if ca.op == DiffRemoved {
+			baseItem = ca.item
+		} else {
+			itemA = ca.item
+			if ca.op == DiffChanged {
+				baseItem, _ = base.Get(ca.item)
+			}
+		}
+		if cb.op == DiffRemoved {
+			baseItem = cb.item
+		} else {
+			itemB = cb.item
+		}
+		if item, keep := resolve(baseItem, itemA, itemB); keep {
+			merged.Set(item)
+		} else {
+			merged.Delete(cb.item)
+		}
+	}
+	return merged
+}
+
+// Conflicts returns the keys that were changed in both a and b since they
+// were copied from base, in order, even when both made the same change. Each
+// key is returned as the item of a, or as the item of base when a deleted
+// the key. Use it to abort optimistic transactions whose writes overlap.
+// Items with equal keys are the same when equal returns true for them.
+func Conflicts[T any](base, a, b *BTreeG[T], equal func(x, y T) bool) []T {
+	da, db := changes(base, a, equal), changes(base, b, equal)
+	var conflicts []T
+	i := 0
+	for _, cb := range db {
+		for i < len(da) && a.less(da[i].item, cb.item) {
+			i++
+		}
+		if i < len(da) && !a.less(cb.item, da[i].item) {
+			conflicts = append(conflicts, da[i].item)
+		}
+	}
+	return conflicts
+}
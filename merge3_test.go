@@ -0,0 +1,119 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	less := func(a, b testPair) bool { return a.key < b.key }
+	equal := func(a, b testPair) bool { return a == b }
+	base := NewBTreeGOptions(less, Options{Degree: 3})
+	for i := 0; i < 1000; i++ {
+		base.Set(testPair{i + 1, 0}) // key zero means a missing item
+	}
+	a, b := base.Copy(), base.Copy()
+	toMap := func(tr *BTreeG[testPair]) map[int]int {
+		m := make(map[int]int)
+		tr.Scan(func(item testPair) bool {
+			m[item.key] = item.val
+			return true
+		})
+		return m
+	}
+	edit := func(tr *BTreeG[testPair], val int) {
+		for i := 0; i < 100; i++ {
+			key := rand.Intn(1200) + 1
+			if rand.Intn(3) == 0 {
+				tr.Delete(testPair{key: key})
+			} else {
+				tr.Set(testPair{key, val})
+			}
+		}
+	}
+	edit(a, 1)
+	edit(b, 2)
+	// both sides make some identical changes
+	a.Set(testPair{5000, 9})
+	b.Set(testPair{5000, 9})
+	a.Delete(testPair{key: 999})
+	b.Delete(testPair{key: 999})
+	mbase, ma, mb := toMap(base), toMap(a), toMap(b)
+	var conflicts int
+	merged := Merge3(base, a, b, equal,
+		func(baseItem, itemA, itemB testPair) (testPair, bool) {
+			conflicts++
+			key := itemA.key
+			if key == 0 {
+				key = itemB.key
+			}
+			assert(baseItem.val == 0 && itemA.val != 2 && itemB.val != 1)
+			if v, ok := mbase[key]; ok {
+				assert(baseItem == testPair{key, v})
+			}
+			// the sum of the values wins, deletes lose
+			return testPair{key, itemA.val + itemB.val}, true
+		})
+	merged.sane()
+	want := make(map[int]int)
+	keys := make(map[int]bool)
+	for _, m := range []map[int]int{mbase, ma, mb} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	var expectConflicts int
+	for key := range keys {
+		vbase, inBase := mbase[key]
+		va, inA := ma[key]
+		vb, inB := mb[key]
+		changedA := inA != inBase || va != vbase
+		changedB := inB != inBase || vb != vbase
+		switch {
+		case changedA && changedB && (inA != inB || va != vb):
+			expectConflicts++
+			want[key] = va + vb
+		case changedB:
+			if inB {
+				want[key] = vb
+			}
+		case inA:
+			want[key] = va
+		}
+	}
+	got := toMap(merged)
+	assert(len(got) == len(want) && conflicts == expectConflicts)
+	for key, val := range want {
+		assert(got[key] == val)
+	}
+	assert(got[5000] == 9)
+	_, ok := got[999]
+	assert(!ok)
+	assert(len(toMap(a)) == len(ma) && len(toMap(b)) == len(mb))
+}
+
+func TestConflicts(t *testing.T) {
+	less := func(a, b testPair) bool { return a.key < b.key }
+	equal := func(a, b testPair) bool { return a == b }
+	base := NewBTreeG(less)
+	for i := 0; i < 1000; i++ {
+		base.Set(testPair{i, 0})
+	}
+	a, b := base.Copy(), base.Copy()
+	assert(len(Conflicts(base, a, b, equal)) == 0)
+	a.Set(testPair{10, 1})
+	b.Set(testPair{11, 1})
+	a.Delete(testPair{key: 20})
+	b.Set(testPair{20, 2})
+	a.Set(testPair{30, 1})
+	b.Delete(testPair{key: 30})
+	a.Set(testPair{2000, 1})
+	b.Set(testPair{2000, 1})
+	a.Set(testPair{40, 0}) // unchanged
+	b.Set(testPair{40, 2})
+	conflicts := Conflicts(base, a, b, equal)
+	assert(len(conflicts) == 3)
+	assert(conflicts[0] == testPair{20, 0})
+	assert(conflicts[1] == testPair{30, 1})
+	assert(conflicts[2] == testPair{2000, 1})
+}
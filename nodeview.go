@@ -0,0 +1,73 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+// NodeView is a read-only view of a node, for building custom serializers
+// and analyzers on top of the tree structure. It's only valid during the call
+// to VisitNodes.
+type NodeView[T any] struct {
+	n     *node[T]
+	rank  int
+	depth int
+}
+
+// VisitNodes calls visit with the root node while the tree is locked for
+// reading. Visit is not called if the tree is empty. Use the Child method to
+// walk down the tree.
+func (tr *BTreeG[T]) VisitNodes(visit func(root NodeView[T])) {
+	if tr == nil {
+		return
+	}
+	if tr.lock(false) {
+		defer tr.unlock(false)
+	}
+	if tr.root != nil {
+		visit(NodeView[T]{n: tr.root})
+	}
+}
+
+// Leaf returns true if the node has no children.
+func (n NodeView[T]) Leaf() bool {
+	return n.n.leaf()
+}
+
+// Items returns the items of the node, in order. The child at index i holds
+// the items that are less than Items()[i]. The slice must not be modified.
+func (n NodeView[T]) Items() []T {
+	return n.n.items
+}
+
+// NumChildren returns the number of children, which is zero for a leaf and
+// otherwise one more than the number of items.
+func (n NodeView[T]) NumChildren() int {
+	if n.n.leaf() {
+		return 0
+	}
+	return len(*n.n.children)
+}
+
+// Child returns the child at index.
+func (n NodeView[T]) Child(index int) NodeView[T] {
+	children := *n.n.children
+	rank := n.rank + index
+	for _, child := range children[:index] {
+		rank += child.count
+	}
+	return NodeView[T]{children[index], rank, n.depth + 1}
+}
+
+// Len returns the number of items in the subtree.
+func (n NodeView[T]) Len() int {
+	return n.n.count
+}
+
+// Rank returns the index within the tree of the first item in the subtree.
+func (n NodeView[T]) Rank() int {
+	return n.rank
+}
+
+// Depth returns the depth of the node, which is zero for the root.
+func (n NodeView[T]) Depth() int {
+	return n.depth
+}
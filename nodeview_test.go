@@ -0,0 +1,39 @@
+package btree
+
+import "testing"
+
+func TestVisitNodes(t *testing.T) {
+	tr := NewBTreeGOptions(testLess, Options{Degree: 3})
+	tr.VisitNodes(func(root NodeView[testKind]) {
+		t.Fatal("visited an empty tree")
+	})
+	for _, i := range randKeys(1000) {
+		tr.Set(i)
+	}
+	var items []testKind
+	var nodes int
+	var walk func(n NodeView[testKind])
+	walk = func(n NodeView[testKind]) {
+		nodes++
+		assert(n.Rank() == len(items))
+		start := len(items)
+		for i, item := range n.Items() {
+			if !n.Leaf() {
+				walk(n.Child(i))
+			}
+			assert(item == testKind(len(items)))
+			items = append(items, item)
+		}
+		if !n.Leaf() {
+			assert(n.NumChildren() == len(n.Items())+1)
+			walk(n.Child(len(n.Items())))
+		} else {
+			assert(n.NumChildren() == 0)
+			assert(n.Depth() == tr.Height()-1)
+		}
+		assert(n.Len() == len(items)-start)
+	}
+	tr.VisitNodes(walk)
+	assert(len(items) == 1000)
+	assert(nodes == tr.Stats().Nodes)
+}
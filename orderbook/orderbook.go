@@ -0,0 +1,245 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package orderbook is an example limit order book built on btree.BTreeG.
+//
+// Bids and asks are kept in two trees ordered by price and then by arrival,
+// so the best order on each side is the minimum item of its tree. Matching
+// consumes the best orders using PopMin, the quantity of each price level is
+// summed using the aggregates of the trees, and price bands are read using
+// bounded range scans.
+package orderbook
+
+import (
+	"math"
+
+	"github.com/tidwall/btree"
+)
+
+// Side of the book.
+type Side int
+
+const (
+	Bid Side = iota
+	Ask
+)
+
+// Order is a limit order.
+type Order struct {
+	ID    uint64
+	Side  Side
+	Price int64
+	Qty   int64
+	seq   uint64
+}
+
+// Fill is a trade between a resting maker order and an incoming taker order.
+type Fill struct {
+	MakerID uint64
+	TakerID uint64
+	Price   int64
+	Qty     int64
+}
+
+// Level is the aggregated quantity of the orders at a single price.
+type Level struct {
+	Price  int64
+	Qty    int64
+	Orders int
+}
+
+// Book is a limit order book.
+// It's not safe for concurrent use by multiple goroutines.
+type Book struct {
+	bids   *btree.BTreeG[*Order]
+	asks   *btree.BTreeG[*Order]
+	orders map[uint64]*Order
+	seq    uint64
+}
+
+// New returns a new empty Book.
+func New() *Book {
+	opts := btree.Options{NoLocks: true}
+	b := &Book{
+		bids: btree.NewBTreeGOptions(func(a, b *Order) bool {
+			if a.Price != b.Price {
+				return a.Price > b.Price
+			}
+			return a.seq < b.seq
+		}, opts),
+		asks: btree.NewBTreeGOptions(func(a, b *Order) bool {
+			if a.Price != b.Price {
+				return a.Price < b.Price
+			}
+			return a.seq < b.seq
+		}, opts),
+		orders: make(map[uint64]*Order),
+	}
+	// the aggregate of a subtree is an order holding its total quantity
+	agg := &btree.Aggregator[*Order]{
+		Sum: func(a, b *Order) *Order {
+			return &Order{Qty: a.Qty + b.Qty}
+		},
+		Identity: &Order{},
+	}
+	b.bids.SetAggregator(agg)
+	b.asks.SetAggregator(agg)
+	return b
+}
+
+func (b *Book) side(side Side) *btree.BTreeG[*Order] {
+	if side == Bid {
+		return b.bids
+	}
+	return b.asks
+}
+
+// crosses returns true if a taker at price can trade with a maker order.
+func crosses(side Side, price int64, maker *Order) bool {
+	if side == Bid {
+		return maker.Price <= price
+	}
+	return maker.Price >= price
+}
+
+// Place matches the order against the opposite side of the book and rests
+// any remaining quantity. Returns the fills, in the order they occurred.
+// Returns false if an order with the same ID is already resting, if the side
+// is not Bid or Ask, or if the quantity is not positive.
+func (b *Book) Place(order Order) ([]Fill, bool) {
+	if _, ok := b.orders[order.ID]; ok || order.Qty <= 0 {
+		return nil, false
+	}
+	if order.Side != Bid && order.Side != Ask {
+		return nil, false
+	}
+	var fills []Fill
+	other := b.asks
+	if order.Side == Ask {
+		other = b.bids
+	}
+	for order.Qty > 0 {
+		maker, ok := other.Min()
+		if !ok || !crosses(order.Side, order.Price, maker) {
+			break
+		}
+		qty := order.Qty
+		if maker.Qty < qty {
+			qty = maker.Qty
+		}
+		fills = append(fills, Fill{
+			MakerID: maker.ID,
+			TakerID: order.ID,
+			Price:   maker.Price,
+			Qty:     qty,
+		})
+		order.Qty -= qty
+		maker.Qty -= qty
+		if maker.Qty == 0 {
+			other.PopMin()
+			delete(b.orders, maker.ID)
+		} else {
+			// setting the order again drops the stale aggregates on its path
+			other.Set(maker)
+		}
+	}
+	if order.Qty > 0 {
+		b.seq++
+		order.seq = b.seq
+		o := &order
+		b.side(order.Side).Set(o)
+		b.orders[order.ID] = o
+	}
+	return fills, true
+}
+
+// Cancel removes a resting order from the book.
+// Returns false if there is no resting order with the ID.
+func (b *Book) Cancel(id uint64) (Order, bool) {
+	o, ok := b.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	b.side(o.Side).Delete(o)
+	delete(b.orders, id)
+	return *o, true
+}
+
+// Get returns the resting order with the ID.
+func (b *Book) Get(id uint64) (Order, bool) {
+	o, ok := b.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	return *o, true
+}
+
+// Len returns the number of resting orders.
+func (b *Book) Len() int {
+	return len(b.orders)
+}
+
+// BestBid returns the highest bid, earliest first when prices are equal.
+func (b *Book) BestBid() (Order, bool) {
+	return best(b.bids)
+}
+
+// BestAsk returns the lowest ask, earliest first when prices are equal.
+func (b *Book) BestAsk() (Order, bool) {
+	return best(b.asks)
+}
+
+func best(tr *btree.BTreeG[*Order]) (Order, bool) {
+	o, ok := tr.Min()
+	if !ok {
+		return Order{}, false
+	}
+	return *o, true
+}
+
+// Depth returns up to levels aggregated price levels for a side of the
+// book, starting at the best price. Each level is summed in O(log n) using
+// the aggregates of the tree, however many orders rest at its price.
+func (b *Book) Depth(side Side, levels int) []Level {
+	var depth []Level
+	if levels <= 0 {
+		return depth
+	}
+	tr := b.side(side)
+	first, ok := tr.Min()
+	for ok && len(depth) < levels {
+		// the zero seq sorts before all orders at a price and the max seq
+		// after them
+		lo := &Order{Price: first.Price}
+		hi := &Order{Price: first.Price, seq: math.MaxUint64}
+		depth = append(depth, Level{
+			Price:  first.Price,
+			Qty:    tr.AggregateRange(lo, hi).Qty,
+			Orders: tr.CountRange(lo, hi),
+		})
+		ok = false
+		tr.Ascend(hi, func(o *Order) bool {
+			first, ok = o, true
+			return false
+		})
+	}
+	return depth
+}
+
+// Range returns the resting orders for a side of the book with prices
+// between from and to, inclusive, in priority order. For bids from is the
+// higher price and for asks it's the lower price.
+func (b *Book) Range(side Side, from, to int64) []Order {
+	var orders []Order
+	tr := b.side(side)
+	// the zero seq sorts before all resting orders at the same price
+	tr.Ascend(&Order{Price: from}, func(o *Order) bool {
+		if (side == Bid && o.Price < to) || (side == Ask && o.Price > to) {
+			return false
+		}
+		orders = append(orders, *o)
+		return true
+	})
+	return orders
+}
@@ -0,0 +1,109 @@
+package orderbook
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBook(t *testing.T) {
+	b := New()
+	b.Place(Order{ID: 1, Side: Bid, Price: 100, Qty: 10})
+	b.Place(Order{ID: 2, Side: Bid, Price: 101, Qty: 5})
+	b.Place(Order{ID: 3, Side: Bid, Price: 101, Qty: 7})
+	b.Place(Order{ID: 4, Side: Ask, Price: 105, Qty: 3})
+	b.Place(Order{ID: 5, Side: Ask, Price: 103, Qty: 4})
+	if _, ok := b.Place(Order{ID: 5, Side: Ask, Price: 103, Qty: 4}); ok {
+		t.Fatal("expected duplicate id to fail")
+	}
+	if _, ok := b.Place(Order{ID: 9, Side: 2, Price: 103, Qty: 4}); ok {
+		t.Fatal("expected invalid side to fail")
+	}
+	if o, _ := b.BestBid(); o.ID != 2 {
+		t.Fatalf("expected 2, got %d", o.ID)
+	}
+	if o, _ := b.BestAsk(); o.ID != 5 {
+		t.Fatalf("expected 5, got %d", o.ID)
+	}
+	depth := b.Depth(Bid, 10)
+	if len(depth) != 2 || depth[0] != (Level{101, 12, 2}) ||
+		depth[1] != (Level{100, 10, 1}) {
+		t.Fatalf("bad depth: %v", depth)
+	}
+	if orders := b.Range(Bid, 101, 100); len(orders) != 3 ||
+		orders[0].ID != 2 || orders[2].ID != 1 {
+		t.Fatalf("bad range: %v", orders)
+	}
+	if orders := b.Range(Ask, 104, 110); len(orders) != 1 ||
+		orders[0].ID != 4 {
+		t.Fatalf("bad range: %v", orders)
+	}
+
+	// a crossing ask fills the best bids in time priority
+	fills, _ := b.Place(Order{ID: 6, Side: Ask, Price: 100, Qty: 8})
+	if len(fills) != 2 || fills[0] != (Fill{2, 6, 101, 5}) ||
+		fills[1] != (Fill{3, 6, 101, 3}) {
+		t.Fatalf("bad fills: %v", fills)
+	}
+	if o, _ := b.Get(3); o.Qty != 4 {
+		t.Fatalf("expected 4, got %d", o.Qty)
+	}
+	if _, ok := b.Get(2); ok {
+		t.Fatal("expected filled order to be removed")
+	}
+	// a crossing bid sweeps asks and rests the remainder
+	fills, _ = b.Place(Order{ID: 7, Side: Bid, Price: 106, Qty: 10})
+	if len(fills) != 2 || fills[0].MakerID != 5 || fills[1].MakerID != 4 {
+		t.Fatalf("bad fills: %v", fills)
+	}
+	if o, _ := b.BestBid(); o.ID != 7 || o.Qty != 3 {
+		t.Fatalf("bad best bid: %v", o)
+	}
+	if _, ok := b.BestAsk(); ok {
+		t.Fatal("expected no asks")
+	}
+	if o, ok := b.Cancel(7); !ok || o.Qty != 3 {
+		t.Fatalf("bad cancel: %v", o)
+	}
+	if _, ok := b.Cancel(7); ok {
+		t.Fatal("expected cancel to fail")
+	}
+	if b.Len() != 2 {
+		t.Fatalf("expected 2, got %d", b.Len())
+	}
+}
+
+func TestBookRandom(t *testing.T) {
+	b := New()
+	var placed, filled int64
+	for i := 1; i <= 10_000; i++ {
+		side := Side(rand.Intn(2))
+		qty := int64(1 + rand.Intn(10))
+		fills, ok := b.Place(Order{
+			ID:    uint64(i),
+			Side:  side,
+			Price: int64(90 + rand.Intn(20)),
+			Qty:   qty,
+		})
+		if !ok {
+			t.Fatal("place failed")
+		}
+		placed += qty
+		for _, f := range fills {
+			filled += f.Qty * 2
+		}
+		bid, ok1 := b.BestBid()
+		ask, ok2 := b.BestAsk()
+		if ok1 && ok2 && bid.Price >= ask.Price {
+			t.Fatalf("crossed book: %v %v", bid, ask)
+		}
+	}
+	var resting int64
+	for _, side := range []Side{Bid, Ask} {
+		for _, l := range b.Depth(side, 100) {
+			resting += l.Qty
+		}
+	}
+	if placed != resting+filled {
+		t.Fatalf("expected %d, got %d", placed, resting+filled)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry is a set of named trees that tooling such as debug handlers,
+// metrics exporters, and checkpointers can discover without explicit wiring.
+// It's safe for concurrent use by multiple goroutines.
+type Registry struct {
+	mu    sync.RWMutex
+	trees map[string]any
+}
+
+// DefaultRegistry is the registry used by Register and Lookup.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{trees: make(map[string]any)}
+}
+
+// Register a tree using the provided name, replacing any tree previously
+// registered with the same name.
+func (r *Registry) Register(name string, tr any) {
+	if tr == nil {
+		panic("nil tree")
+	}
+	r.mu.Lock()
+	r.trees[name] = tr
+	r.mu.Unlock()
+}
+
+// Unregister removes the tree with the provided name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.trees, name)
+	r.mu.Unlock()
+}
+
+// Lookup returns the tree registered with the provided name.
+func (r *Registry) Lookup(name string) (any, bool) {
+	r.mu.RLock()
+	tr, ok := r.trees[name]
+	r.mu.RUnlock()
+	return tr, ok
+}
+
+// Names returns the names of all registered trees in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.trees))
+	for name := range r.trees {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Register a tree with the DefaultRegistry.
+func Register(name string, tr any) {
+	DefaultRegistry.Register(name, tr)
+}
+
+// Unregister removes a tree from the DefaultRegistry.
+func Unregister(name string) {
+	DefaultRegistry.Unregister(name)
+}
+
+// Lookup returns a tree from the DefaultRegistry.
+func Lookup(name string) (any, bool) {
+	return DefaultRegistry.Lookup(name)
+}
+
+// LookupAs returns the tree registered in r with the provided name.
+// Returns false if there is no such tree or if the tree is not a T.
+//
+//	tr, ok := btree.LookupAs[*btree.BTreeG[int]](btree.DefaultRegistry, "ids")
+func LookupAs[T any](r *Registry, name string) (T, bool) {
+	tr, _ := r.Lookup(name)
+	t, ok := tr.(T)
+	return t, ok
+}
@@ -0,0 +1,29 @@
+package btree
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	tr := NewBTreeG(func(a, b int) bool { return a < b })
+	var m Map[string, int]
+	reg.Register("ints", tr)
+	reg.Register("map", &m)
+	names := reg.Names()
+	assert(len(names) == 2 && names[0] == "ints" && names[1] == "map")
+	v, ok := reg.Lookup("ints")
+	assert(ok && v == any(tr))
+	tr2, ok := LookupAs[*BTreeG[int]](reg, "ints")
+	assert(ok && tr2 == tr)
+	_, ok = LookupAs[*BTreeG[string]](reg, "ints")
+	assert(!ok)
+	m2, ok := LookupAs[*Map[string, int]](reg, "map")
+	assert(ok && m2 == &m)
+	reg.Unregister("ints")
+	_, ok = reg.Lookup("ints")
+	assert(!ok)
+
+	Register("test:ints", tr)
+	defer Unregister("test:ints")
+	v, ok = Lookup("test:ints")
+	assert(ok && v == any(tr))
+}
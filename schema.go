@@ -0,0 +1,160 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Field is a named field of a struct value, with a function that appends the
+// text form of the field to a buffer.
+type Field[V any] struct {
+	Name   string
+	Append func(dst []byte, v *V) []byte
+}
+
+// StringField returns a Field for a string accessor.
+func StringField[V any](name string, get func(v *V) string) Field[V] {
+	return Field[V]{name, func(dst []byte, v *V) []byte {
+		return append(dst, get(v)...)
+	}}
+}
+
+// BytesField returns a Field for a byte slice accessor.
+func BytesField[V any](name string, get func(v *V) []byte) Field[V] {
+	return Field[V]{name, func(dst []byte, v *V) []byte {
+		return append(dst, get(v)...)
+	}}
+}
+
+// IntField returns a Field for an integer accessor.
+func IntField[V any](name string, get func(v *V) int64) Field[V] {
+	return Field[V]{name, func(dst []byte, v *V) []byte {
+		return strconv.AppendInt(dst, get(v), 10)
+	}}
+}
+
+// UintField returns a Field for an unsigned integer accessor.
+func UintField[V any](name string, get func(v *V) uint64) Field[V] {
+	return Field[V]{name, func(dst []byte, v *V) []byte {
+		return strconv.AppendUint(dst, get(v), 10)
+	}}
+}
+
+// FloatField returns a Field for a floating-point accessor.
+func FloatField[V any](name string, get func(v *V) float64) Field[V] {
+	return Field[V]{name, func(dst []byte, v *V) []byte {
+		return strconv.AppendFloat(dst, get(v), 'g', -1, 64)
+	}}
+}
+
+// BoolField returns a Field for a boolean accessor.
+func BoolField[V any](name string, get func(v *V) bool) Field[V] {
+	return Field[V]{name, func(dst []byte, v *V) []byte {
+		return strconv.AppendBool(dst, get(v))
+	}}
+}
+
+// Schema declares the fields of a struct value type, so that scans can
+// project values onto a subset of their fields.
+type Schema[V any] struct {
+	fields []Field[V]
+}
+
+// NewSchema returns a new Schema with the provided fields.
+// Panics if two fields have the same name.
+func NewSchema[V any](fields ...Field[V]) *Schema[V] {
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if seen[f.Name] {
+			panic("duplicate field " + f.Name)
+		}
+		seen[f.Name] = true
+	}
+	return &Schema[V]{fields: append([]Field[V](nil), fields...)}
+}
+
+// Fields returns the names of the fields, in declaration order.
+func (s *Schema[V]) Fields() []string {
+	names := make([]string, len(s.fields))
+	for i, f := range s.fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Projection is a selection of fields from a Schema. A projection holds the
+// buffers that are reused by each row, so it must not be used by more than
+// one scan at a time.
+type Projection[V any] struct {
+	fields []Field[V]
+	value  V
+	buf    []byte
+	ends   []int
+	row    [][]byte
+}
+
+// Project returns a projection of the named fields, in the provided order.
+// Returns an error if a field is not in the schema.
+func (s *Schema[V]) Project(names ...string) (*Projection[V], error) {
+	p := &Projection[V]{
+		ends: make([]int, len(names)),
+		row:  make([][]byte, len(names)),
+	}
+	for _, name := range names {
+		var found bool
+		for _, f := range s.fields {
+			if f.Name == name {
+				p.fields = append(p.fields, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	return p, nil
+}
+
+// project returns the projected fields of the value. The returned slices
+// are only valid until the next call.
+func (p *Projection[V]) project(value V) [][]byte {
+	// The value is held by the projection so that passing its address to
+	// the accessors does not move every value to the heap.
+	p.value = value
+	p.buf = p.buf[:0]
+	for i, f := range p.fields {
+		p.buf = f.Append(p.buf, &p.value)
+		p.ends[i] = len(p.buf)
+	}
+	var start int
+	for i, end := range p.ends {
+		p.row[i] = p.buf[start:end:end]
+		start = end
+	}
+	return p.row
+}
+
+// ScanProject scans all values in key order, calling iter with the text of
+// the projected fields of each value. The row and its field slices are
+// reused between calls, so they are only valid until iter returns.
+// Return false to stop iterating.
+func (tr *Map[K, V]) ScanProject(p *Projection[V],
+	iter func(key K, row [][]byte) bool,
+) {
+	tr.Scan(func(key K, value V) bool {
+		return iter(key, p.project(value))
+	})
+}
+
+// AscendProject is like ScanProject, but for the range [pivot, last].
+func (tr *Map[K, V]) AscendProject(pivot K, p *Projection[V],
+	iter func(key K, row [][]byte) bool,
+) {
+	tr.Ascend(pivot, func(key K, value V) bool {
+		return iter(key, p.project(value))
+	})
+}
@@ -0,0 +1,51 @@
+package btree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testAccount struct {
+	Name    string
+	Balance int64
+	Rate    float64
+	Active  bool
+	Notes   [256]byte
+}
+
+func TestSchemaProjection(t *testing.T) {
+	schema := NewSchema(
+		StringField("name", func(v *testAccount) string { return v.Name }),
+		IntField("balance", func(v *testAccount) int64 { return v.Balance }),
+		FloatField("rate", func(v *testAccount) float64 { return v.Rate }),
+		BoolField("active", func(v *testAccount) bool { return v.Active }),
+	)
+	assert(strings.Join(schema.Fields(), ",") == "name,balance,rate,active")
+	_, err := schema.Project("name", "missing")
+	assert(err != nil)
+
+	var m Map[int, testAccount]
+	for i := 0; i < 100; i++ {
+		m.Set(i, testAccount{Name: fmt.Sprint("acct", i), Balance: int64(i * 10),
+			Rate: 0.5, Active: i%2 == 0})
+	}
+	p, err := schema.Project("active", "name", "balance")
+	assert(err == nil)
+	var lines []string
+	m.AscendProject(95, p, func(key int, row [][]byte) bool {
+		var fields []string
+		for _, f := range row {
+			fields = append(fields, string(f))
+		}
+		lines = append(lines, strings.Join(fields, ","))
+		return true
+	})
+	assert(len(lines) == 5 && lines[0] == "false,acct95,950" &&
+		lines[1] == "true,acct96,960")
+
+	allocs := testing.AllocsPerRun(10, func() {
+		m.ScanProject(p, func(key int, row [][]byte) bool { return true })
+	})
+	assert(allocs < 5)
+}
@@ -94,6 +94,15 @@ func (tr *Set[K]) PopMin() (K, bool) {
 	return key, ok
 }
 
+// Drain removes keys in ascending order, passing each removed key to iter.
+// Return false to stop draining. The key passed to that call has already
+// been removed, so every key is consumed exactly once.
+func (tr *Set[K]) Drain(iter func(key K) bool) {
+	tr.base.Drain(func(key K, _ struct{}) bool {
+		return iter(key)
+	})
+}
+
 // PopMax removes the maximum item in tree and returns it.
 // Returns nil if the tree has no items.
 func (tr *Set[K]) PopMax() (K, bool) {
@@ -177,3 +186,51 @@ func (tr *Set[K]) Keys() []K {
 func (tr *Set[K]) Clear() {
 	tr.base.Clear()
 }
+
+// Union returns a new set with the keys that are in either set.
+func (tr *Set[K]) Union(other *Set[K]) *Set[K] {
+	return tr.combine(other, true, true, true)
+}
+
+// Intersect returns a new set with the keys that are in both sets.
+func (tr *Set[K]) Intersect(other *Set[K]) *Set[K] {
+	return tr.combine(other, false, true, false)
+}
+
+// Difference returns a new set with the keys that are in the set but not in
+// other.
+func (tr *Set[K]) Difference(other *Set[K]) *Set[K] {
+	return tr.combine(other, true, false, false)
+}
+
+// combine walks both sets together in a single ordered pass, keeping the
+// keys that are only in tr, in both sets, or only in other. The kept keys
+// arrive in order and are appended to the new set using Load.
+func (tr *Set[K]) combine(other *Set[K], onlyA, both, onlyB bool) *Set[K] {
+	s := new(Set[K])
+	a, b := tr.Iter(), other.Iter()
+	okA, okB := a.First(), b.First()
+	for okA || okB {
+		if !okA && !onlyB || !okB && !onlyA {
+			break
+		}
+		switch {
+		case !okB || okA && a.Key() < b.Key():
+			if onlyA {
+				s.Load(a.Key())
+			}
+			okA = a.Next()
+		case !okA || b.Key() < a.Key():
+			if onlyB {
+				s.Load(b.Key())
+			}
+			okB = b.Next()
+		default:
+			if both {
+				s.Load(a.Key())
+			}
+			okA, okB = a.Next(), b.Next()
+		}
+	}
+	return s
+}
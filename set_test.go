@@ -321,3 +321,67 @@ func TestSetCopy(t *testing.T) {
 		panic("!")
 	}
 }
+
+func TestSetDrain(t *testing.T) {
+	var tr Set[int]
+	N := 10_000
+	for _, i := range rand.Perm(N) {
+		tr.Insert(i)
+	}
+	var keys []int
+	tr.Drain(func(key int) bool {
+		keys = append(keys, key)
+		return key < N/2
+	})
+	assert(len(keys) == N/2+1 && tr.Len() == N/2-1)
+	for i, key := range keys {
+		assert(key == i)
+	}
+	tr.Drain(func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert(len(keys) == N && tr.Len() == 0)
+	tr.Drain(func(key int) bool { panic("!") })
+}
+
+func TestSetAlgebra(t *testing.T) {
+	var a, b Set[int]
+	inA := make(map[int]bool)
+	inB := make(map[int]bool)
+	for i := 0; i < 5000; i++ {
+		if k := rand.Intn(10000); !inA[k] {
+			a.Insert(k)
+			inA[k] = true
+		}
+		if k := rand.Intn(10000); !inB[k] {
+			b.Insert(k)
+			inB[k] = true
+		}
+	}
+	check := func(s *Set[int], want func(k int) bool) {
+		var n int
+		s.Scan(func(k int) bool {
+			assert(want(k))
+			n++
+			return true
+		})
+		for k := 0; k < 10000; k++ {
+			if want(k) {
+				n--
+			}
+		}
+		assert(n == 0)
+	}
+	check(a.Union(&b), func(k int) bool { return inA[k] || inB[k] })
+	check(a.Intersect(&b), func(k int) bool { return inA[k] && inB[k] })
+	check(a.Difference(&b), func(k int) bool { return inA[k] && !inB[k] })
+	check(b.Difference(&a), func(k int) bool { return inB[k] && !inA[k] })
+	var empty Set[int]
+	assert(a.Union(&empty).Len() == a.Len())
+	assert(empty.Union(&a).Len() == a.Len())
+	assert(a.Intersect(&empty).Len() == 0)
+	assert(a.Difference(&empty).Len() == a.Len())
+	assert(empty.Difference(&a).Len() == 0)
+	assert(a.Len() == len(inA) && b.Len() == len(inB))
+}
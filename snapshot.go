@@ -0,0 +1,385 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Snapshot format
+//
+//	magic    [4]byte "BTRS"
+//	version  byte
+//	count    uvarint
+//	items    count * (uvarint length, [length]byte)
+//	checksum uint32 little-endian, crc32c of all preceding bytes
+//
+// Version 2 snapshots wrap each item in an envelope with a type tag.
+//
+//	items    count * (uvarint tag, uvarint length, [length]byte)
+
+const (
+	snapshotMagic           = "BTRS"
+	snapshotVersion         = 1
+	snapshotVersionEnvelope = 2
+	// maxSnapshotItemSize guards against allocating huge buffers when
+	// reading a corrupt snapshot.
+	maxSnapshotItemSize = 1 << 30
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Options for passing to the BackupTo function.
+type BackupOptions[T any] struct {
+	// Progress, if provided, is called after each item is written with the
+	// number of items written so far and the total number of items in the
+	// backup.
+	Progress func(written, total int)
+	// Tag, if provided, enables item envelopes. Each item is written along
+	// with the type tag returned by Tag, allowing a restore to skip items
+	// that it does not understand.
+	Tag func(item T) uint64
+}
+
+// BackupTo writes a snapshot of the tree to w.
+// The encode function must append the encoded item to dst and return the
+// extended buffer.
+//
+// The tree is only locked while its root is captured using a copy-on-write
+// Copy. Writers may continue modifying the tree while the snapshot streams.
+func (tr *BTreeG[T]) BackupTo(w io.Writer, encode func(dst []byte, item T) []byte,
+	opts *BackupOptions[T],
+) error {
+	snap := tr.Copy()
+	total := snap.count
+	crc := crc32.New(crc32c)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf []byte
+	buf = append(buf, snapshotMagic...)
+	var tag func(item T) uint64
+	if opts != nil {
+		tag = opts.Tag
+	}
+	if tag != nil {
+		buf = append(buf, snapshotVersionEnvelope)
+	} else {
+		buf = append(buf, snapshotVersion)
+	}
+	buf = binary.AppendUvarint(buf, uint64(total))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	var err error
+	var written int
+	var item []byte
+	if snap.root != nil {
+		snap.nodeScan(&snap.root, func(v T) bool {
+			item = encode(item[:0], v)
+			buf = buf[:0]
+			if tag != nil {
+				buf = binary.AppendUvarint(buf, tag(v))
+			}
+			buf = binary.AppendUvarint(buf, uint64(len(item)))
+			if _, err = bw.Write(buf); err != nil {
+				return false
+			}
+			if _, err = bw.Write(item); err != nil {
+				return false
+			}
+			written++
+			if opts != nil && opts.Progress != nil {
+				opts.Progress(written, total)
+			}
+			return true
+		}, false)
+	}
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	buf = binary.LittleEndian.AppendUint32(buf[:0], crc.Sum32())
+	_, err = w.Write(buf)
+	return err
+}
+
+// hashReader reads from a buffered reader while hashing the consumed bytes.
+type hashReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (r *hashReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(r.r, p)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+// snapshotReader reads a snapshot one item at a time.
+type snapshotReader struct {
+	hr       hashReader
+	version  byte
+	envelope bool
+	count    int
+	read     int
+	buf      []byte
+	sum      uint32
+}
+
+func newSnapshotReader(r io.Reader) (*snapshotReader, error) {
+	sr := &snapshotReader{
+		hr: hashReader{r: bufio.NewReader(r), h: crc32.New(crc32c)},
+	}
+	var head [5]byte
+	if _, err := sr.hr.Read(head[:]); err != nil {
+		return nil, snapshotError(err)
+	}
+	if string(head[:4]) != snapshotMagic {
+		return nil, ErrCorruptSnapshot
+	}
+	sr.version = head[4]
+	switch head[4] {
+	case snapshotVersion:
+	case snapshotVersionEnvelope:
+		sr.envelope = true
+	default:
+		return nil, fmt.Errorf("%w: snapshot version %d", ErrVersionNotFound,
+			head[4])
+	}
+	count, err := binary.ReadUvarint(&sr.hr)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	sr.count = int(count)
+	return sr, nil
+}
+
+// next returns the type tag and the next encoded item, or false when all
+// items have been read. The tag is always zero for snapshots without item
+// envelopes. The returned data is only valid until the next call.
+func (sr *snapshotReader) next() (uint64, []byte, bool, error) {
+	if sr.read == sr.count {
+		return 0, nil, false, nil
+	}
+	var tag uint64
+	var err error
+	if sr.envelope {
+		if tag, err = binary.ReadUvarint(&sr.hr); err != nil {
+			return 0, nil, false, snapshotError(err)
+		}
+	}
+	n, err := binary.ReadUvarint(&sr.hr)
+	if err != nil {
+		return 0, nil, false, snapshotError(err)
+	}
+	if n > maxSnapshotItemSize {
+		return 0, nil, false, ErrCorruptSnapshot
+	}
+	if uint64(cap(sr.buf)) < n {
+		sr.buf = make([]byte, n)
+	}
+	sr.buf = sr.buf[:n]
+	if _, err := sr.hr.Read(sr.buf); err != nil {
+		return 0, nil, false, snapshotError(err)
+	}
+	sr.read++
+	return tag, sr.buf, true, nil
+}
+
+// verify checks the trailing checksum. Must be called after all items have
+// been read.
+func (sr *snapshotReader) verify() error {
+	sum := sr.hr.h.Sum32()
+	var tail [4]byte
+	if _, err := io.ReadFull(sr.hr.r, tail[:]); err != nil {
+		return snapshotError(err)
+	}
+	if binary.LittleEndian.Uint32(tail[:]) != sum {
+		return ErrCorruptSnapshot
+	}
+	sr.sum = sum
+	return nil
+}
+
+func snapshotError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorruptSnapshot
+	}
+	return err
+}
+
+// Options for passing to the Restore function.
+type RestoreOptions[T any] struct {
+	// Transform, if provided, is called for every decoded item. It returns
+	// the item to store, which may be a migrated version of the original,
+	// or false to leave the item out of the restored tree.
+	Transform func(item T) (T, bool)
+	// SkipInvalid skips items that fail to decode instead of aborting the
+	// restore.
+	SkipInvalid bool
+	// Tags, if provided, is called with the type tag of each item before it
+	// is decoded. Return false to skip the item. Snapshots without item
+	// envelopes always use the zero tag.
+	Tags func(tag uint64) bool
+}
+
+// Restore replaces the contents of the tree with a snapshot that was written
+// by BackupTo.
+// The decode function must return the item for the encoded data, and must
+// not retain the data.
+//
+// The snapshot is fully read and verified before the tree is modified. On
+// error the tree is left unchanged.
+//
+// Returns ErrCorruptSnapshot if the snapshot is malformed, ErrVersionNotFound
+// if it was written with an unknown format version, ErrFull if it holds more
+// than Options.MaxItems items, and ErrReadOnly if the tree is read-only.
+func (tr *BTreeG[T]) Restore(r io.Reader, decode func(data []byte) (T, error),
+	opts *RestoreOptions[T],
+) error {
+	if tr.readOnly {
+		return ErrReadOnly
+	}
+	sr, err := newSnapshotReader(r)
+	if err != nil {
+		return err
+	}
+	tr.init(0)
+	tr2 := &BTreeG[T]{isoid: newIsoID(), less: tr.less, min: tr.min, max: tr.max}
+	for {
+		tag, data, ok, err := sr.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if opts != nil && opts.Tags != nil && !opts.Tags(tag) {
+			continue
+		}
+		item, err := decode(data)
+		if err != nil {
+			if opts != nil && opts.SkipInvalid {
+				continue
+			}
+			return err
+		}
+		if opts != nil && opts.Transform != nil {
+			if item, ok = opts.Transform(item); !ok {
+				continue
+			}
+		}
+		tr2.Load(item)
+	}
+	if err := sr.verify(); err != nil {
+		return err
+	}
+	if tr.maxItems > 0 && tr2.count > tr.maxItems {
+		return ErrFull
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	tr.root = tr2.root
+	tr.count = tr2.count
+	tr.isoid = tr2.isoid
+	tr.freeNodes(tr.allocs.Live)
+	tr.allocs.Allocs += tr2.allocs.Allocs
+	tr.allocs.Frees += tr2.allocs.Frees
+	tr.allocs.Live = tr2.allocs.Live
+	if tr.tombs != nil {
+		tr.tombs.Clear()
+	}
+	if tr.sums != nil {
+		tr.sums.Clear()
+	}
+	return nil
+}
+
+// SnapshotInfo describes a snapshot that was verified by VerifySnapshot.
+type SnapshotInfo struct {
+	// Version of the snapshot format.
+	Version int
+	// Envelope is true if items were written with type tags.
+	Envelope bool
+	// Count is the number of items.
+	Count int
+	// Checksum is the crc32c checksum of the snapshot.
+	Checksum uint32
+}
+
+// VerifySnapshot reads a snapshot that was written by BackupTo and checks its
+// structure, item count and checksum, without decoding the items or building
+// a tree. Use VerifySnapshotOrder to also check the order of the items.
+//
+// Returns ErrCorruptSnapshot if the snapshot is malformed, and
+// ErrVersionNotFound if it was written with an unknown format version.
+func VerifySnapshot(r io.Reader) (SnapshotInfo, error) {
+	return verifySnapshot(r, func(data []byte) error { return nil })
+}
+
+// VerifySnapshotOrder is like VerifySnapshot, but also decodes every item and
+// checks that the items are in strictly ascending order according to less.
+// Items that are out of order are reported as ErrCorruptSnapshot.
+func VerifySnapshotOrder[T any](r io.Reader,
+	decode func(data []byte) (T, error), less func(a, b T) bool,
+) (SnapshotInfo, error) {
+	var prev T
+	var i int
+	return verifySnapshot(r, func(data []byte) error {
+		item, err := decode(data)
+		if err != nil {
+			return err
+		}
+		if i > 0 && !less(prev, item) {
+			return fmt.Errorf("%w: item %d out of order", ErrCorruptSnapshot, i)
+		}
+		prev = item
+		i++
+		return nil
+	})
+}
+
+func verifySnapshot(r io.Reader, check func(data []byte) error,
+) (SnapshotInfo, error) {
+	sr, err := newSnapshotReader(r)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	for {
+		_, data, ok, err := sr.next()
+		if err != nil {
+			return SnapshotInfo{}, err
+		}
+		if !ok {
+			break
+		}
+		if err := check(data); err != nil {
+			return SnapshotInfo{}, err
+		}
+	}
+	if err := sr.verify(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	return SnapshotInfo{
+		Version:  int(sr.version),
+		Envelope: sr.envelope,
+		Count:    sr.count,
+		Checksum: sr.sum,
+	}, nil
+}
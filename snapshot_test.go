@@ -0,0 +1,177 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func encodeInt(dst []byte, item int) []byte {
+	return binary.AppendVarint(dst, int64(item))
+}
+
+func decodeInt(data []byte) (int, error) {
+	x, n := binary.Varint(data)
+	if n <= 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return int(x), nil
+}
+
+func TestSnapshot(t *testing.T) {
+	N := 100_000
+	tr := NewBTreeG(testLess)
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	var buf bytes.Buffer
+	var written, total int
+	err := tr.BackupTo(&buf, encodeInt, &BackupOptions[int]{
+		Progress: func(w, t int) {
+			written, total = w, t
+			// writers are not blocked while the backup streams
+			tr.Set(N + w)
+		},
+	})
+	assert(err == nil)
+	assert(written == N && total == N)
+	assert(tr.Len() == N*2)
+
+	tr2 := NewBTreeG(testLess)
+	tr2.Set(-1)
+	assert(tr2.Restore(bytes.NewReader(buf.Bytes()), decodeInt, nil) == nil)
+	tr2.sane()
+	assert(tr2.Len() == N)
+	for i := 0; i < N; i++ {
+		v, ok := tr2.Get(i)
+		assert(ok && v == i)
+	}
+	tr2.Set(N)
+	tr2.sane()
+
+	// corrupt data leaves the tree unchanged
+	data := buf.Bytes()
+	for _, bad := range [][]byte{
+		nil,
+		data[:len(data)/2],
+		data[:len(data)-1],
+		append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^1),
+	} {
+		err := tr2.Restore(bytes.NewReader(bad), decodeInt, nil)
+		assert(errors.Is(err, ErrCorruptSnapshot))
+		assert(tr2.Len() == N+1)
+	}
+	bad := append([]byte{}, data...)
+	bad[4] = 99
+	err = tr2.Restore(bytes.NewReader(bad), decodeInt, nil)
+	assert(errors.Is(err, ErrVersionNotFound))
+	tr3 := NewBTreeGOptions(testLess, Options{ReadOnly: true})
+	err = tr3.Restore(bytes.NewReader(data), decodeInt, nil)
+	assert(errors.Is(err, ErrReadOnly))
+
+	// empty tree
+	buf.Reset()
+	assert(NewBTreeG(testLess).BackupTo(&buf, encodeInt, nil) == nil)
+	assert(tr2.Restore(&buf, decodeInt, nil) == nil)
+	assert(tr2.Len() == 0)
+	tr2.Set(1)
+	assert(tr2.Len() == 1)
+}
+
+func TestSnapshotTransform(t *testing.T) {
+	N := 10_000
+	tr := NewBTreeG(testLess)
+	for i := 0; i < N; i++ {
+		tr.Set(i)
+	}
+	var buf bytes.Buffer
+	assert(tr.BackupTo(&buf, encodeInt, nil) == nil)
+	tr2 := NewBTreeG(testLess)
+	err := tr2.Restore(&buf, decodeInt, &RestoreOptions[int]{
+		Transform: func(item int) (int, bool) {
+			// drop odd items and reverse the order of the rest
+			return -item, item%2 == 0
+		},
+	})
+	assert(err == nil)
+	tr2.sane()
+	assert(tr2.Len() == N/2)
+	for i := 0; i < N; i += 2 {
+		_, ok := tr2.Get(-i)
+		assert(ok)
+	}
+}
+
+func TestSnapshotEnvelope(t *testing.T) {
+	N := 10_000
+	tr := NewBTreeG(testLess)
+	for i := 0; i < N; i++ {
+		tr.Set(i)
+	}
+	// items divisible by 3 are written using a "future" encoding that the
+	// decoder does not understand
+	encode := func(dst []byte, item int) []byte {
+		if item%3 == 0 {
+			return append(dst, 0xff)
+		}
+		return encodeInt(dst, item)
+	}
+	var buf bytes.Buffer
+	err := tr.BackupTo(&buf, encode, &BackupOptions[int]{
+		Tag: func(item int) uint64 { return uint64(item % 3) },
+	})
+	assert(err == nil)
+	data := buf.Bytes()
+
+	tr2 := NewBTreeG(testLess)
+	assert(tr2.Restore(bytes.NewReader(data), decodeInt, nil) != nil)
+	assert(tr2.Len() == 0)
+	err = tr2.Restore(bytes.NewReader(data), decodeInt,
+		&RestoreOptions[int]{SkipInvalid: true})
+	assert(err == nil)
+	assert(tr2.Len() == N-(N+2)/3)
+	err = tr2.Restore(bytes.NewReader(data), decodeInt,
+		&RestoreOptions[int]{Tags: func(tag uint64) bool { return tag == 1 }})
+	assert(err == nil)
+	assert(tr2.Len() == (N+1)/3)
+	tr2.Scan(func(item int) bool {
+		assert(item%3 == 1)
+		return true
+	})
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	N := 1000
+	tr := NewBTreeG(testLess)
+	for _, key := range randKeys(N) {
+		tr.Set(key)
+	}
+	var buf bytes.Buffer
+	assert(tr.BackupTo(&buf, encodeInt, nil) == nil)
+	data := buf.Bytes()
+	info, err := VerifySnapshot(bytes.NewReader(data))
+	assert(err == nil && info.Count == N && info.Version == 1 && !info.Envelope)
+	info2, err := VerifySnapshotOrder(bytes.NewReader(data), decodeInt, testLess)
+	assert(err == nil && info2 == info)
+
+	bad := append([]byte{}, data...)
+	bad[len(bad)/2] ^= 1
+	_, err = VerifySnapshot(bytes.NewReader(bad))
+	assert(errors.Is(err, ErrCorruptSnapshot))
+	_, err = VerifySnapshot(bytes.NewReader(data[:len(data)-1]))
+	assert(errors.Is(err, ErrCorruptSnapshot))
+
+	// a snapshot of a tree with a different order is rejected
+	rev := NewBTreeG(func(a, b int) bool { return a > b })
+	rev.Load(2)
+	rev.Load(1)
+	buf.Reset()
+	assert(rev.BackupTo(&buf, encodeInt, nil) == nil)
+	_, err = VerifySnapshot(bytes.NewReader(buf.Bytes()))
+	assert(err == nil)
+	_, err = VerifySnapshotOrder(bytes.NewReader(buf.Bytes()), decodeInt,
+		testLess)
+	assert(errors.Is(err, ErrCorruptSnapshot))
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package sstable
+
+import "hash/fnv"
+
+func bloomHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// newBloom returns a bloom filter for the key hashes. The last byte holds the
+// number of hash functions. Probes are derived from the two halves of each
+// hash using double hashing.
+func newBloom(hashes []uint64, bitsPerKey int) []byte {
+	k := bitsPerKey * 69 / 100 // ln(2) * bits per key is optimal
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+	nbits := len(hashes) * bitsPerKey
+	if nbits < 64 {
+		nbits = 64
+	}
+	filter := make([]byte, (nbits+7)/8+1)
+	nbits = (len(filter) - 1) * 8
+	for _, h := range hashes {
+		h1, h2 := uint32(h), uint32(h>>32)
+		for i := 0; i < k; i++ {
+			bit := (h1 + uint32(i)*h2) % uint32(nbits)
+			filter[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	filter[len(filter)-1] = byte(k)
+	return filter
+}
+
+// bloomMayContain returns false if the key is definitely not in the filter.
+func bloomMayContain(filter []byte, key []byte) bool {
+	if len(filter) < 2 {
+		return true
+	}
+	k := int(filter[len(filter)-1])
+	nbits := uint32(len(filter)-1) * 8
+	h := bloomHash(key)
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := 0; i < k; i++ {
+		bit := (h1 + uint32(i)*h2) % nbits
+		if filter[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
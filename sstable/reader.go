@@ -0,0 +1,236 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// Reader reads a table. The block index and filter are held in memory, and
+// data blocks are read on demand.
+// It's safe for concurrent use by multiple goroutines.
+type Reader struct {
+	r      io.ReaderAt
+	index  []blockHandle
+	filter []byte
+	count  int
+}
+
+type blockHandle struct {
+	lastKey []byte
+	off, n  uint64
+}
+
+// Open a table of the provided size for reading.
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < int64(footerSize) {
+		return nil, ErrCorrupt
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-int64(footerSize)); err != nil {
+		return nil, readError(err)
+	}
+	if string(footer[footerSize-len(magic):]) != magic {
+		return nil, ErrCorrupt
+	}
+	var vals [5]uint64
+	for i := range vals {
+		vals[i] = binary.LittleEndian.Uint64(footer[i*8:])
+	}
+	rd := &Reader{r: r, count: int(vals[4])}
+	index, err := rd.readBlock(vals[0], vals[1], size)
+	if err != nil {
+		return nil, err
+	}
+	for len(index) > 0 {
+		var h blockHandle
+		var ok bool
+		if h.lastKey, index, ok = readBytes(index); !ok {
+			return nil, ErrCorrupt
+		}
+		if h.off, index, ok = readUvarint(index); !ok {
+			return nil, ErrCorrupt
+		}
+		if h.n, index, ok = readUvarint(index); !ok {
+			return nil, ErrCorrupt
+		}
+		rd.index = append(rd.index, h)
+	}
+	if vals[3] > 0 {
+		if rd.filter, err = rd.readBlock(vals[2], vals[3], size); err != nil {
+			return nil, err
+		}
+	}
+	return rd, nil
+}
+
+// readBlock reads a block and verifies its checksum. The returned data does
+// not include the checksum.
+func (rd *Reader) readBlock(off, n uint64, size int64) ([]byte, error) {
+	if n < 4 || off+n < off || off+n > uint64(size) {
+		return nil, ErrCorrupt
+	}
+	data := make([]byte, n)
+	if _, err := rd.r.ReadAt(data, int64(off)); err != nil {
+		return nil, readError(err)
+	}
+	data, sum := data[:n-4], binary.LittleEndian.Uint32(data[n-4:])
+	if crc32.Checksum(data, crc32c) != sum {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+func readUvarint(data []byte) (uint64, []byte, bool) {
+	v, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, false
+	}
+	return v, data[n:], true
+}
+
+func readBytes(data []byte) ([]byte, []byte, bool) {
+	n, data, ok := readUvarint(data)
+	if !ok || n > uint64(len(data)) {
+		return nil, nil, false
+	}
+	return data[:n], data[n:], true
+}
+
+// Len returns the number of entries in the table.
+func (rd *Reader) Len() int {
+	return rd.count
+}
+
+// Get the value for a key.
+// Returns false if the key was not found.
+func (rd *Reader) Get(key []byte) ([]byte, bool, error) {
+	if rd.filter != nil && !bloomMayContain(rd.filter, key) {
+		return nil, false, nil
+	}
+	it := rd.Iter()
+	if !it.Seek(key) || !bytes.Equal(it.Key(), key) {
+		return nil, false, it.Err()
+	}
+	return it.Value(), true, nil
+}
+
+// Prefetch reads and verifies every data block that may hold keys within the
+// range [start, end), so that the pages of the underlying file are cached by
+// the operating system before the first reads. An empty end reads to the last
+// block.
+func (rd *Reader) Prefetch(start, end []byte) error {
+	i := sort.Search(len(rd.index), func(i int) bool {
+		return bytes.Compare(rd.index[i].lastKey, start) >= 0
+	})
+	for ; i < len(rd.index); i++ {
+		h := rd.index[i]
+		if _, err := rd.readBlock(h.off, h.n, int64(h.off+h.n)); err != nil {
+			return err
+		}
+		if len(end) > 0 && bytes.Compare(h.lastKey, end) >= 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// Iterator iterates over the entries of a table in key order.
+type Iterator struct {
+	rd         *Reader
+	block      int    // index of the current block
+	data       []byte // unread entries of the current block
+	key, value []byte
+	err        error
+}
+
+// Iter returns an iterator for the table. It must be positioned using First
+// or Seek before use.
+func (rd *Reader) Iter() *Iterator {
+	return &Iterator{rd: rd}
+}
+
+func (it *Iterator) loadBlock(i int) bool {
+	it.block, it.data = i, nil
+	if i >= len(it.rd.index) {
+		return false
+	}
+	h := it.rd.index[i]
+	it.data, it.err = it.rd.readBlock(h.off, h.n, int64(h.off+h.n))
+	return it.err == nil
+}
+
+// First moves the iterator to the first entry.
+// Returns false if the table is empty.
+func (it *Iterator) First() bool {
+	if !it.loadBlock(0) {
+		return false
+	}
+	return it.Next()
+}
+
+// Seek moves the iterator to the first entry with a key greater than or
+// equal to key.
+// Returns false if there is no such entry.
+func (it *Iterator) Seek(key []byte) bool {
+	i := sort.Search(len(it.rd.index), func(i int) bool {
+		return bytes.Compare(it.rd.index[i].lastKey, key) >= 0
+	})
+	if !it.loadBlock(i) {
+		return false
+	}
+	for it.Next() {
+		if bytes.Compare(it.key, key) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Next moves the iterator to the next entry.
+// Returns false if there are no more entries or an error occurred.
+func (it *Iterator) Next() bool {
+	for len(it.data) == 0 {
+		if it.err != nil || !it.loadBlock(it.block+1) {
+			return false
+		}
+	}
+	var ok bool
+	if it.key, it.data, ok = readBytes(it.data); ok {
+		it.value, it.data, ok = readBytes(it.data)
+	}
+	if !ok {
+		it.err, it.data = ErrCorrupt, nil
+		return false
+	}
+	return true
+}
+
+// Key returns the key of the current entry.
+// The returned slice must not be modified.
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current entry.
+// The returned slice must not be modified.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the error, if any, that stopped the iteration.
+func (it *Iterator) Err() error {
+	return it.err
+}
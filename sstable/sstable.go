@@ -0,0 +1,185 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sstable writes and reads immutable sorted string tables, bridging
+// in-memory trees to LSM-style on-disk storage.
+//
+// A table is a sequence of data blocks holding sorted key-value pairs,
+// followed by a block index, an optional bloom filter, and a fixed size
+// footer.
+//
+//	block    entries, crc32c uint32
+//	entry    uvarint key length, key, uvarint value length, value
+//	index    count * (uvarint key length, last key of block,
+//	         uvarint block offset, uvarint block length), crc32c uint32
+//	filter   bloom filter bits, number of hashes byte, crc32c uint32
+//	footer   index offset, index length, filter offset, filter length,
+//	         entry count, each uint64 little-endian, magic [8]byte
+//
+// Block lengths include their checksums.
+package sstable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/tidwall/btree"
+)
+
+const (
+	magic      = "BTRSST01"
+	footerSize = 5*8 + len(magic)
+	// DefaultBlockSize is the target size of a data block.
+	DefaultBlockSize = 4096
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrCorrupt is returned when a table is malformed or fails a checksum.
+	ErrCorrupt = errors.New("sstable: corrupt table")
+	// ErrOutOfOrder is returned by Writer.Add when keys are not added in
+	// strictly increasing order.
+	ErrOutOfOrder = errors.New("sstable: keys out of order")
+)
+
+// Options for passing to the NewWriter and WriteTree functions.
+type Options struct {
+	// BlockSize is the target size of a data block. Default is
+	// DefaultBlockSize.
+	BlockSize int
+	// BloomBitsPerKey, if provided, adds a bloom filter using this many bits
+	// per key, which lets Get skip reading blocks for most missing keys.
+	// Ten bits per key gives about a one percent false positive rate.
+	BloomBitsPerKey int
+}
+
+// Writer writes a table. Keys must be added in strictly increasing byte
+// order.
+type Writer struct {
+	w         *bufio.Writer
+	opts      Options
+	off       uint64
+	block     []byte
+	lastKey   []byte
+	index     []byte
+	keyHashes []uint64
+	count     uint64
+	err       error
+}
+
+// NewWriter returns a Writer that writes a table to w.
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	wr := &Writer{w: bufio.NewWriter(w)}
+	if opts != nil {
+		wr.opts = *opts
+	}
+	if wr.opts.BlockSize <= 0 {
+		wr.opts.BlockSize = DefaultBlockSize
+	}
+	return wr
+}
+
+// Add a key-value pair to the table.
+func (wr *Writer) Add(key, value []byte) error {
+	if wr.err != nil {
+		return wr.err
+	}
+	if wr.count > 0 && bytes.Compare(key, wr.lastKey) <= 0 {
+		return ErrOutOfOrder
+	}
+	wr.block = binary.AppendUvarint(wr.block, uint64(len(key)))
+	wr.block = append(wr.block, key...)
+	wr.block = binary.AppendUvarint(wr.block, uint64(len(value)))
+	wr.block = append(wr.block, value...)
+	wr.lastKey = append(wr.lastKey[:0], key...)
+	if wr.opts.BloomBitsPerKey > 0 {
+		wr.keyHashes = append(wr.keyHashes, bloomHash(key))
+	}
+	wr.count++
+	if len(wr.block) >= wr.opts.BlockSize {
+		wr.flushBlock()
+	}
+	return wr.err
+}
+
+// write writes a block with a trailing checksum and returns its offset and
+// length.
+func (wr *Writer) write(data []byte) (off, n uint64) {
+	if wr.err != nil {
+		return 0, 0
+	}
+	data = binary.LittleEndian.AppendUint32(data,
+		crc32.Checksum(data, crc32c))
+	if _, wr.err = wr.w.Write(data); wr.err != nil {
+		return 0, 0
+	}
+	off = wr.off
+	wr.off += uint64(len(data))
+	return off, uint64(len(data))
+}
+
+func (wr *Writer) flushBlock() {
+	if len(wr.block) == 0 {
+		return
+	}
+	off, n := wr.write(wr.block)
+	wr.index = binary.AppendUvarint(wr.index, uint64(len(wr.lastKey)))
+	wr.index = append(wr.index, wr.lastKey...)
+	wr.index = binary.AppendUvarint(wr.index, off)
+	wr.index = binary.AppendUvarint(wr.index, n)
+	wr.block = wr.block[:0]
+}
+
+// Close finishes the table by writing the index, filter and footer. It does
+// not close the underlying writer.
+func (wr *Writer) Close() error {
+	wr.flushBlock()
+	indexOff, indexLen := wr.write(wr.index)
+	var filterOff, filterLen uint64
+	if wr.opts.BloomBitsPerKey > 0 {
+		filter := newBloom(wr.keyHashes, wr.opts.BloomBitsPerKey)
+		filterOff, filterLen = wr.write(filter)
+	}
+	if wr.err != nil {
+		return wr.err
+	}
+	var footer []byte
+	for _, v := range []uint64{indexOff, indexLen, filterOff, filterLen,
+		wr.count} {
+		footer = binary.LittleEndian.AppendUint64(footer, v)
+	}
+	footer = append(footer, magic...)
+	if _, wr.err = wr.w.Write(footer); wr.err != nil {
+		return wr.err
+	}
+	wr.err = wr.w.Flush()
+	return wr.err
+}
+
+// WriteTree writes a table holding all items in the tree. The encode
+// function returns the key and value for an item, and must produce unique
+// keys whose byte order matches the tree order.
+//
+// The tree is only locked while its root is captured using a copy-on-write
+// Copy. Writers may continue modifying the tree while the table is written.
+func WriteTree[T any](w io.Writer, tr *btree.BTreeG[T],
+	encode func(item T) (key, value []byte), opts *Options,
+) error {
+	wr := NewWriter(w, opts)
+	var err error
+	tr.Copy().Scan(func(item T) bool {
+		key, value := encode(item)
+		err = wr.Add(key, value)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return wr.Close()
+}
@@ -0,0 +1,156 @@
+package sstable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tidwall/btree"
+)
+
+type kv struct{ key, value string }
+
+func writeTable(t *testing.T, n int, opts *Options) []byte {
+	t.Helper()
+	tr := btree.NewBTreeG(func(a, b kv) bool { return a.key < b.key })
+	for i := 0; i < n; i++ {
+		tr.Set(kv{fmt.Sprintf("key:%06d", i*2), fmt.Sprint(i)})
+	}
+	var buf bytes.Buffer
+	err := WriteTree(&buf, tr, func(item kv) ([]byte, []byte) {
+		return []byte(item.key), []byte(item.value)
+	}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTable(t *testing.T) {
+	for _, opts := range []*Options{nil, {BlockSize: 64, BloomBitsPerKey: 10}} {
+		N := 10000
+		data := writeTable(t, N, opts)
+		rd, err := Open(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rd.Len() != N {
+			t.Fatalf("expected %d, got %d", N, rd.Len())
+		}
+		for i := 0; i < N*2; i++ {
+			value, ok, err := rd.Get([]byte(fmt.Sprintf("key:%06d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (i%2 == 0) || (ok && string(value) != fmt.Sprint(i/2)) {
+				t.Fatalf("bad get %d: %v %q", i, ok, value)
+			}
+		}
+		it := rd.Iter()
+		var count int
+		for ok := it.First(); ok; ok = it.Next() {
+			if string(it.Key()) != fmt.Sprintf("key:%06d", count*2) {
+				t.Fatalf("bad key %q", it.Key())
+			}
+			count++
+		}
+		if count != N || it.Err() != nil {
+			t.Fatalf("expected %d, got %d (%v)", N, count, it.Err())
+		}
+		if !it.Seek([]byte("key:000101")) || string(it.Key()) != "key:000102" {
+			t.Fatalf("bad seek %q", it.Key())
+		}
+		if it.Seek([]byte("key:999999")) {
+			t.Fatal("expected seek past end to fail")
+		}
+	}
+}
+
+func TestTableCorrupt(t *testing.T) {
+	data := writeTable(t, 100, nil)
+	for _, i := range []int{0, len(data) / 2, len(data) - 1} {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0xFF
+		rd, err := Open(bytes.NewReader(bad), int64(len(bad)))
+		if err == nil {
+			it := rd.Iter()
+			for it.First(); it.Next(); {
+			}
+			err = it.Err()
+		}
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("byte %d: expected ErrCorrupt, got %v", i, err)
+		}
+	}
+	if _, err := Open(bytes.NewReader(data[:10]), 10); err != ErrCorrupt {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestWriterOrder(t *testing.T) {
+	wr := NewWriter(new(bytes.Buffer), nil)
+	if err := wr.Add([]byte("b"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Add([]byte("a"), nil); err != ErrOutOfOrder {
+		t.Fatalf("expected ErrOutOfOrder, got %v", err)
+	}
+	if err := wr.Add([]byte("b"), nil); err != ErrOutOfOrder {
+		t.Fatalf("expected ErrOutOfOrder, got %v", err)
+	}
+}
+
+func TestEmptyTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, &Options{BloomBitsPerKey: 10}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := rd.Get([]byte("a")); ok || rd.Len() != 0 || rd.Iter().First() {
+		t.Fatal("expected empty table")
+	}
+}
+
+type countingReader struct {
+	r     *bytes.Reader
+	reads int
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	r.reads++
+	return r.r.ReadAt(p, off)
+}
+
+func TestPrefetch(t *testing.T) {
+	data := writeTable(t, 10000, &Options{BlockSize: 64})
+	cr := &countingReader{r: bytes.NewReader(data)}
+	rd, err := Open(cr, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr.reads = 0
+	if err := rd.Prefetch([]byte("key:001000"), []byte("key:001100")); err != nil {
+		t.Fatal(err)
+	}
+	if cr.reads == 0 || cr.reads > 50 {
+		t.Fatalf("expected a few block reads, got %d", cr.reads)
+	}
+	cr.reads = 0
+	if err := rd.Prefetch([]byte("key:999999"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if cr.reads != 0 {
+		t.Fatalf("expected no block reads, got %d", cr.reads)
+	}
+	if err := rd.Prefetch(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	data[10] ^= 0xFF
+	if err := rd.Prefetch(nil, nil); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
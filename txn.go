@@ -0,0 +1,125 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CondKind is the kind of a Cond.
+type CondKind int
+
+const (
+	// CondExists requires an item for the key.
+	CondExists CondKind = iota
+	// CondNotExists requires no item for the key.
+	CondNotExists
+	// CondMatch requires an item for the key for which Match returns true,
+	// such as an item with an expected version.
+	CondMatch
+)
+
+// Cond is a condition that is checked by CompareAndApply.
+type Cond[T any] struct {
+	Kind  CondKind
+	Key   T
+	Match func(item T) bool // for CondMatch
+}
+
+// OpKind is the kind of an Op.
+type OpKind int
+
+const (
+	// OpSet sets or replaces the item.
+	OpSet OpKind = iota
+	// OpDelete deletes the item for the key of the item.
+	OpDelete
+)
+
+// Op is a write that is applied by CompareAndApply.
+type Op[T any] struct {
+	Kind OpKind
+	Item T
+}
+
+// CompareAndApply checks all conditions and, only when every condition holds,
+// applies all operations in order. The checks and the writes happen
+// atomically under a single lock, so other readers and writers see either
+// none or all of the operations.
+//
+// Returns ErrCondFailed if a condition does not hold, ErrFull if the
+// operations would exceed Options.MaxItems, and ErrReadOnly if the tree is
+// read-only. The tree is unchanged when an error is returned.
+func (tr *BTreeG[T]) CompareAndApply(conds []Cond[T], ops []Op[T]) error {
+	if tr.readOnly {
+		return ErrReadOnly
+	}
+	if tr.lock(true) {
+		defer tr.unlock(true)
+	}
+	for i, cond := range conds {
+		item, found := tr.get(cond.Key, nil, false)
+		var ok bool
+		switch cond.Kind {
+		case CondExists:
+			ok = found
+		case CondNotExists:
+			ok = !found
+		case CondMatch:
+			ok = found && cond.Match(item)
+		default:
+			panic("invalid condition kind")
+		}
+		if !ok {
+			return fmt.Errorf("%w: condition %d", ErrCondFailed, i)
+		}
+	}
+	for _, op := range ops {
+		if op.Kind != OpSet && op.Kind != OpDelete {
+			panic("invalid operation kind")
+		}
+	}
+	if tr.maxItems > 0 && tr.count+tr.opsDelta(ops) > tr.maxItems {
+		return ErrFull
+	}
+	for _, op := range ops {
+		switch op.Kind {
+		case OpSet:
+			tr.setHint(op.Item, nil, false)
+			tr.untomb(op.Item)
+		case OpDelete:
+			tr.deleteHint(op.Item, nil)
+		}
+	}
+	return nil
+}
+
+// opsDelta returns the change in the number of items that applying the
+// operations would cause. The last operation for each key decides whether
+// the key ends up in the tree.
+func (tr *BTreeG[T]) opsDelta(ops []Op[T]) int {
+	idx := make([]int, len(ops))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return tr.less(ops[idx[i]].Item, ops[idx[j]].Item)
+	})
+	var delta int
+	for i := 0; i < len(idx); i++ {
+		last := ops[idx[i]]
+		for i+1 < len(idx) && !tr.less(last.Item, ops[idx[i+1]].Item) {
+			i++
+			last = ops[idx[i]]
+		}
+		_, found := tr.rank(last.Item)
+		if last.Kind == OpSet && !found {
+			delta++
+		} else if last.Kind == OpDelete && found {
+			delta--
+		}
+	}
+	return delta
+}
@@ -0,0 +1,73 @@
+package btree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareAndApply(t *testing.T) {
+	type kv struct {
+		key, ver int
+	}
+	less := func(a, b kv) bool { return a.key < b.key }
+	tr := NewBTreeGOptions(less, Options{MaxItems: 5})
+	tr.Set(kv{1, 1})
+	tr.Set(kv{2, 1})
+	ver := func(v int) func(item kv) bool {
+		return func(item kv) bool { return item.ver == v }
+	}
+
+	err := tr.CompareAndApply([]Cond[kv]{
+		{Kind: CondMatch, Key: kv{key: 1}, Match: ver(1)},
+		{Kind: CondExists, Key: kv{key: 2}},
+		{Kind: CondNotExists, Key: kv{key: 3}},
+	}, []Op[kv]{
+		{OpSet, kv{1, 2}},
+		{OpDelete, kv{key: 2}},
+		{OpSet, kv{3, 1}},
+	})
+	assert(err == nil)
+	assert(itemsEqual(tr.Items(), []kv{{1, 2}, {3, 1}}))
+
+	// a failed condition leaves the tree unchanged
+	err = tr.CompareAndApply([]Cond[kv]{
+		{Kind: CondNotExists, Key: kv{key: 4}},
+		{Kind: CondMatch, Key: kv{key: 1}, Match: ver(1)},
+	}, []Op[kv]{{OpSet, kv{4, 1}}})
+	assert(errors.Is(err, ErrCondFailed))
+	err = tr.CompareAndApply([]Cond[kv]{{Kind: CondExists, Key: kv{key: 9}}},
+		nil)
+	assert(errors.Is(err, ErrCondFailed))
+	assert(itemsEqual(tr.Items(), []kv{{1, 2}, {3, 1}}))
+
+	// the last operation for a key decides the item count
+	err = tr.CompareAndApply(nil, []Op[kv]{
+		{OpSet, kv{4, 1}}, {OpSet, kv{5, 1}}, {OpSet, kv{6, 1}},
+		{OpDelete, kv{key: 6}}, {OpSet, kv{5, 2}},
+	})
+	assert(err == nil && tr.Len() == 4)
+	err = tr.CompareAndApply(nil, []Op[kv]{
+		{OpDelete, kv{key: 1}}, {OpSet, kv{7, 1}}, {OpSet, kv{8, 1}},
+		{OpSet, kv{9, 1}},
+	})
+	assert(errors.Is(err, ErrFull) && tr.Len() == 4)
+	err = tr.CompareAndApply(nil, []Op[kv]{
+		{OpDelete, kv{key: 1}}, {OpSet, kv{7, 1}}, {OpSet, kv{1, 1}},
+	})
+	assert(err == nil && tr.Len() == 5)
+
+	tr.Freeze()
+	assert(tr.CompareAndApply(nil, nil) == ErrReadOnly)
+}
+
+func itemsEqual[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
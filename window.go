@@ -0,0 +1,81 @@
+// Copyright 2020 Joshua J Baker. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package btree
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// WindowIndex indexes items by event time for watermark-based windowing in
+// stream processing. Items may arrive out of order. When the watermark
+// passes the end of a window, CloseWindow removes and returns the window's
+// items in O(log n + k).
+type WindowIndex[T any] struct {
+	tr  *BTreeG[windowEntry[T]]
+	seq uint64
+}
+
+type windowEntry[T any] struct {
+	time int64
+	seq  uint64 // keeps items with the same event time in arrival order
+	item T
+}
+
+// NewWindowIndex returns a new WindowIndex.
+func NewWindowIndex[T any](opts Options) *WindowIndex[T] {
+	return &WindowIndex[T]{
+		tr: NewBTreeGOptions(func(a, b windowEntry[T]) bool {
+			if a.time != b.time {
+				return a.time < b.time
+			}
+			return a.seq < b.seq
+		}, opts),
+	}
+}
+
+// Add an item with an event time.
+func (w *WindowIndex[T]) Add(time int64, item T) {
+	seq := atomic.AddUint64(&w.seq, 1)
+	w.tr.Set(windowEntry[T]{time, seq, item})
+}
+
+// Len returns the number of items in the index.
+func (w *WindowIndex[T]) Len() int {
+	return w.tr.Len()
+}
+
+// Oldest returns the earliest event time in the index.
+// Returns false if the index is empty.
+func (w *WindowIndex[T]) Oldest() (int64, bool) {
+	e, ok := w.tr.Min()
+	return e.time, ok
+}
+
+// Window returns the items with event times in the range [start, end), in
+// event time order, without removing them.
+func (w *WindowIndex[T]) Window(start, end int64) []T {
+	var items []T
+	w.tr.AscendRange(windowEntry[T]{time: start}, windowEntry[T]{time: end},
+		func(e windowEntry[T]) bool {
+			items = append(items, e.item)
+			return true
+		})
+	return items
+}
+
+// CloseWindow removes and returns all items with event times before end, in
+// event time order. When windows are closed in order, these are the items
+// of the window ending at end. Late items that belong to windows that were
+// already closed are included.
+func (w *WindowIndex[T]) CloseWindow(end int64) []T {
+	deleted := w.tr.DeleteRange(windowEntry[T]{time: math.MinInt64},
+		windowEntry[T]{time: end}, nil)
+	items := make([]T, 0, deleted.Len())
+	deleted.Scan(func(e windowEntry[T]) bool {
+		items = append(items, e.item)
+		return true
+	})
+	return items
+}
@@ -0,0 +1,38 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestWindowIndex(t *testing.T) {
+	w := NewWindowIndex[int](Options{})
+	N := 10_000
+	for _, i := range rand.Perm(N) {
+		w.Add(int64(i/10), i)
+	}
+	assert(w.Len() == N)
+	oldest, ok := w.Oldest()
+	assert(ok && oldest == 0)
+	items := w.Window(100, 200)
+	assert(len(items) == 1000)
+	for i := 1; i < len(items); i++ {
+		assert(items[i-1]/10 <= items[i]/10)
+	}
+	for end := int64(100); end <= int64(N/10); end += 100 {
+		items := w.CloseWindow(end)
+		assert(len(items) == 1000)
+		for _, item := range items {
+			assert(int64(item/10) >= end-100 && int64(item/10) < end)
+		}
+		assert(w.Len() == N-int(end)*10)
+	}
+	_, ok = w.Oldest()
+	assert(!ok)
+	// late items and items with equal times keep their arrival order
+	w.Add(5, 1)
+	w.Add(5, 2)
+	w.Add(3, 3)
+	items = w.CloseWindow(10)
+	assert(len(items) == 3 && items[0] == 3 && items[1] == 1 && items[2] == 2)
+}